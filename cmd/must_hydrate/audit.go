@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/openshift-splat-team/must-hydrate/pkg/audit"
+)
+
+// runAudit prints the events of an audit log written by serve --audit-log which match the filters.
+func runAudit(args []string) error {
+	flags := newCommandFlagSet("audit", "[flags] AUDIT_LOG")
+	var users, verbs, resources stringSliceFlag
+	flags.Var(&users, "user", "Only show requests made by, or impersonating, matching users. Glob patterns are supported. May be repeated")
+	flags.Var(&verbs, "verb", "Only show requests with these verbs, such as get, list, watch, create, update, patch or delete. May be repeated")
+	flags.Var(&resources, "resource", "Only show requests for matching resources, such as pods, deployments.apps or pods/log. Glob patterns are supported. May be repeated")
+	namespace := flags.String("namespace", "", "Only show requests for objects in matching namespaces. Glob patterns are supported")
+	name := flags.String("name", "", "Only show requests for matching objects. Glob patterns are supported")
+	since := flags.String("since", "", "Only show requests received at or after this time, as RFC3339 or a duration before now such as 10m")
+	until := flags.String("until", "", "Only show requests received at or before this time, as RFC3339 or a duration before now such as 10m")
+	output := flags.String("output", "text", "Output format. One of text or json, which writes one event per line")
+	_ = flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return fmt.Errorf("a single audit log must be provided")
+	}
+
+	query := audit.Query{
+		Users:     users,
+		Verbs:     verbs,
+		Resources: resources,
+		Namespace: *namespace,
+		Name:      *name,
+	}
+	var err error
+	if query.Since, err = parseTime(*since); err != nil {
+		return err
+	}
+	if query.Until, err = parseTime(*until); err != nil {
+		return err
+	}
+
+	var handle func(event *audit.Event) error
+	switch *output {
+	case "json":
+		// events are written as they were logged
+		handle = func(event *audit.Event) error {
+			_, err := fmt.Printf("%s\n", event.Raw)
+			return err
+		}
+	case "text":
+		handle = func(event *audit.Event) error {
+			_, err := fmt.Println(formatEvent(event))
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported output format: %s", *output)
+	}
+
+	log, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return fmt.Errorf("unable to open the audit log. %v", err)
+	}
+	defer log.Close()
+	return audit.ReadLog(log, query, handle)
+}
+
+// formatEvent formats an event on a single line: when it was received, who made it, the verb,
+// the response code and the object.
+func formatEvent(event *audit.Event) string {
+	user := event.User.Username
+	if event.ImpersonatedUser != nil {
+		user = fmt.Sprintf("%s (as %s)", event.User.Username, event.ImpersonatedUser.Username)
+	}
+
+	object := event.RequestURI
+	if ref := event.ObjectRef; ref != nil {
+		object = ref.Resource
+		if len(ref.APIGroup) > 0 {
+			object += "." + ref.APIGroup
+		}
+		if len(ref.Subresource) > 0 {
+			object += "/" + ref.Subresource
+		}
+		switch {
+		case len(ref.Namespace) > 0 && len(ref.Name) > 0:
+			object += fmt.Sprintf(" %s/%s", ref.Namespace, ref.Name)
+		case len(ref.Namespace) > 0:
+			object += fmt.Sprintf(" -n %s", ref.Namespace)
+		case len(ref.Name) > 0:
+			object += " " + ref.Name
+		}
+	}
+
+	received := event.RequestReceivedTimestamp.UTC().Format(time.RFC3339Nano)
+	return fmt.Sprintf("%-30s %-50s %-16s %3d %s", received, user, event.Verb, event.Code(), object)
+}
+
+// parseTime parses an RFC3339 time, or a duration before now. An empty value is the zero time.
+func parseTime(value string) (time.Time, error) {
+	if len(value) == 0 {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s is neither an RFC3339 time nor a duration", value)
+	}
+	return t, nil
+}
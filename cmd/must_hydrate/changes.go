@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// changesTimeout bounds how long listing every object for the report of changes may take.
+const changesTimeout = time.Minute
+
+// writeChanges writes the report of the changes made since hydration converged to changesOut. No
+// report is written if hydration did not converge, as no baseline was taken.
+func (i *instance) writeChanges() error {
+	recorder := i.hydrator.ChangeRecorder
+	if recorder == nil || len(i.changesOut) == 0 {
+		return nil
+	}
+	if !recorder.Recording() {
+		logf.Log.Info("hydration did not converge, not writing the changes", "dataDir", i.hydrator.RootPath)
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), changesTimeout)
+	defer cancel()
+	report, err := recorder.Report(ctx)
+	if err != nil {
+		return err
+	}
+
+	out, err := os.Create(i.changesOut)
+	if err != nil {
+		return fmt.Errorf("unable to create %s. %v", i.changesOut, err)
+	}
+	defer out.Close()
+	if strings.HasSuffix(i.changesOut, ".json") {
+		err = report.WriteJSON(out)
+	} else {
+		err = report.WriteText(out)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to write %s. %v", i.changesOut, err)
+	}
+	logf.Log.Info("wrote the changes", "path", i.changesOut, "objects", len(report.Changes))
+	return nil
+}
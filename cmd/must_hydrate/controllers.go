@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"plugin"
+	"strings"
+
+	"github.com/openshift-splat-team/must-hydrate/pkg/controller"
+	"github.com/openshift-splat-team/must-hydrate/pkg/hydrate"
+	rbacv1 "k8s.io/api/rbac/v1"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/yaml"
+)
+
+// controllerFlags are the serve flags which run controllers against the hydrated control plane.
+type controllerFlags struct {
+	plugins stringSliceFlag
+	sidecar string
+	user    string
+	rbac    string
+}
+
+// enabled returns true if plugins or a sidecar are to be run.
+func (f *controllerFlags) enabled() bool {
+	return len(f.plugins) > 0 || len(f.sidecar) > 0
+}
+
+// load loads the plugins, which register their controllers when they are opened, and returns
+// the options the controllers and sidecar run with.
+func (f *controllerFlags) load() (hydrate.ControllerOptions, error) {
+	options := hydrate.ControllerOptions{User: f.user}
+	for _, path := range f.plugins {
+		registered := len(hydrate.RegisteredControllers())
+		if _, err := plugin.Open(expandHome(path)); err != nil {
+			return options, fmt.Errorf("unable to load the controller plugin %s. %v", path, err)
+		}
+		if len(hydrate.RegisteredControllers()) == registered {
+			return options, fmt.Errorf("the controller plugin %s did not call hydrate.RegisterController", path)
+		}
+	}
+
+	if len(f.rbac) > 0 {
+		data, err := os.ReadFile(expandHome(f.rbac))
+		if err != nil {
+			return options, fmt.Errorf("unable to read %s. %v", f.rbac, err)
+		}
+		// a ClusterRole or Role holds the rules of the controllers
+		role := &rbacv1.ClusterRole{}
+		if err := yaml.Unmarshal(data, role); err != nil {
+			return options, fmt.Errorf("unable to read the rules of %s. %v", f.rbac, err)
+		}
+		if len(role.Rules) == 0 {
+			return options, fmt.Errorf("%s holds no rules", f.rbac)
+		}
+		options.Rules = role.Rules
+	}
+	return options, nil
+}
+
+// runners returns the functions which run the registered controllers and the sidecar against
+// the control plane of the hydrator until the context is done.
+func (f *controllerFlags) runners(hydrator *controller.HydratorReconciler, options hydrate.ControllerOptions) []func(context.Context) error {
+	options.Logger = logf.Log.WithValues("dataDir", hydrator.RootPath)
+
+	var runners []func(context.Context) error
+	if len(f.plugins) > 0 {
+		runners = append(runners, func(ctx context.Context) error {
+			return hydrate.RunControllers(ctx, hydrator, options)
+		})
+	}
+	if len(f.sidecar) > 0 {
+		command := strings.Fields(f.sidecar)
+		runners = append(runners, func(ctx context.Context) error {
+			return hydrate.RunSidecar(ctx, hydrator, options, command)
+		})
+	}
+	return runners
+}
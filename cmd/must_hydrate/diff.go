@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/openshift-splat-team/must-hydrate/pkg/controller"
+	"github.com/openshift-splat-team/must-hydrate/pkg/diff"
+)
+
+// runDiff compares the objects of two must-gathers, normalised as they would be hydrated.
+func runDiff(args []string) error {
+	flags := newCommandFlagSet("diff", "[flags] <from> <to>")
+	output := flags.String("output", "text", "Output format. One of text, json or html")
+	_ = flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		return errors.New("two must-gathers are required")
+	}
+
+	var loaded [2]*controller.HydratorReconciler
+	for i, dataDir := range flags.Args() {
+		loaded[i] = &controller.HydratorReconciler{
+			RootPath: dataDir,
+		}
+		if err := loaded[i].Load(); err != nil {
+			return fmt.Errorf("unable to load %s. %v", dataDir, err)
+		}
+	}
+
+	result := diff.Compare(loaded[0].Resources(), loaded[1].Resources())
+	result.From, result.To = flags.Arg(0), flags.Arg(1)
+
+	switch *output {
+	case "text":
+		return result.WriteText(os.Stdout)
+	case "json":
+		return result.WriteJSON(os.Stdout)
+	case "html":
+		return result.WriteHTML(os.Stdout)
+	default:
+		return fmt.Errorf("unsupported output format: %s", *output)
+	}
+}
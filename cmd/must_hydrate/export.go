@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/openshift-splat-team/must-hydrate/pkg/controller"
+	"github.com/openshift-splat-team/must-hydrate/pkg/export"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// runExport writes the selected objects of the must-gather, normalised as they would be
+// hydrated, as multi-document YAML or as a Go file for use as test fixtures.
+func runExport(args []string) error {
+	flags, options := newFlagSet("export", "[flags] [Kind[.group]/[namespace/]name...]")
+	outputPath := flags.String("output", "-", "File to write the objects to, such as testdata/fixtures.yaml. - writes to stdout")
+	outputFormat := flags.String("format", "yaml", "Output format. One of yaml or go")
+	packageName := flags.String("package", "fixtures", "Package of the Go file written with --format=go")
+	variable := flags.String("var", "Objects", "Name of the variable holding the objects in the Go file written with --format=go")
+	closure := flags.Bool("closure", false, "Export the referenced objects and the objects they depend on, such as their owners, dependents, namespaces, CRDs and the ConfigMaps, Secrets, ServiceAccounts and PersistentVolumeClaims of their pods")
+	labelSelector := flags.String("selector", "", "Label selector, such as app=etcd,tier!=test")
+	flags.StringVar(labelSelector, "l", "", "Shorthand for --selector")
+	var overlays stringSliceFlag
+	flags.Var(&overlays, "overlay", "Directory of patches, deletions and objects applied on top of the must-gather. May be repeated")
+	var kinds, namespaces stringSliceFlag
+	flags.Var(&kinds, "kind", "Kind to export, optionally qualified by its group such as Infrastructure.config.openshift.io. May be repeated")
+	flags.Var(&namespaces, "namespace", "Namespace to export. May be repeated")
+	flags.Var(&namespaces, "n", "Shorthand for --namespace")
+	_ = flags.Parse(args)
+
+	if *outputFormat != "yaml" && *outputFormat != "go" {
+		return fmt.Errorf("unsupported output format: %s", *outputFormat)
+	}
+
+	selector := export.Selector{
+		Kinds:      kinds,
+		Namespaces: namespaces,
+	}
+	if len(*labelSelector) > 0 {
+		parsed, err := labels.Parse(*labelSelector)
+		if err != nil {
+			return fmt.Errorf("invalid label selector. %v", err)
+		}
+		selector.Labels = parsed
+	}
+	for _, arg := range flags.Args() {
+		ref, err := export.ParseRef(arg)
+		if err != nil {
+			return err
+		}
+		selector.Refs = append(selector.Refs, ref)
+	}
+	if *closure && (len(selector.Refs) == 0 || len(kinds) > 0 || len(namespaces) > 0 || selector.Labels != nil) {
+		return fmt.Errorf("--closure requires object references and can not be combined with --kind, --namespace or --selector")
+	}
+
+	hydrator := &controller.HydratorReconciler{
+		RootPath: options.dataDir,
+		Overlays: overlays,
+	}
+	if err := hydrator.Load(); err != nil {
+		return err
+	}
+	objects := hydrator.Resources()
+	if *closure {
+		var err error
+		if objects, err = export.Closure(objects, selector.Refs); err != nil {
+			return err
+		}
+	} else {
+		objects = export.Select(objects, selector)
+	}
+	selected := len(selector.Refs) > 0 || len(kinds) > 0 || len(namespaces) > 0 || selector.Labels != nil
+	if selected && len(objects) == 0 {
+		return fmt.Errorf("no objects in %s match the selection", options.dataDir)
+	}
+
+	// the objects are written in full before the output is opened, so that an existing file is
+	// not truncated by an export which fails
+	var b bytes.Buffer
+	var err error
+	switch *outputFormat {
+	case "yaml":
+		err = export.WriteYAML(&b, objects)
+	case "go":
+		err = export.WriteGo(&b, objects, export.GoOptions{
+			Package:  *packageName,
+			Variable: *variable,
+			Source:   filepath.Base(options.dataDir),
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	if *outputPath == "-" {
+		_, err = os.Stdout.Write(b.Bytes())
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(*outputPath), 0755); err != nil {
+		return fmt.Errorf("unable to create the directory of %s. %v", *outputPath, err)
+	}
+	if err := os.WriteFile(*outputPath, b.Bytes(), 0644); err != nil {
+		return fmt.Errorf("unable to write %s. %v", *outputPath, err)
+	}
+	return nil
+}
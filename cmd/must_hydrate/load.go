@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/openshift-splat-team/must-hydrate/pkg/controller"
+)
+
+// runLoad loads the must-gather without starting a control plane and summarises the resources
+// and container logs which would be hydrated.
+func runLoad(args []string) error {
+	flags, options := newFlagSet("load", "[flags]")
+	output := flags.String("output", "text", "Output format. One of text or json")
+	var overlays stringSliceFlag
+	flags.Var(&overlays, "overlay", "Directory of patches, deletions and objects applied on top of the must-gather. May be repeated")
+	_ = flags.Parse(args)
+
+	hydrator := &controller.HydratorReconciler{
+		RootPath: options.dataDir,
+		Overlays: overlays,
+	}
+	if err := hydrator.Load(); err != nil {
+		return err
+	}
+
+	status := hydrator.Status()
+	logReport := hydrator.LogReport()
+
+	switch *output {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(map[string]any{
+			"resources":       status.Loaded,
+			"resourcesByKind": status.RemainingByKind,
+			"logs":            status.Logs,
+			"logReport":       logReport,
+			"snapshotKey":     hydrator.InputKey(),
+		})
+	case "text":
+		var keys []string
+		for key := range status.RemainingByKind {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Printf("%-80s %d\n", key, status.RemainingByKind[key])
+		}
+		fmt.Printf("\n%d resources of %d kinds loaded from %s\n", status.Loaded, len(keys), status.RootPath)
+		fmt.Printf("%d container logs mapped\n", status.Logs)
+		fmt.Printf("%d log files matched no known layout\n", len(logReport.UnmappedFiles))
+		fmt.Printf("%d logs for pods which were not gathered\n", len(logReport.LogsWithoutPod))
+		fmt.Printf("%d logs for containers not in the pod spec\n", len(logReport.LogsWithoutContainer))
+		fmt.Printf("%d containers without logs\n", len(logReport.ContainersWithoutLogs))
+		fmt.Printf("snapshot key %s\n", hydrator.InputKey())
+		return nil
+	default:
+		return fmt.Errorf("unsupported output format: %s", *output)
+	}
+}
@@ -1,75 +1,162 @@
 package main
 
 import (
-	"context"
 	"flag"
+	"fmt"
 	"os"
-
-	"github.com/openshift-splat-team/must-hydrate/pkg/controller"
-	"github.com/openshift-splat-team/must-hydrate/pkg/server"
-	oainstall "github.com/openshift/api"
-
-	"sigs.k8s.io/controller-runtime/pkg/builder"
-	"sigs.k8s.io/controller-runtime/pkg/client/config"
+	"path/filepath"
+	"strings"
 
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
-	"sigs.k8s.io/controller-runtime/pkg/manager"
-	"sigs.k8s.io/controller-runtime/pkg/manager/signals"
 )
 
-func main() {
-
-	// Define the flag with a default value
-	dataDir := flag.String("data-dir", "/data", "Path to the must-gather directory")
-	logDisable := flag.Bool("disable-logs", false, "When true, node resources are not transformed to support log retrieval")
+// command is a verb of the must_hydrate CLI.
+type command struct {
+	name        string
+	description string
+	run         func(args []string) error
+}
 
-	// Parse command-line arguments
-	flag.Parse()
+var commands = []command{
+	{
+		name:        "serve",
+		description: "Hydrate a must-gather in to a control plane and serve it (default)",
+		run:         runServe,
+	},
+	{
+		name:        "load",
+		description: "Load a must-gather without starting a control plane and summarise what would be hydrated",
+		run:         runLoad,
+	},
+	{
+		name:        "status",
+		description: "Query the hydration progress of a running must-hydrate",
+		run:         runStatus,
+	},
+	{
+		name:        "report",
+		description: "Summarise the health of the gathered cluster",
+		run:         runReport,
+	},
+	{
+		name:        "export",
+		description: "Dump the objects of a must-gather as they would be hydrated",
+		run:         runExport,
+	},
+	{
+		name:        "search",
+		description: "Search the container logs of a must-gather",
+		run:         runSearch,
+	},
+	{
+		name:        "diff",
+		description: "Compare the objects of two must-gathers",
+		run:         runDiff,
+	},
+	{
+		name:        "scrub",
+		description: "Write a copy of a must-gather with identifying values replaced by stable pseudonyms",
+		run:         runScrub,
+	},
+	{
+		name:        "audit",
+		description: "Query the audit log of a hydrated control plane by user, verb, resource and time",
+		run:         runAudit,
+	},
+	{
+		name:        "snapshot",
+		description: "List, remove or prune the snapshots of hydrated must-gathers",
+		run:         runSnapshot,
+	},
+}
 
-	logf.SetLogger(zap.New())
+// sharedOptions are the flags common to all commands.
+type sharedOptions struct {
+	dataDir string
+}
 
-	log := logf.Log.WithName("main")
+// newFlagSet returns the flag set for a command with the shared flags registered.
+func newFlagSet(name string, usage string) (*flag.FlagSet, *sharedOptions) {
+	options := &sharedOptions{}
+	flags := newCommandFlagSet(name, usage)
+	flags.StringVar(&options.dataDir, "data-dir", "/data", "Path to the must-gather directory")
+	return flags, options
+}
 
-	hydrator := &controller.HydratorReconciler{
-		RootPath:    *dataDir,
-		LogDisabled: *logDisable,
-	}
-	if err := hydrator.Initialize(context.TODO()); err != nil {
-		log.Error(err, "could not initialize hydrator")
-		os.Exit(1)
+// newCommandFlagSet returns the flag set for a command which does not read the must-gather in
+// --data-dir, without the shared flags.
+func newCommandFlagSet(name string, usage string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s %s %s\n", os.Args[0], name, usage)
+		flags.PrintDefaults()
 	}
+	return flags
+}
 
-	kubelet := server.KubeletInterfaceServer{
-		RootPath: *dataDir,
-		Hydrator: hydrator,
+// defaultStateDir returns $XDG_STATE_HOME/must-hydrate, falling back to ~/.local/state/must-hydrate.
+func defaultStateDir() (string, error) {
+	stateHome := os.Getenv("XDG_STATE_HOME")
+	if len(stateHome) == 0 {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("unable to find the state directory. %v", err)
+		}
+		stateHome = filepath.Join(home, ".local", "state")
 	}
+	return filepath.Join(stateHome, "must-hydrate"), nil
+}
+
+// stringSliceFlag is a flag which may be repeated or given a comma separated list of values.
+type stringSliceFlag []string
 
-	if err := kubelet.Initialize(); err != nil {
-		log.Error(err, "could not initialize kubelet server")
-		os.Exit(1)
+func (s *stringSliceFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringSliceFlag) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); len(v) > 0 {
+			*s = append(*s, v)
+		}
 	}
-	kubelet.Serve()
+	return nil
+}
 
-	mgr, err := manager.New(config.GetConfigOrDie(), manager.Options{})
-	if err != nil {
-		log.Error(err, "could not create manager")
-		os.Exit(1)
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s <command> [flags]\n\nCommands:\n", os.Args[0])
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", c.name, c.description)
 	}
+	fmt.Fprintf(os.Stderr, "\nRun '%s <command> -h' for the flags of a command.\n", os.Args[0])
+}
 
-	builder.ControllerManagedBy(mgr)
-	if err != nil {
-		log.Error(err, "could not create controller")
-		os.Exit(1)
+func main() {
+	logf.SetLogger(zap.New())
+
+	name := "serve"
+	args := os.Args[1:]
+	// flags without a command are passed to serve to remain compatible with earlier releases
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name = args[0]
+		args = args[1:]
 	}
 
-	hydrator.Client = mgr.GetClient()
-	parentScheme := mgr.GetScheme()
-	_ = oainstall.Install(parentScheme)
-	_ = oainstall.InstallKube(parentScheme)
+	for _, c := range commands {
+		if c.name != name {
+			continue
+		}
+		if err := c.run(args); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+			os.Exit(1)
+		}
+		return
+	}
 
-	if err := mgr.Start(signals.SetupSignalHandler()); err != nil {
-		log.Error(err, "could not start manager")
-		os.Exit(1)
+	if name != "help" {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
 	}
+	usage()
+	os.Exit(2)
 }
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/openshift-splat-team/must-hydrate/pkg/controller"
+	"github.com/openshift-splat-team/must-hydrate/pkg/logs"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var (
+	clusterVersionGvk  = schema.GroupVersionKind{Group: "config.openshift.io", Version: "v1", Kind: "ClusterVersion"}
+	clusterOperatorGvk = schema.GroupVersionKind{Group: "config.openshift.io", Version: "v1", Kind: "ClusterOperator"}
+	nodeGvk            = schema.GroupVersionKind{Group: "", Version: "v1", Kind: "Node"}
+	podGvk             = schema.GroupVersionKind{Group: "", Version: "v1", Kind: "Pod"}
+)
+
+// unhealthy is an object which is not in its expected state.
+type unhealthy struct {
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	Reason    string `json:"reason"`
+}
+
+// clusterReport summarises the health of the gathered cluster.
+type clusterReport struct {
+	Version            string      `json:"version,omitempty"`
+	ClusterVersion     []unhealthy `json:"clusterVersion,omitempty"`
+	ClusterOperators   int         `json:"clusterOperators"`
+	UnhealthyOperators []unhealthy `json:"unhealthyOperators,omitempty"`
+	Nodes              int         `json:"nodes"`
+	UnhealthyNodes     []unhealthy `json:"unhealthyNodes,omitempty"`
+	Pods               int         `json:"pods"`
+	UnhealthyPods      []unhealthy `json:"unhealthyPods,omitempty"`
+	Logs               logs.Report `json:"logs"`
+}
+
+// conditionStatus returns the status and message of a condition of the object.
+func conditionStatus(obj *unstructured.Unstructured, conditionType string) (string, string) {
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, ok := c.(map[string]any)
+		if !ok || condition["type"] != conditionType {
+			continue
+		}
+		status, _ := condition["status"].(string)
+		message, _ := condition["message"].(string)
+		return status, message
+	}
+	return "Unknown", ""
+}
+
+// expectConditions records the object as unhealthy if any of its conditions are not in the expected state.
+func expectConditions(obj *unstructured.Unstructured, expected map[string]string) []unhealthy {
+	var problems []unhealthy
+	for _, conditionType := range []string{"Available", "Ready", "Degraded", "Failing", "Progressing"} {
+		expectedStatus, exists := expected[conditionType]
+		if !exists {
+			continue
+		}
+		status, message := conditionStatus(obj, conditionType)
+		if status == expectedStatus {
+			continue
+		}
+		reason := fmt.Sprintf("%s=%s", conditionType, status)
+		if len(message) > 0 {
+			reason = fmt.Sprintf("%s: %s", reason, message)
+		}
+		problems = append(problems, unhealthy{
+			Namespace: obj.GetNamespace(),
+			Name:      obj.GetName(),
+			Reason:    reason,
+		})
+	}
+	return problems
+}
+
+func buildClusterReport(hydrator *controller.HydratorReconciler) clusterReport {
+	report := clusterReport{
+		Logs: hydrator.LogReport(),
+	}
+
+	for _, clusterVersion := range hydrator.Resources(clusterVersionGvk) {
+		report.Version, _, _ = unstructured.NestedString(clusterVersion.Object, "status", "desired", "version")
+		report.ClusterVersion = append(report.ClusterVersion, expectConditions(clusterVersion, map[string]string{
+			"Available":   "True",
+			"Failing":     "False",
+			"Progressing": "False",
+		})...)
+	}
+
+	operators := hydrator.Resources(clusterOperatorGvk)
+	report.ClusterOperators = len(operators)
+	for _, operator := range operators {
+		report.UnhealthyOperators = append(report.UnhealthyOperators, expectConditions(operator, map[string]string{
+			"Available":   "True",
+			"Degraded":    "False",
+			"Progressing": "False",
+		})...)
+	}
+
+	nodes := hydrator.Resources(nodeGvk)
+	report.Nodes = len(nodes)
+	for _, node := range nodes {
+		report.UnhealthyNodes = append(report.UnhealthyNodes, expectConditions(node, map[string]string{
+			"Ready": "True",
+		})...)
+		if unschedulable, _, _ := unstructured.NestedBool(node.Object, "spec", "unschedulable"); unschedulable {
+			report.UnhealthyNodes = append(report.UnhealthyNodes, unhealthy{Name: node.GetName(), Reason: "SchedulingDisabled"})
+		}
+	}
+
+	pods := hydrator.Resources(podGvk)
+	report.Pods = len(pods)
+	for _, pod := range pods {
+		phase, _, _ := unstructured.NestedString(pod.Object, "status", "phase")
+		if phase != "Running" && phase != "Succeeded" {
+			report.UnhealthyPods = append(report.UnhealthyPods, unhealthy{Namespace: pod.GetNamespace(), Name: pod.GetName(), Reason: "phase " + phase})
+			continue
+		}
+		if phase == "Running" {
+			if status, _ := conditionStatus(pod, "Ready"); status != "True" {
+				report.UnhealthyPods = append(report.UnhealthyPods, unhealthy{Namespace: pod.GetNamespace(), Name: pod.GetName(), Reason: "not ready"})
+			}
+		}
+	}
+
+	return report
+}
+
+func printUnhealthy(title string, total int, problems []unhealthy) {
+	fmt.Printf("%s: %d, %d unhealthy\n", title, total, len(problems))
+	for _, problem := range problems {
+		name := problem.Name
+		if len(problem.Namespace) > 0 {
+			name = problem.Namespace + "/" + name
+		}
+		fmt.Printf("  %s: %s\n", name, problem.Reason)
+	}
+}
+
+// runReport summarises the health of the gathered cluster from the must-gather without starting
+// a control plane.
+func runReport(args []string) error {
+	flags, options := newFlagSet("report", "[flags]")
+	output := flags.String("output", "text", "Output format. One of text or json")
+	_ = flags.Parse(args)
+
+	hydrator := &controller.HydratorReconciler{
+		RootPath: options.dataDir,
+	}
+	if err := hydrator.Load(); err != nil {
+		return err
+	}
+	report := buildClusterReport(hydrator)
+
+	switch *output {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	case "text":
+		if len(report.Version) > 0 {
+			fmt.Printf("Version: %s\n", report.Version)
+		}
+		printUnhealthy("ClusterVersion", len(hydrator.Resources(clusterVersionGvk)), report.ClusterVersion)
+		printUnhealthy("ClusterOperators", report.ClusterOperators, report.UnhealthyOperators)
+		printUnhealthy("Nodes", report.Nodes, report.UnhealthyNodes)
+		printUnhealthy("Pods", report.Pods, report.UnhealthyPods)
+		fmt.Printf("Logs: %d unmapped files, %d without a pod, %d without a container, %d containers without logs\n",
+			len(report.Logs.UnmappedFiles), len(report.Logs.LogsWithoutPod), len(report.Logs.LogsWithoutContainer), len(report.Logs.ContainersWithoutLogs))
+		return nil
+	default:
+		return fmt.Errorf("unsupported output format: %s", *output)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/openshift-splat-team/must-hydrate/pkg/scrub"
+)
+
+// runScrub writes a copy of the must-gather with hostnames, IP addresses, domains, cluster IDs,
+// vSphere names, usernames and certificate subjects replaced by stable pseudonyms, along with
+// a mapping of the pseudonyms which must be kept private.
+func runScrub(args []string) error {
+	flags, options := newFlagSet("scrub", "[flags] --output <dir>")
+	output := flags.String("output", "", "Directory the scrubbed must-gather is written to. Must not exist or be empty")
+	mappingPath := flags.String("mapping", "", "File the mapping of values to pseudonyms is written to. Defaults to <output>.mapping.json. Keep it private")
+	keyFile := flags.String("key-file", "", "File holding the hex encoded key pseudonyms are derived from. Scrubbing several must-gathers with one key gives them the same pseudonyms. The file is created with a new key if it does not exist")
+	_ = flags.Parse(args)
+
+	if len(*output) == 0 {
+		return errors.New("--output is required")
+	}
+	if entries, err := os.ReadDir(*output); err == nil && len(entries) > 0 {
+		return fmt.Errorf("%s is not empty", *output)
+	}
+	if len(*mappingPath) == 0 {
+		*mappingPath = strings.TrimSuffix(filepath.Clean(*output), string(filepath.Separator)) + ".mapping.json"
+	}
+
+	key, err := readKey(*keyFile)
+	if err != nil {
+		return err
+	}
+	scrubber, err := scrub.New(key)
+	if err != nil {
+		return err
+	}
+	if len(*keyFile) > 0 && len(key) == 0 {
+		if err := os.WriteFile(*keyFile, []byte(scrubber.Mapping().Key+"\n"), 0600); err != nil {
+			return fmt.Errorf("unable to write the key to %s. %v", *keyFile, err)
+		}
+	}
+
+	if err := scrubber.DiscoverTree(options.dataDir); err != nil {
+		return err
+	}
+	report, err := scrubber.WriteTree(options.dataDir, *output)
+	if err != nil {
+		return err
+	}
+
+	mapping, err := json.MarshalIndent(scrubber.Mapping(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to marshal the mapping. %v", err)
+	}
+	if err := os.WriteFile(*mappingPath, mapping, 0600); err != nil {
+		return fmt.Errorf("unable to write the mapping to %s. %v", *mappingPath, err)
+	}
+
+	for _, skipped := range report.Skipped {
+		fmt.Printf("skipped %s\n", skipped)
+	}
+	fmt.Printf("%d files scrubbed to %s, %d skipped\n", report.Files, *output, len(report.Skipped))
+	fmt.Printf("mapping written to %s. Do not share it\n", *mappingPath)
+	return nil
+}
+
+// readKey returns the key held by the file, or nil if no file is given or it does not exist.
+func readKey(path string) ([]byte, error) {
+	if len(path) == 0 {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the key from %s. %v", path, err)
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) == 0 {
+		return nil, fmt.Errorf("%s does not hold a hex encoded key", path)
+	}
+	return key, nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/openshift-splat-team/must-hydrate/pkg/controller"
+	"github.com/openshift-splat-team/must-hydrate/pkg/logs"
+)
+
+// runSearch searches the container logs of a must-gather without starting a control plane.
+func runSearch(args []string) error {
+	flags, options := newFlagSet("search", "[flags] PATTERN")
+	namespace := flags.String("namespace", "", "Only search logs of pods in matching namespaces. Glob patterns are supported")
+	pod := flags.String("pod", "", "Only search logs of matching pods. Glob patterns are supported")
+	container := flags.String("container", "", "Only search logs of matching containers. Glob patterns are supported")
+	offset := flags.Int("offset", 0, "Number of matches to skip")
+	limit := flags.Int("limit", logs.DefaultSearchLimit, "Maximum number of matches to return")
+	output := flags.String("output", "text", "Output format. One of text or json")
+	_ = flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return fmt.Errorf("a single search pattern must be provided")
+	}
+
+	hydrator := &controller.HydratorReconciler{
+		RootPath: options.dataDir,
+	}
+	if err := hydrator.LoadLogs(); err != nil {
+		return fmt.Errorf("unable to load logs. %v", err)
+	}
+
+	result, err := hydrator.LogIndex().Search(context.TODO(), logs.Query{
+		Pattern:   flags.Arg(0),
+		Namespace: *namespace,
+		Pod:       *pod,
+		Container: *container,
+		Offset:    *offset,
+		Limit:     *limit,
+	})
+	if err != nil {
+		return err
+	}
+
+	switch *output {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(result)
+	case "text":
+		for _, match := range result.Matches {
+			container := match.Container
+			if match.Previous {
+				container += "[previous]"
+			}
+			fmt.Printf("%s/%s/%s:%d: %s\n", match.Namespace, match.Pod, container, match.Line, match.Text)
+		}
+		if result.NextOffset > 0 {
+			fmt.Fprintf(os.Stderr, "more matches available with --offset=%d\n", result.NextOffset)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported output format: %s", *output)
+	}
+}
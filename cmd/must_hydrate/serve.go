@@ -0,0 +1,326 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/openshift-splat-team/must-hydrate/pkg/changes"
+	"github.com/openshift-splat-team/must-hydrate/pkg/controller"
+	"github.com/openshift-splat-team/must-hydrate/pkg/hydrate"
+	"github.com/openshift-splat-team/must-hydrate/pkg/server"
+	"github.com/openshift-splat-team/must-hydrate/pkg/snapshot"
+	oainstall "github.com/openshift/api"
+
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/manager/signals"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+)
+
+// shutdownTimeout bounds how long in-flight kubelet requests are given to complete on shutdown.
+const shutdownTimeout = 10 * time.Second
+
+// instance is a must-gather hydrated in to its own control plane with its own kubelet stand-in.
+type instance struct {
+	hydrator *controller.HydratorReconciler
+	kubelet  *server.KubeletInterfaceServer
+	// kubeletErrs receives the error of a kubelet server which stops unexpectedly.
+	kubeletErrs <-chan error
+	// changesOut is the file the report of the ChangeRecorder of the hydrator is written to on shutdown.
+	changesOut string
+	// perRunStateDir is true when the state directory of the hydrator is shared by every run of
+	// the context, so that start creates a directory in it for this run alone.
+	perRunStateDir bool
+	// runStateDir is the directory created by start for this run, removed on shutdown.
+	runStateDir string
+}
+
+// runServe hydrates each must-gather in to its own control plane, serves container logs from
+// their kubelet stand-ins and runs until it is signalled to stop.
+func runServe(args []string) error {
+	flags, options := newFlagSet("serve", "[flags] [must-gather...]")
+	followSpeed := flags.Float64("follow-speed", 1, "Speed multiplier used to replay logs for follow requests (oc logs -f)")
+	logDisable := flags.Bool("disable-logs", false, "When true, kubelet connections are not routed to the kubelet stand-in to support log retrieval")
+	kubeletPort := flags.Int("kubelet-port", 10250, "Port of the kubelet stand-in. Each additional must-gather uses the next port")
+	kubeletBindAddress := flags.String("kubelet-bind-address", "127.0.0.1", "Address the kubelet stand-in listens on. It serves the must-gather without authentication, so only set 0.0.0.0 on a trusted network")
+	bindAddress := flags.String("apiserver-bind-address", "", "Address the API server listens on, such as 0.0.0.0 to publish a container port. Defaults to 127.0.0.1")
+	port := flags.Int("apiserver-port", 0, "Secure port of the API server. Each additional must-gather uses the next port. A free port is chosen if unset")
+	kubeconfigServer := flags.String("kubeconfig-server", "", "API server URL written to the kubeconfig, such as https://myhost:6443. Defaults to the address the API server listens on")
+	kubeconfigOut := flags.String("kubeconfig-out", "", "Path the kubeconfig is written to. Defaults to envtest.kubeconfig in the state directory")
+	mergeKubeconfig := flags.String("merge-kubeconfig", "", "Existing kubeconfig, such as ~/.kube/config, to add a context for each hydrated cluster to. The contexts are removed on shutdown")
+	stateDir := flags.String("state-dir", "", "Directory generated files, such as the kubeconfig and certificates, are written to. Defaults to a directory named after the context in $XDG_STATE_HOME/must-hydrate")
+	writable := flags.Bool("writable", false, "When true, the kubeconfig can create, update and delete resources, such as when developing tests. By default it can only get, list and watch")
+	snapshotDir := flags.String("snapshot-dir", "", "Directory snapshots are kept in. Defaults to $XDG_CACHE_HOME/must-hydrate/snapshots")
+	noSnapshot := flags.Bool("no-snapshot", false, "When true, the control plane is neither restored from nor saved to a snapshot")
+	refreshSnapshot := flags.Bool("refresh-snapshot", false, "Hydrate from scratch, replacing any existing snapshot of the must-gather")
+	snapshotKey := flags.String("snapshot", "", "Key of a snapshot to restore instead of the one matching the must-gather")
+	deterministic := flags.Bool("deterministic", false, "When true, the gathered UID and creation timestamp of each resource are recorded in annotations and resources are applied in a stable order, so that runs over the same must-gather can be compared")
+	controllerManager := flags.String("kube-controller-manager", "", "Path of the kube-controller-manager binary which runs --controllers. Defaults to the one next to the envtest binaries or on the PATH")
+	var controllers stringSliceFlag
+	flags.Var(&controllers, "controllers", "kube-controller-manager controllers to run once hydration converges, such as namespace,serviceaccount,serviceaccount-token,root-ca-cert-publisher, so that projects can be created with a --writable kubeconfig. May be repeated")
+	auditLog := flags.String("audit-log", "", "File the API server writes its audit log to, as JSON. Query it with must_hydrate audit")
+	auditPolicy := flags.String("audit-policy", "", "Audit policy of the API server. By default writes are audited with their request and response, and other requests with their metadata")
+	changesOut := flags.String("changes-out", "", "File a report of every create, update, patch and delete made once hydration converges, and who made it, is written to on shutdown. Written as JSON if the file ends with .json")
+	var controllerFlags controllerFlags
+	flags.Var(&controllerFlags.plugins, "controller-plugin", "Go plugin whose init function registers controllers with hydrate.RegisterController. They run in-process once hydration converges. May be repeated")
+	flags.StringVar(&controllerFlags.sidecar, "sidecar", "", "Command, such as an operator binary and its arguments, run once hydration converges with KUBECONFIG set to a kubeconfig for --controller-user")
+	flags.StringVar(&controllerFlags.user, "controller-user", hydrate.DefaultControllerUser, "User, and field manager, the controllers of --controller-plugin and --sidecar run as")
+	flags.StringVar(&controllerFlags.rbac, "controller-rbac", "", "File holding a ClusterRole or Role whose rules are granted to --controller-user. Defaults to every verb on every resource")
+	var overlays stringSliceFlag
+	flags.Var(&overlays, "overlay", "Directory of patches, deletions and objects applied on top of the must-gather. May be repeated")
+	var sans stringSliceFlag
+	flags.Var(&sans, "apiserver-san", "Additional DNS name or IP address for the API server certificate. May be repeated")
+	_ = flags.Parse(args)
+
+	dataDirs := flags.Args()
+	if len(dataDirs) == 0 {
+		dataDirs = []string{options.dataDir}
+	}
+	if len(dataDirs) > 1 && (len(*kubeconfigOut) > 0 || len(*kubeconfigServer) > 0 || len(*snapshotKey) > 0 || len(*changesOut) > 0 || len(*auditLog) > 0) {
+		return fmt.Errorf("--kubeconfig-out, --kubeconfig-server, --snapshot, --changes-out and --audit-log can only be used with a single must-gather")
+	}
+
+	var controllerOptions hydrate.ControllerOptions
+	if controllerFlags.enabled() {
+		var err error
+		if controllerOptions, err = controllerFlags.load(); err != nil {
+			return err
+		}
+	}
+
+	// the default state directory is shared by every run, so each context gets a directory of its
+	// own, with a directory in it for each run
+	perContextStateDir := len(dataDirs) > 1
+	if len(*stateDir) == 0 {
+		defaultDir, err := defaultStateDir()
+		if err != nil {
+			return err
+		}
+		*stateDir = defaultDir
+		perContextStateDir = true
+	}
+
+	var store *snapshot.Store
+	if !*noSnapshot {
+		var err error
+		if store, err = newSnapshotStore(*snapshotDir); err != nil {
+			return err
+		}
+	}
+
+	var instances []*instance
+	contextNames := map[string]bool{}
+	for i, dataDir := range dataDirs {
+		hydrator := &controller.HydratorReconciler{
+			RootPath:             dataDir,
+			Logger:               logf.Log.WithValues("dataDir", dataDir),
+			LogDisabled:          *logDisable,
+			APIServerBindAddress: *bindAddress,
+			APIServerSANs:        sans,
+			KubeconfigServer:     *kubeconfigServer,
+			KubeconfigPath:       expandHome(*kubeconfigOut),
+			MergeKubeconfigPath:  expandHome(*mergeKubeconfig),
+			Writable:             *writable,
+			SnapshotStore:        store,
+			Snapshot:             *snapshotKey,
+			RefreshSnapshot:      *refreshSnapshot,
+			Overlays:             overlays,
+			Deterministic:        *deterministic,
+			Controllers:          controllers,
+		}
+		if *port > 0 {
+			hydrator.APIServerPort = *port + i
+		}
+		if len(*controllerManager) > 0 {
+			hydrator.ControllerManagerPath = expandHome(*controllerManager)
+		}
+		if len(*auditLog) > 0 {
+			hydrator.AuditLogPath = expandHome(*auditLog)
+		}
+		if len(*auditPolicy) > 0 {
+			hydrator.AuditPolicyPath = expandHome(*auditPolicy)
+		}
+		if len(*changesOut) > 0 {
+			recorder, err := changes.NewRecorder()
+			if err != nil {
+				return err
+			}
+			defer recorder.Close()
+			hydrator.ChangeRecorder = recorder
+		}
+		if err := hydrator.Load(); err != nil {
+			return fmt.Errorf("could not load %s. %v", dataDir, err)
+		}
+
+		// gathers of the same cluster share a name, so later ones are numbered
+		contextName := hydrator.ClusterName()
+		for n := 2; contextNames[contextName]; n++ {
+			contextName = fmt.Sprintf("%s-%d", hydrator.ClusterName(), n)
+		}
+		contextNames[contextName] = true
+		hydrator.ContextName = contextName
+
+		hydrator.StateDir = expandHome(*stateDir)
+		if perContextStateDir {
+			hydrator.StateDir = filepath.Join(hydrator.StateDir, contextName)
+		}
+
+		instances = append(instances, &instance{
+			hydrator:       hydrator,
+			changesOut:     expandHome(*changesOut),
+			perRunStateDir: perContextStateDir,
+			kubelet: &server.KubeletInterfaceServer{
+				StateDir:    hydrator.StateDir,
+				Address:     net.JoinHostPort(*kubeletBindAddress, strconv.Itoa(*kubeletPort+i)),
+				Hydrator:    hydrator,
+				FollowSpeed: *followSpeed,
+			},
+		})
+	}
+
+	// every control plane is stopped when any one of them fails
+	ctx, cancel := context.WithCancel(signals.SetupSignalHandler())
+	defer cancel()
+	defer shutdown(instances)
+
+	var managers []manager.Manager
+	var runners []func(context.Context) error
+	for _, inst := range instances {
+		mgr, err := inst.start(ctx)
+		if err != nil {
+			return fmt.Errorf("could not start %s. %v", inst.hydrator.RootPath, err)
+		}
+		managers = append(managers, mgr)
+		runners = append(runners, inst.waitForKubelet)
+		if controllerFlags.enabled() {
+			runners = append(runners, controllerFlags.runners(inst.hydrator, controllerOptions)...)
+		}
+	}
+
+	errs := make(chan error, len(managers)+len(runners))
+	for _, mgr := range managers {
+		go func() {
+			err := mgr.Start(ctx)
+			cancel()
+			errs <- err
+		}()
+	}
+	// controllers and sidecars which finish without an error leave the control planes running
+	for _, run := range runners {
+		go func() {
+			err := run(ctx)
+			if err != nil {
+				cancel()
+			}
+			errs <- err
+		}()
+	}
+	var startErrs []error
+	for range len(managers) + len(runners) {
+		if err := <-errs; err != nil {
+			startErrs = append(startErrs, err)
+		}
+	}
+	if err := errors.Join(startErrs...); err != nil {
+		return fmt.Errorf("could not run. %v", err)
+	}
+	return nil
+}
+
+// start starts the control plane and kubelet stand-in of the instance and returns the manager
+// which runs against the control plane.
+func (i *instance) start(ctx context.Context) (manager.Manager, error) {
+	// runs of the same must-gather share a context, and must not remove each other's files
+	if i.perRunStateDir {
+		if err := os.MkdirAll(i.hydrator.StateDir, 0700); err != nil {
+			return nil, fmt.Errorf("could not create state directory. %v", err)
+		}
+		runStateDir, err := os.MkdirTemp(i.hydrator.StateDir, "run-")
+		if err != nil {
+			return nil, fmt.Errorf("could not create state directory. %v", err)
+		}
+		i.runStateDir = runStateDir
+		i.hydrator.StateDir = runStateDir
+		i.kubelet.StateDir = runStateDir
+	}
+
+	if err := i.kubelet.Initialize(); err != nil {
+		return nil, fmt.Errorf("could not initialize kubelet server. %v", err)
+	}
+	i.hydrator.KubeletProxyURL = i.kubelet.ProxyURL()
+
+	if err := i.hydrator.Initialize(ctx); err != nil {
+		return nil, fmt.Errorf("could not initialize hydrator. %v", err)
+	}
+	i.kubeletErrs = i.kubelet.Serve(ctx)
+
+	// the metrics of several managers would conflict, and are of no use for a hydrated cluster
+	mgr, err := manager.New(i.hydrator.RESTConfig(), manager.Options{
+		Metrics: metricsserver.Options{BindAddress: "0"},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not create manager. %v", err)
+	}
+
+	i.hydrator.Client = mgr.GetClient()
+	parentScheme := mgr.GetScheme()
+	_ = oainstall.Install(parentScheme)
+	_ = oainstall.InstallKube(parentScheme)
+	return mgr, nil
+}
+
+// waitForKubelet returns the error of a kubelet server of the instance which stops unexpectedly,
+// or nil once ctx is done.
+func (i *instance) waitForKubelet(ctx context.Context) error {
+	select {
+	case err := <-i.kubeletErrs:
+		return err
+	case <-ctx.Done():
+		return nil
+	}
+}
+
+// shutdown stops each kubelet stand-in before its control plane so that no kubelet requests are
+// in flight while the API server stops. Generated files are removed from the state directory.
+func shutdown(instances []*instance) {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	for _, inst := range instances {
+		if err := inst.kubelet.Shutdown(ctx); err != nil {
+			logf.Log.Error(err, "could not shut down the kubelet server", "dataDir", inst.hydrator.RootPath)
+		}
+		if err := inst.writeChanges(); err != nil {
+			logf.Log.Error(err, "could not write the changes", "dataDir", inst.hydrator.RootPath)
+		}
+		if err := inst.hydrator.Stop(); err != nil {
+			logf.Log.Error(err, "could not stop the control plane", "dataDir", inst.hydrator.RootPath)
+		}
+		if len(inst.runStateDir) > 0 {
+			if err := os.RemoveAll(inst.runStateDir); err != nil {
+				logf.Log.Error(err, "could not remove the state directory", "stateDir", inst.runStateDir)
+			}
+			// the directory of the context is left in place while other runs use it
+			_ = os.Remove(filepath.Dir(inst.runStateDir))
+		}
+	}
+}
+
+// expandHome replaces a leading ~ with the home directory of the current user.
+func expandHome(p string) string {
+	if p != "~" && !strings.HasPrefix(p, "~/") {
+		return p
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return p
+	}
+	return filepath.Join(home, strings.TrimPrefix(p, "~"))
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/openshift-splat-team/must-hydrate/pkg/snapshot"
+)
+
+// runSnapshot lists, removes and prunes the snapshots of hydrated must-gathers.
+func runSnapshot(args []string) error {
+	if len(args) == 0 {
+		return errors.New("a subcommand is required. One of list, remove or prune")
+	}
+	subcommand, args := args[0], args[1:]
+
+	flags := flag.NewFlagSet("snapshot "+subcommand, flag.ExitOnError)
+	snapshotDir := flags.String("snapshot-dir", "", "Directory snapshots are kept in. Defaults to $XDG_CACHE_HOME/must-hydrate/snapshots")
+
+	switch subcommand {
+	case "list":
+		output := flags.String("output", "text", "Output format. One of text or json")
+		setSnapshotUsage(flags, "list [flags]")
+		_ = flags.Parse(args)
+
+		store, err := newSnapshotStore(*snapshotDir)
+		if err != nil {
+			return err
+		}
+		snapshots, err := store.List()
+		if err != nil {
+			return err
+		}
+		return printSnapshots(snapshots, *output)
+	case "remove":
+		setSnapshotUsage(flags, "remove [flags] <key>...")
+		_ = flags.Parse(args)
+		if flags.NArg() == 0 {
+			return errors.New("at least one snapshot key is required")
+		}
+
+		store, err := newSnapshotStore(*snapshotDir)
+		if err != nil {
+			return err
+		}
+		for _, key := range flags.Args() {
+			if _, exists, err := store.Get(key); err != nil {
+				return err
+			} else if !exists {
+				return fmt.Errorf("snapshot %s does not exist", key)
+			}
+			if err := store.Remove(key); err != nil {
+				return err
+			}
+			fmt.Printf("removed %s\n", key)
+		}
+		return nil
+	case "prune":
+		olderThan := flags.Duration("older-than", 30*24*time.Hour, "Remove snapshots which have not been used for this long")
+		setSnapshotUsage(flags, "prune [flags]")
+		_ = flags.Parse(args)
+
+		store, err := newSnapshotStore(*snapshotDir)
+		if err != nil {
+			return err
+		}
+		pruned, err := store.Prune(time.Now().Add(-*olderThan))
+		for _, key := range pruned {
+			fmt.Printf("removed %s\n", key)
+		}
+		return err
+	default:
+		return fmt.Errorf("unknown subcommand %q. One of list, remove or prune", subcommand)
+	}
+}
+
+func setSnapshotUsage(flags *flag.FlagSet, usage string) {
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s snapshot %s\n", os.Args[0], usage)
+		flags.PrintDefaults()
+	}
+}
+
+// newSnapshotStore returns the snapshot store in dir, or in the default directory if dir is empty.
+func newSnapshotStore(dir string) (*snapshot.Store, error) {
+	if len(dir) == 0 {
+		defaultDir, err := snapshot.DefaultDir()
+		if err != nil {
+			return nil, err
+		}
+		dir = defaultDir
+	}
+	return &snapshot.Store{Dir: expandHome(dir)}, nil
+}
+
+func printSnapshots(snapshots []snapshot.Info, output string) error {
+	switch output {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if snapshots == nil {
+			snapshots = []snapshot.Info{}
+		}
+		return encoder.Encode(snapshots)
+	case "text":
+		fmt.Printf("%-32s  %-24s  %9s  %8s  %-20s  %s\n", "KEY", "CLUSTER", "RESOURCES", "SIZE", "LAST USED", "MUST-GATHER")
+		for _, s := range snapshots {
+			lastUsed := s.Created
+			if s.LastUsed != nil {
+				lastUsed = *s.LastUsed
+			}
+			fmt.Printf("%-32s  %-24s  %9d  %7dM  %-20s  %s\n", s.Key, s.ClusterName, s.Resources, s.Size>>20, lastUsed.Format("2006-01-02T15:04:05Z07:00"), s.RootPath)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported output format: %s", output)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/openshift-splat-team/must-hydrate/pkg/server"
+)
+
+// runStatus queries the hydration progress of a running must-hydrate.
+func runStatus(args []string) error {
+	flags := newCommandFlagSet("status", "[flags]")
+	address := flags.String("kubelet-address", "127.0.0.1:10250", "Address of the kubelet stand-in of the running must-hydrate")
+	stateDir := flags.String("state-dir", "", "State directory of the running must-hydrate, which holds the CA of the kubelet stand-in. Defaults to $XDG_STATE_HOME/must-hydrate")
+	contextName := flags.String("context", "", "Context of the must-gather queried, whose state directory is in --state-dir. Required when several must-gathers are served")
+	output := flags.String("output", "text", "Output format. One of text or json")
+	_ = flags.Parse(args)
+
+	if len(*stateDir) == 0 {
+		defaultDir, err := defaultStateDir()
+		if err != nil {
+			return err
+		}
+		*stateDir = defaultDir
+	}
+
+	caPath, err := kubeletCAPath(expandHome(*stateDir), *contextName)
+	if err != nil {
+		return err
+	}
+	status, err := server.FetchStatus(context.TODO(), *address, caPath)
+	if err != nil {
+		return err
+	}
+
+	switch *output {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(status)
+	case "text":
+		fmt.Printf("must-gather:  %s\n", status.RootPath)
+		fmt.Printf("converged:    %t\n", status.Converged)
+		fmt.Printf("applied:      %d/%d\n", status.Loaded-status.Remaining, status.Loaded)
+		fmt.Printf("passes:       %d\n", status.Passes)
+		if status.LastPass != nil {
+			fmt.Printf("last pass:    %s\n", status.LastPass.Format("2006-01-02T15:04:05Z07:00"))
+		}
+		fmt.Printf("logs:         %d\n", status.Logs)
+		if len(status.Snapshot) > 0 {
+			fmt.Printf("snapshot:     %s\n", status.Snapshot)
+		}
+
+		var keys []string
+		for key := range status.RemainingByKind {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		if len(keys) > 0 {
+			fmt.Println("\nremaining:")
+		}
+		for _, key := range keys {
+			fmt.Printf("  %-78s %d\n", key, status.RemainingByKind[key])
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported output format: %s", *output)
+	}
+}
+
+// kubeletCAPath returns the CA of the kubelet stand-in serving the context, which is in the
+// directory of a run in the state directory of the context. Without a context, the state directory
+// itself, or the only run in it, is used. A context may name a run, such as mycluster/run-1234.
+func kubeletCAPath(stateDir string, contextName string) (string, error) {
+	dir := filepath.Join(stateDir, contextName)
+	caPath := filepath.Join(dir, "ca.pem")
+	if _, err := os.Stat(caPath); err == nil {
+		return caPath, nil
+	}
+
+	var caPaths []string
+	for _, pattern := range []string{filepath.Join(dir, "*", "ca.pem"), filepath.Join(dir, "*", "*", "ca.pem")} {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return "", fmt.Errorf("unable to find the kubelet CA. %v", err)
+		}
+		caPaths = append(caPaths, matches...)
+	}
+	switch len(caPaths) {
+	case 0:
+		return "", fmt.Errorf("no kubelet CA found in %s, is must-hydrate running?", dir)
+	case 1:
+		return caPaths[0], nil
+	}
+	var runs []string
+	for _, p := range caPaths {
+		run, _ := filepath.Rel(stateDir, filepath.Dir(p))
+		runs = append(runs, filepath.ToSlash(run))
+	}
+	return "", fmt.Errorf("several must-gathers are served, select one with --context: %s", strings.Join(runs, ", "))
+}
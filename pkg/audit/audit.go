@@ -0,0 +1,144 @@
+// Package audit receives the audit events of the hydrated API server.
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/openshift-splat-team/must-hydrate/pkg/controller/util"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+)
+
+// WritesPolicy is an audit policy which records the request and response of every create, update,
+// patch and delete once it has completed, and nothing else.
+const WritesPolicy = `apiVersion: audit.k8s.io/v1
+kind: Policy
+omitStages:
+- RequestReceived
+- ResponseStarted
+rules:
+- level: RequestResponse
+  verbs: ["create", "update", "patch", "delete", "deletecollection"]
+- level: None
+`
+
+// Event is an audit.k8s.io/v1 Event, with the request and response objects left encoded.
+type Event struct {
+	Level                    string            `json:"level"`
+	AuditID                  string            `json:"auditID"`
+	Stage                    string            `json:"stage"`
+	RequestURI               string            `json:"requestURI"`
+	Verb                     string            `json:"verb"`
+	User                     UserInfo          `json:"user"`
+	ImpersonatedUser         *UserInfo         `json:"impersonatedUser,omitempty"`
+	SourceIPs                []string          `json:"sourceIPs,omitempty"`
+	UserAgent                string            `json:"userAgent,omitempty"`
+	ObjectRef                *ObjectReference  `json:"objectRef,omitempty"`
+	ResponseStatus           *metav1.Status    `json:"responseStatus,omitempty"`
+	RequestObject            json.RawMessage   `json:"requestObject,omitempty"`
+	ResponseObject           json.RawMessage   `json:"responseObject,omitempty"`
+	RequestReceivedTimestamp metav1.MicroTime  `json:"requestReceivedTimestamp"`
+	StageTimestamp           metav1.MicroTime  `json:"stageTimestamp"`
+	Annotations              map[string]string `json:"annotations,omitempty"`
+
+	// Raw is the event as it was read by ReadLog.
+	Raw json.RawMessage `json:"-"`
+}
+
+// UserInfo identifies the user of a request.
+type UserInfo struct {
+	Username string              `json:"username,omitempty"`
+	UID      string              `json:"uid,omitempty"`
+	Groups   []string            `json:"groups,omitempty"`
+	Extra    map[string][]string `json:"extra,omitempty"`
+}
+
+// ObjectReference locates the object of a request.
+type ObjectReference struct {
+	Resource        string `json:"resource,omitempty"`
+	Namespace       string `json:"namespace,omitempty"`
+	Name            string `json:"name,omitempty"`
+	UID             string `json:"uid,omitempty"`
+	APIGroup        string `json:"apiGroup,omitempty"`
+	APIVersion      string `json:"apiVersion,omitempty"`
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+	Subresource     string `json:"subresource,omitempty"`
+}
+
+// EventList is the batch of events posted to a webhook.
+type EventList struct {
+	Items []Event `json:"items"`
+}
+
+// Code returns the HTTP status code of the response, or 0 if the request did not complete.
+func (e *Event) Code() int32 {
+	if e.ResponseStatus == nil {
+		return 0
+	}
+	return e.ResponseStatus.Code
+}
+
+// Webhook is an audit webhook backend which listens on the loopback address and passes the events
+// posted by the API server to its handler.
+type Webhook struct {
+	listener net.Listener
+	server   *http.Server
+}
+
+// NewWebhook starts a webhook which passes each batch of events to handler. The API server waits
+// for the handler when the webhook is configured in blocking mode.
+func NewWebhook(handler func(events []Event)) (*Webhook, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("unable to listen for audit events: %v", err)
+	}
+	w := &Webhook{
+		listener: listener,
+		server: &http.Server{
+			Handler: http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				list := &EventList{}
+				if err := json.NewDecoder(req.Body).Decode(list); err != nil {
+					http.Error(rw, err.Error(), http.StatusBadRequest)
+					return
+				}
+				handler(list.Items)
+			}),
+		},
+	}
+	go func() {
+		_ = w.server.Serve(listener)
+	}()
+	return w, nil
+}
+
+// URL returns the URL events are posted to.
+func (w *Webhook) URL() string {
+	return fmt.Sprintf("http://%s/", w.listener.Addr())
+}
+
+// WriteConfig writes the kubeconfig of the webhook, which is passed to the API server with
+// --audit-webhook-config-file.
+func (w *Webhook) WriteConfig(path string) error {
+	return util.WriteKubeconfig(&rest.Config{Host: w.URL()}, "audit-webhook", path)
+}
+
+// Close stops the webhook.
+func (w *Webhook) Close() error {
+	if err := w.server.Close(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// WritePolicy writes the policy to path.
+func WritePolicy(policy string, path string) error {
+	if err := os.WriteFile(path, []byte(policy), 0600); err != nil {
+		return fmt.Errorf("unable to write the audit policy: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"time"
+)
+
+// DefaultPolicy is the audit policy of the audit log when no policy is given. The request and
+// response of every create, update, patch and delete are recorded, and the metadata of every
+// other request.
+const DefaultPolicy = `apiVersion: audit.k8s.io/v1
+kind: Policy
+omitStages:
+- RequestReceived
+- ResponseStarted
+rules:
+- level: RequestResponse
+  verbs: ["create", "update", "patch", "delete", "deletecollection"]
+- level: Metadata
+`
+
+// Query selects the events of an audit log. Empty fields match every event. Users, namespaces,
+// resources and names are glob patterns.
+type Query struct {
+	// Users match the user, or impersonated user, of the request.
+	Users []string
+	// Verbs match the verb of the request, such as get, list, watch, create or delete.
+	Verbs []string
+	// Resources match the resource, such as pods or deployments.apps, optionally followed by
+	// /subresource, such as pods/log.
+	Resources []string
+	// Namespace matches the namespace of the object.
+	Namespace string
+	// Name matches the name of the object.
+	Name string
+	// Since excludes events before the time.
+	Since time.Time
+	// Until excludes events after the time.
+	Until time.Time
+}
+
+// Matches returns true if the event is selected by the query.
+func (q *Query) Matches(event *Event) bool {
+	user := event.User.Username
+	if event.ImpersonatedUser != nil {
+		user = event.ImpersonatedUser.Username
+	}
+	if !matchesAny(q.Users, user) || !matchesAny(q.Verbs, event.Verb) {
+		return false
+	}
+
+	var resource, namespace, name string
+	if ref := event.ObjectRef; ref != nil {
+		resource = ref.Resource
+		if len(ref.APIGroup) > 0 {
+			resource += "." + ref.APIGroup
+		}
+		if len(ref.Subresource) > 0 {
+			resource += "/" + ref.Subresource
+		}
+		namespace, name = ref.Namespace, ref.Name
+	}
+	if !matchesAny(q.Resources, resource) || !globMatch(q.Namespace, namespace) || !globMatch(q.Name, name) {
+		return false
+	}
+
+	received := event.RequestReceivedTimestamp.Time
+	if !q.Since.IsZero() && received.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && received.After(q.Until) {
+		return false
+	}
+	return true
+}
+
+// ReadLog reads a JSON audit log, one event per line, and calls handle with each event selected
+// by the query, in the order they were written.
+func ReadLog(r io.Reader, query Query, handle func(event *Event) error) error {
+	scanner := bufio.NewScanner(r)
+	// events with request and response objects can be large
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		event := &Event{}
+		if err := json.Unmarshal(scanner.Bytes(), event); err != nil {
+			return fmt.Errorf("unable to decode the event on line %d: %v", line, err)
+		}
+		if !query.Matches(event) {
+			continue
+		}
+		event.Raw = append(json.RawMessage{}, scanner.Bytes()...)
+		if err := handle(event); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// matchesAny returns true if value matches any of the patterns, or there are no patterns.
+func matchesAny(patterns []string, value string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if globMatch(pattern, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func globMatch(pattern string, value string) bool {
+	if len(pattern) == 0 {
+		return true
+	}
+	matched, err := path.Match(pattern, value)
+	return err == nil && matched
+}
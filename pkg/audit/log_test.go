@@ -0,0 +1,57 @@
+package audit
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const testLog = `{"stage":"ResponseComplete","verb":"get","user":{"username":"system:admin"},"objectRef":{"resource":"pods","namespace":"default","name":"web-0","apiVersion":"v1"},"requestReceivedTimestamp":"2024-05-01T10:00:00.000000Z"}
+{"stage":"ResponseComplete","verb":"update","user":{"username":"system:serviceaccount:operator:controller"},"objectRef":{"resource":"deployments","namespace":"default","name":"web","apiGroup":"apps","apiVersion":"v1"},"requestReceivedTimestamp":"2024-05-01T10:05:00.000000Z"}
+{"stage":"ResponseComplete","verb":"get","user":{"username":"system:admin"},"objectRef":{"resource":"pods","namespace":"default","name":"web-0","apiVersion":"v1","subresource":"log"},"requestReceivedTimestamp":"2024-05-01T10:10:00.000000Z"}
+
+{"stage":"ResponseComplete","verb":"delete","user":{"username":"system:admin"},"impersonatedUser":{"username":"alice"},"objectRef":{"resource":"configmaps","namespace":"kube-system","name":"settings","apiVersion":"v1"},"requestReceivedTimestamp":"2024-05-01T10:15:00.000000Z"}
+`
+
+func TestReadLog(t *testing.T) {
+	at := func(value string) time.Time {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed
+	}
+	for name, test := range map[string]struct {
+		query    Query
+		expected []string
+	}{
+		"all":           {Query{}, []string{"get pods", "update deployments", "get pods/log", "delete configmaps"}},
+		"user glob":     {Query{Users: []string{"system:serviceaccount:operator:*"}}, []string{"update deployments"}},
+		"impersonation": {Query{Users: []string{"alice"}}, []string{"delete configmaps"}},
+		"verbs":         {Query{Verbs: []string{"update", "delete"}}, []string{"update deployments", "delete configmaps"}},
+		"group":         {Query{Resources: []string{"deployments.apps"}}, []string{"update deployments"}},
+		"subresource":   {Query{Resources: []string{"pods/*"}}, []string{"get pods/log"}},
+		"namespace":     {Query{Namespace: "kube-*"}, []string{"delete configmaps"}},
+		"time":          {Query{Since: at("2024-05-01T10:05:00Z"), Until: at("2024-05-01T10:10:00Z")}, []string{"update deployments", "get pods/log"}},
+	} {
+		var matched []string
+		err := ReadLog(strings.NewReader(testLog), test.query, func(event *Event) error {
+			resource := event.ObjectRef.Resource
+			if len(event.ObjectRef.Subresource) > 0 {
+				resource += "/" + event.ObjectRef.Subresource
+			}
+			matched = append(matched, event.Verb+" "+resource)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if strings.Join(matched, ",") != strings.Join(test.expected, ",") {
+			t.Errorf("%s: expected %v, got %v", name, test.expected, matched)
+		}
+	}
+
+	if err := ReadLog(strings.NewReader("not json\n"), Query{}, func(*Event) error { return nil }); err == nil {
+		t.Error("expected an error for a line which is not an event")
+	}
+}
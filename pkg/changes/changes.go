@@ -0,0 +1,385 @@
+// Package changes records the changes made to a hydrated control plane once hydration has
+// converged, and who made them.
+package changes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openshift-splat-team/must-hydrate/pkg/audit"
+	"github.com/openshift-splat-team/must-hydrate/pkg/controller/util"
+	"github.com/openshift-splat-team/must-hydrate/pkg/diff"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+)
+
+// InternalUserAgent is the user agent of the requests must-hydrate itself makes once hydration
+// has converged, such as provisioning the users controllers run as. They are not recorded.
+const InternalUserAgent = "must-hydrate"
+
+// writeVerbs are the verbs of the requests which change objects.
+var writeVerbs = map[string]bool{
+	"create":           true,
+	"update":           true,
+	"patch":            true,
+	"delete":           true,
+	"deletecollection": true,
+}
+
+// Request is a successful request which changed, or may have changed, an object.
+type Request struct {
+	Time        time.Time `json:"time"`
+	Verb        string    `json:"verb"`
+	User        string    `json:"user"`
+	Groups      []string  `json:"groups,omitempty"`
+	UserAgent   string    `json:"userAgent,omitempty"`
+	Group       string    `json:"group,omitempty"`
+	Version     string    `json:"version,omitempty"`
+	Kind        string    `json:"kind,omitempty"`
+	Resource    string    `json:"resource"`
+	Subresource string    `json:"subresource,omitempty"`
+	Namespace   string    `json:"namespace,omitempty"`
+	Name        string    `json:"name,omitempty"`
+	Code        int32     `json:"code"`
+}
+
+// objectKey identifies an object by its group and resource, which are the same for all versions.
+type objectKey struct {
+	Group     string
+	Resource  string
+	Namespace string
+	Name      string
+}
+
+// listedObject is an object along with the resource it was listed from.
+type listedObject struct {
+	objectKey
+	object *unstructured.Unstructured
+}
+
+// Recorder records the write requests made to the API server through an audit webhook once a
+// baseline of every object has been taken.
+type Recorder struct {
+	webhook *audit.Webhook
+
+	lock     sync.Mutex
+	list     func(ctx context.Context) ([]listedObject, error)
+	baseline []listedObject
+	requests []Request
+}
+
+// NewRecorder starts the audit webhook of a recorder. Requests are not recorded until Baseline is
+// called.
+func NewRecorder() (*Recorder, error) {
+	r := &Recorder{}
+	webhook, err := audit.NewWebhook(r.record)
+	if err != nil {
+		return nil, err
+	}
+	r.webhook = webhook
+	return r, nil
+}
+
+// WriteWebhookConfig writes the configuration of the audit webhook of the recorder to dir and
+// returns its path, which is passed to the API server with --audit-webhook-config-file. The audit
+// policy of the API server must record writes at the RequestResponse level, as audit.WritesPolicy
+// does, for the kinds and generated names of objects to be known.
+func (r *Recorder) WriteWebhookConfig(dir string) (string, error) {
+	webhookConfigPath := filepath.Join(dir, "changes-audit-webhook.kubeconfig")
+	if err := r.webhook.WriteConfig(webhookConfigPath); err != nil {
+		return "", err
+	}
+	return webhookConfigPath, nil
+}
+
+// Baseline lists every object of the control plane and starts recording requests. Changes are
+// reported against the baseline.
+func (r *Recorder) Baseline(ctx context.Context, cfg *rest.Config) error {
+	list, err := newLister(cfg)
+	if err != nil {
+		return err
+	}
+	return r.takeBaseline(ctx, list)
+}
+
+// takeBaseline lists the baseline with list and starts recording requests.
+func (r *Recorder) takeBaseline(ctx context.Context, list func(ctx context.Context) ([]listedObject, error)) error {
+	baseline, err := list(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to take the baseline: %v", err)
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.list = list
+	r.baseline = baseline
+	r.requests = nil
+	return nil
+}
+
+// Recording returns true once the baseline has been taken.
+func (r *Recorder) Recording() bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.list != nil
+}
+
+// record records the successful write requests of the events.
+func (r *Recorder) record(events []audit.Event) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.list == nil {
+		return
+	}
+	for _, event := range events {
+		request, ok := requestOf(event)
+		if ok {
+			r.requests = append(r.requests, request)
+		}
+	}
+}
+
+// requestOf returns the request of a completed, successful write event.
+func requestOf(event audit.Event) (Request, bool) {
+	if event.Stage != "ResponseComplete" || !writeVerbs[event.Verb] || event.ObjectRef == nil {
+		return Request{}, false
+	}
+	if code := event.Code(); code < 200 || code >= 300 || strings.Contains(event.RequestURI, "dryRun=") {
+		return Request{}, false
+	}
+	if event.UserAgent == InternalUserAgent {
+		return Request{}, false
+	}
+
+	request := Request{
+		Time:        event.StageTimestamp.Time,
+		Verb:        event.Verb,
+		User:        event.User.Username,
+		Groups:      event.User.Groups,
+		UserAgent:   event.UserAgent,
+		Group:       event.ObjectRef.APIGroup,
+		Version:     event.ObjectRef.APIVersion,
+		Resource:    event.ObjectRef.Resource,
+		Subresource: event.ObjectRef.Subresource,
+		Namespace:   event.ObjectRef.Namespace,
+		Name:        event.ObjectRef.Name,
+		Code:        event.Code(),
+	}
+	if event.ImpersonatedUser != nil {
+		request.User = event.ImpersonatedUser.Username
+		request.Groups = event.ImpersonatedUser.Groups
+	}
+	if len(event.ResponseObject) > 0 && request.Verb != "deletecollection" {
+		var response struct {
+			metav1.TypeMeta `json:",inline"`
+			Metadata        metav1.ObjectMeta `json:"metadata"`
+		}
+		if err := json.Unmarshal(event.ResponseObject, &response); err == nil && response.Kind != "Status" {
+			request.Kind = response.Kind
+			// objects created with generateName are only named in the response
+			if len(request.Name) == 0 {
+				request.Name = response.Metadata.Name
+			}
+		}
+	}
+	return request, true
+}
+
+// Requests returns the requests recorded since the baseline was taken, in the order they completed.
+func (r *Recorder) Requests() []Request {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]Request{}, r.requests...)
+}
+
+// Close stops the audit webhook of the recorder.
+func (r *Recorder) Close() error {
+	return r.webhook.Close()
+}
+
+// Report lists every object of the control plane again and reports how each object written since
+// the baseline was taken differs from the baseline, along with the requests which wrote it.
+func (r *Recorder) Report(ctx context.Context) (*Report, error) {
+	r.lock.Lock()
+	list, baseline, requests := r.list, r.baseline, append([]Request{}, r.requests...)
+	r.lock.Unlock()
+	if list == nil {
+		return nil, errors.New("no baseline has been taken")
+	}
+
+	current, err := list(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list the objects to report on: %v", err)
+	}
+	return newReport(baseline, current, requests), nil
+}
+
+// newLister returns a function which lists every object of every resource which can be listed.
+func newLister(cfg *rest.Config) (func(ctx context.Context) ([]listedObject, error), error) {
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create the discovery client: %v", err)
+	}
+	dynamicClient, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create the dynamic client: %v", err)
+	}
+
+	return func(ctx context.Context) ([]listedObject, error) {
+		// groups which fail discovery, such as those of unavailable aggregated APIs, are skipped
+		resourceLists, err := discoveryClient.ServerPreferredResources()
+		if err != nil && len(resourceLists) == 0 {
+			return nil, err
+		}
+
+		var objects []listedObject
+		for _, resourceList := range resourceLists {
+			gv, err := schema.ParseGroupVersion(resourceList.GroupVersion)
+			if err != nil {
+				continue
+			}
+			for _, resource := range resourceList.APIResources {
+				if strings.Contains(resource.Name, "/") || !contains(resource.Verbs, "list") {
+					continue
+				}
+				gvr := gv.WithResource(resource.Name)
+				list, err := dynamicClient.Resource(gvr).List(ctx, metav1.ListOptions{})
+				if err != nil {
+					return nil, fmt.Errorf("unable to list %s: %v", gvr, err)
+				}
+				for i := range list.Items {
+					obj := &list.Items[i]
+					objects = append(objects, listedObject{
+						objectKey: objectKey{
+							Group:     gv.Group,
+							Resource:  resource.Name,
+							Namespace: obj.GetNamespace(),
+							Name:      obj.GetName(),
+						},
+						object: obj,
+					})
+				}
+			}
+		}
+		return objects, nil
+	}, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Unchanged is the type of an object which was written, such as created and then deleted, but
+// which does not differ from the baseline.
+const Unchanged diff.ChangeType = "Unchanged"
+
+// ObjectChange is an object written since the baseline, how it differs from the baseline and the
+// requests which wrote it.
+type ObjectChange struct {
+	diff.ObjectChange
+	Requests []Request `json:"requests"`
+}
+
+// Report is the difference between the baseline and the current state of each object written
+// since the baseline was taken.
+type Report struct {
+	Changes []ObjectChange `json:"changes"`
+}
+
+// newReport compares the baseline and current versions of the objects written by the requests.
+func newReport(baseline []listedObject, current []listedObject, requests []Request) *Report {
+	baselineObjects := map[objectKey]*unstructured.Unstructured{}
+	for _, obj := range baseline {
+		baselineObjects[obj.objectKey] = obj.object
+	}
+	currentObjects := map[objectKey]*unstructured.Unstructured{}
+	for _, obj := range current {
+		currentObjects[obj.objectKey] = obj.object
+	}
+
+	written := map[objectKey][]Request{}
+	var order []objectKey
+	touch := func(object objectKey, request Request) {
+		if _, exists := written[object]; !exists {
+			order = append(order, object)
+		}
+		written[object] = append(written[object], request)
+	}
+	for _, request := range requests {
+		if request.Verb != "deletecollection" {
+			touch(objectKey{Group: request.Group, Resource: request.Resource, Namespace: request.Namespace, Name: request.Name}, request)
+			continue
+		}
+		// a collection is deleted without naming its objects, so it is attributed every object of
+		// the collection which has since been removed
+		for _, obj := range baseline {
+			if obj.Group == request.Group && obj.Resource == request.Resource && (len(request.Namespace) == 0 || obj.Namespace == request.Namespace) {
+				if _, exists := currentObjects[obj.objectKey]; !exists {
+					touch(obj.objectKey, request)
+				}
+			}
+		}
+	}
+
+	report := &Report{Changes: []ObjectChange{}}
+	for _, object := range order {
+		var from, to []*unstructured.Unstructured
+		if obj, exists := baselineObjects[object]; exists {
+			from = append(from, obj)
+		}
+		if obj, exists := currentObjects[object]; exists {
+			to = append(to, obj)
+		}
+
+		change := ObjectChange{
+			ObjectChange: diff.ObjectChange{
+				Type:      Unchanged,
+				Namespace: object.Namespace,
+				Name:      object.Name,
+			},
+			Requests: written[object],
+		}
+		switch result := diff.Compare(from, to); {
+		case len(result.Changes) > 0:
+			change.ObjectChange = result.Changes[0]
+		case len(to) > 0:
+			change.GVK = util.GetGvkKey(to[0].GroupVersionKind())
+		default:
+			// the object was created and deleted, so only the requests know its kind
+			for _, request := range change.Requests {
+				if len(request.Kind) > 0 {
+					change.GVK = util.GetGvkKey(schema.GroupVersionKind{Group: request.Group, Version: request.Version, Kind: request.Kind})
+					break
+				}
+			}
+		}
+		report.Changes = append(report.Changes, change)
+	}
+
+	sort.SliceStable(report.Changes, func(i, j int) bool {
+		a, b := report.Changes[i], report.Changes[j]
+		if a.GVK != b.GVK {
+			return a.GVK < b.GVK
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+	return report
+}
@@ -0,0 +1,133 @@
+package changes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/openshift-splat-team/must-hydrate/pkg/audit"
+	"github.com/openshift-splat-team/must-hydrate/pkg/diff"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func configMap(name string, data map[string]any) listedObject {
+	return listedObject{
+		objectKey: objectKey{Resource: "configmaps", Namespace: "default", Name: name},
+		object: &unstructured.Unstructured{Object: map[string]any{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   map[string]any{"name": name, "namespace": "default"},
+			"data":       data,
+		}},
+	}
+}
+
+func event(verb string, name string, code int32, user string) audit.Event {
+	return audit.Event{
+		Stage: "ResponseComplete",
+		Verb:  verb,
+		User:  audit.UserInfo{Username: user},
+		ObjectRef: &audit.ObjectReference{
+			Resource:   "configmaps",
+			Namespace:  "default",
+			Name:       name,
+			APIVersion: "v1",
+		},
+		ResponseStatus: &metav1.Status{Code: code},
+		ResponseObject: json.RawMessage(`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"` + name + `"}}`),
+	}
+}
+
+func post(t *testing.T, r *Recorder, events ...audit.Event) {
+	data, err := json.Marshal(audit.EventList{Items: events})
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := http.Post(r.webhook.URL(), "application/json", bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status %d", response.StatusCode)
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	r, err := NewRecorder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	states := [][]listedObject{
+		{configMap("settings", map[string]any{"mode": "a"}), configMap("obsolete", nil), configMap("untouched", nil)},
+		{configMap("settings", map[string]any{"mode": "b"}), configMap("created", nil), configMap("untouched", nil)},
+	}
+	list := func(ctx context.Context) ([]listedObject, error) {
+		state := states[0]
+		states = states[1:]
+		return state, nil
+	}
+
+	// requests made while hydrating are not recorded
+	post(t, r, event("create", "settings", 201, "admin"))
+	if _, err := r.Report(context.Background()); err == nil {
+		t.Error("expected an error reporting before the baseline is taken")
+	}
+	if err := r.takeBaseline(context.Background(), list); err != nil {
+		t.Fatal(err)
+	}
+
+	// must-hydrate provisioning the user controllers run as
+	provisioning := event("create", "provisioned", 201, "system:admin")
+	provisioning.UserAgent = InternalUserAgent
+
+	post(t, r,
+		provisioning,
+		event("update", "settings", 200, "system:serviceaccount:operator:controller"),
+		event("create", "created", 201, "system:serviceaccount:operator:controller"),
+		event("delete", "obsolete", 200, "system:admin"),
+		event("create", "temporary", 201, "system:admin"),
+		event("delete", "temporary", 200, "system:admin"),
+		event("update", "untouched", 409, "system:admin"),
+	)
+	if len(r.Requests()) != 5 {
+		t.Fatalf("expected the failed and internal requests to be ignored, got %+v", r.Requests())
+	}
+
+	report, err := r.Report(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	types := map[string]diff.ChangeType{}
+	for _, change := range report.Changes {
+		types[change.Name] = change.Type
+		if change.GVK != ".v1.ConfigMap" {
+			t.Errorf("unexpected GVK %s of %s", change.GVK, change.Name)
+		}
+	}
+	expected := map[string]diff.ChangeType{"settings": diff.Changed, "created": diff.Added, "obsolete": diff.Removed, "temporary": Unchanged}
+	for name, changeType := range expected {
+		if types[name] != changeType {
+			t.Errorf("expected %s to be %s, got %s", name, changeType, types[name])
+		}
+	}
+	if len(report.Changes) != len(expected) {
+		t.Errorf("expected only written objects to be reported, got %+v", report.Changes)
+	}
+
+	var text strings.Builder
+	if err := report.WriteText(&text); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"~ default/settings", "update by system:serviceaccount:operator:controller", "+ .data.mode: b", "1 added, 1 removed, 1 changed, 1 unchanged"} {
+		if !strings.Contains(text.String(), line) {
+			t.Errorf("expected %q in\n%s", line, text.String())
+		}
+	}
+}
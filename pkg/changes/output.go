@@ -0,0 +1,67 @@
+package changes
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/openshift-splat-team/must-hydrate/pkg/diff"
+)
+
+// WriteText writes each object with the requests which wrote it and the fields which changed, in
+// a form similar to a unified diff.
+func (r *Report) WriteText(w io.Writer) error {
+	var b strings.Builder
+	gvk := ""
+	counts := map[diff.ChangeType]int{}
+	for _, change := range r.Changes {
+		counts[change.Type]++
+		if change.GVK != gvk {
+			gvk = change.GVK
+			fmt.Fprintf(&b, "\n%s\n", gvk)
+		}
+
+		name := change.Name
+		if len(change.Namespace) > 0 {
+			name = change.Namespace + "/" + change.Name
+		}
+		switch change.Type {
+		case diff.Added:
+			fmt.Fprintf(&b, "+ %s\n", name)
+		case diff.Removed:
+			fmt.Fprintf(&b, "- %s\n", name)
+		case diff.Changed:
+			fmt.Fprintf(&b, "~ %s\n", name)
+		default:
+			fmt.Fprintf(&b, "= %s\n", name)
+		}
+		for _, request := range change.Requests {
+			verb := request.Verb
+			if len(request.Subresource) > 0 {
+				verb += " " + request.Subresource
+			}
+			fmt.Fprintf(&b, "    %s %s by %s\n", request.Time.Format(time.RFC3339), verb, request.User)
+		}
+		for _, field := range change.Fields {
+			if field.HasFrom() {
+				fmt.Fprintf(&b, "    - %s: %s\n", field.Path, diff.FormatValue(field.From))
+			}
+			if field.HasTo() {
+				fmt.Fprintf(&b, "    + %s: %s\n", field.Path, diff.FormatValue(field.To))
+			}
+		}
+	}
+
+	fmt.Fprintf(&b, "\n%d added, %d removed, %d changed, %d unchanged\n", counts[diff.Added], counts[diff.Removed], counts[diff.Changed], counts[Unchanged])
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteJSON writes the report as indented JSON.
+func (r *Report) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
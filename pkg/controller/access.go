@@ -0,0 +1,145 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/openshift-splat-team/must-hydrate/pkg/changes"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+)
+
+const (
+	// readOnlyUser is the user the kubeconfig authenticates as in read-only mode.
+	readOnlyUser = "must-hydrate-reader"
+	// readOnlyClusterRole grants read access to every resource, including pod logs.
+	readOnlyClusterRole = "must-hydrate:read-only"
+
+	// ManagedByLabel is set to ManagedBy on the cluster roles and cluster role bindings provisioned
+	// for users, so that they can be told apart from those of the must-gather.
+	ManagedByLabel = "app.kubernetes.io/managed-by"
+	ManagedBy      = "must-hydrate"
+)
+
+// createReadOnlyUser provisions a user which can only get, list and watch resources and returns
+// a configuration which authenticates as that user. The hydrator keeps using the admin user.
+func (a *HydratorReconciler) createReadOnlyUser(ctx context.Context) (*rest.Config, error) {
+	rules := []rbacv1.PolicyRule{
+		{
+			APIGroups: []string{"*"},
+			Resources: []string{"*"},
+			Verbs:     []string{"get", "list", "watch"},
+		},
+		{
+			APIGroups: []string{""},
+			Resources: []string{"pods/log"},
+			Verbs:     []string{"get"},
+		},
+		{
+			NonResourceURLs: []string{"*"},
+			Verbs:           []string{"get"},
+		},
+	}
+	config, err := a.createUser(ctx, readOnlyUser, readOnlyClusterRole, rules)
+	if err != nil {
+		return nil, fmt.Errorf("unable to provision read-only user: %v", err)
+	}
+	return config, nil
+}
+
+// AddUser provisions a user, such as the user controllers under test run as, which is granted
+// only the given rules by a cluster role named must-hydrate:<name>, and returns a configuration
+// which authenticates as that user. The control plane must be running.
+func (a *HydratorReconciler) AddUser(ctx context.Context, name string, rules []rbacv1.PolicyRule) (*rest.Config, error) {
+	if a.testEnv == nil {
+		return nil, fmt.Errorf("unable to provision user %s: the control plane is not running", name)
+	}
+	// the user may write, so the control plane no longer holds only the gathered state
+	a.usersAdded.Store(true)
+	config, err := a.createUser(ctx, name, "must-hydrate:"+name, rules)
+	if err != nil {
+		return nil, fmt.Errorf("unable to provision user %s: %v", name, err)
+	}
+	return config, nil
+}
+
+// createUser creates or updates the cluster role, binds it to the user and returns a configuration
+// which authenticates as the user.
+func (a *HydratorReconciler) createUser(ctx context.Context, name string, roleName string, rules []rbacv1.PolicyRule) (*rest.Config, error) {
+	clusterRole, binding := userRBAC(name, roleName, rules)
+	clientSet, err := kubernetes.NewForConfig(a.internalConfig())
+	if err != nil {
+		return nil, fmt.Errorf("unable to create client: %v", err)
+	}
+	clusterRoles := clientSet.RbacV1().ClusterRoles()
+	if _, err := clusterRoles.Create(ctx, clusterRole, metav1.CreateOptions{}); apierrors.IsAlreadyExists(err) {
+		// a control plane restored from a snapshot already has the role
+		existing, err := clusterRoles.Get(ctx, roleName, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("unable to get cluster role %s: %v", roleName, err)
+		}
+		existing.Rules = clusterRole.Rules
+		if existing.Labels == nil {
+			existing.Labels = map[string]string{}
+		}
+		existing.Labels[ManagedByLabel] = ManagedBy
+		if _, err := clusterRoles.Update(ctx, existing, metav1.UpdateOptions{}); err != nil {
+			return nil, fmt.Errorf("unable to update cluster role %s: %v", roleName, err)
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to create cluster role %s: %v", roleName, err)
+	}
+
+	_, err = clientSet.RbacV1().ClusterRoleBindings().Create(ctx, binding, metav1.CreateOptions{})
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		return nil, fmt.Errorf("unable to create cluster role binding %s: %v", roleName, err)
+	}
+
+	user, err := a.testEnv.AddUser(envtest.User{Name: name}, a.restConfig)
+	if err != nil {
+		return nil, err
+	}
+	return user.Config(), nil
+}
+
+// userRBAC returns the cluster role granting the rules, and its binding to the user, labelled as
+// managed by must-hydrate.
+func userRBAC(name string, roleName string, rules []rbacv1.PolicyRule) (*rbacv1.ClusterRole, *rbacv1.ClusterRoleBinding) {
+	meta := metav1.ObjectMeta{
+		Name:   roleName,
+		Labels: map[string]string{ManagedByLabel: ManagedBy},
+	}
+	clusterRole := &rbacv1.ClusterRole{
+		ObjectMeta: *meta.DeepCopy(),
+		Rules:      rules,
+	}
+	binding := &rbacv1.ClusterRoleBinding{
+		ObjectMeta: *meta.DeepCopy(),
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: rbacv1.GroupName,
+			Kind:     "ClusterRole",
+			Name:     roleName,
+		},
+		Subjects: []rbacv1.Subject{
+			{
+				APIGroup: rbacv1.GroupName,
+				Kind:     rbacv1.UserKind,
+				Name:     name,
+			},
+		},
+	}
+	return clusterRole, binding
+}
+
+// internalConfig returns the admin configuration with the user agent of requests which are not
+// recorded by the ChangeRecorder, so that provisioning a user once hydration has converged is
+// not reported as a change to the hydrated state.
+func (a *HydratorReconciler) internalConfig() *rest.Config {
+	config := rest.CopyConfig(a.restConfig)
+	config.UserAgent = changes.InternalUserAgent
+	return config
+}
@@ -0,0 +1,63 @@
+package controller
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/openshift-splat-team/must-hydrate/pkg/audit"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+)
+
+// configureAudit configures the audit log and policy of the API server, and the audit webhook of
+// the ChangeRecorder. The API server has a single audit policy, which applies to both.
+func (a *HydratorReconciler) configureAudit(api *envtest.APIServer) error {
+	policy := ""
+	if a.ChangeRecorder != nil {
+		webhookConfigPath, err := a.ChangeRecorder.WriteWebhookConfig(a.StateDir)
+		if err != nil {
+			return fmt.Errorf("unable to configure change recording: %v", err)
+		}
+		a.generatedFiles = append(a.generatedFiles, webhookConfigPath)
+		api.Configure().Set("audit-webhook-config-file", webhookConfigPath)
+		// requests complete only once they have been recorded, so none are missing from a report
+		api.Configure().Set("audit-webhook-mode", "blocking")
+		policy = audit.WritesPolicy
+	}
+
+	if len(a.AuditLogPath) > 0 {
+		logPath, err := filepath.Abs(a.AuditLogPath)
+		if err != nil {
+			return fmt.Errorf("unable to resolve the audit log path: %v", err)
+		}
+		if err := os.MkdirAll(filepath.Dir(logPath), 0700); err != nil {
+			return fmt.Errorf("unable to create the audit log directory: %v", err)
+		}
+		api.Configure().Set("audit-log-path", logPath)
+		api.Configure().Set("audit-log-format", "json")
+		policy = audit.DefaultPolicy
+	}
+
+	if len(a.AuditPolicyPath) > 0 {
+		policyPath, err := filepath.Abs(a.AuditPolicyPath)
+		if err != nil {
+			return fmt.Errorf("unable to resolve the audit policy path: %v", err)
+		}
+		if _, err := os.Stat(policyPath); err != nil {
+			return fmt.Errorf("unable to read the audit policy: %v", err)
+		}
+		api.Configure().Set("audit-policy-file", policyPath)
+		return nil
+	}
+	if len(policy) == 0 {
+		return nil
+	}
+
+	policyPath := filepath.Join(a.StateDir, "audit-policy.yaml")
+	if err := audit.WritePolicy(policy, policyPath); err != nil {
+		return err
+	}
+	a.generatedFiles = append(a.generatedFiles, policyPath)
+	api.Configure().Set("audit-policy-file", policyPath)
+	return nil
+}
@@ -0,0 +1,58 @@
+package controller
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/openshift-splat-team/must-hydrate/pkg/audit"
+	"github.com/openshift-splat-team/must-hydrate/pkg/changes"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+)
+
+func TestConfigureAudit(t *testing.T) {
+	policyOf := func(a *HydratorReconciler) string {
+		api := &envtest.APIServer{}
+		if err := a.configureAudit(api); err != nil {
+			t.Fatal(err)
+		}
+		paths := api.Configure().Get("audit-policy-file").Get(nil)
+		if len(paths) == 0 {
+			return ""
+		}
+		data, err := os.ReadFile(paths[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	if policy := policyOf(&HydratorReconciler{StateDir: t.TempDir()}); len(policy) > 0 {
+		t.Errorf("expected no audit policy by default, got %s", policy)
+	}
+
+	recorder, err := changes.NewRecorder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer recorder.Close()
+	if policy := policyOf(&HydratorReconciler{StateDir: t.TempDir(), ChangeRecorder: recorder}); policy != audit.WritesPolicy {
+		t.Errorf("expected only writes to be audited for the change recorder, got %s", policy)
+	}
+
+	logPath := filepath.Join(t.TempDir(), "logs", "audit.log")
+	if policy := policyOf(&HydratorReconciler{StateDir: t.TempDir(), ChangeRecorder: recorder, AuditLogPath: logPath}); policy != audit.DefaultPolicy {
+		t.Errorf("expected every request to be audited to the log, got %s", policy)
+	}
+
+	policyPath := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(policyPath, []byte("custom"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if policy := policyOf(&HydratorReconciler{StateDir: t.TempDir(), AuditLogPath: logPath, AuditPolicyPath: policyPath}); policy != "custom" {
+		t.Errorf("expected the given policy, got %s", policy)
+	}
+	if err := (&HydratorReconciler{AuditPolicyPath: filepath.Join(t.TempDir(), "missing")}).configureAudit(&envtest.APIServer{}); err == nil {
+		t.Error("expected an error for a missing policy")
+	}
+}
@@ -0,0 +1,112 @@
+package controller
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/openshift-splat-team/must-hydrate/pkg/controller/util"
+)
+
+// controllerManagerBinary is the name of the kube-controller-manager binary.
+const controllerManagerBinary = "kube-controller-manager"
+
+// DefaultControllers are the kube-controller-manager controllers which provision what clients
+// such as exutil.NewCLI expect of a project: namespace finalisation, the default service
+// accounts, their token secrets and the kube-root-ca.crt ConfigMap. The garbage collector is not
+// included because hydrated owner references hold the gathered UIDs of their owners, which the
+// API server does not reuse, so it would delete every hydrated dependent.
+var DefaultControllers = []string{
+	"namespace",
+	"serviceaccount",
+	"serviceaccount-token",
+	"root-ca-cert-publisher",
+}
+
+// findControllerManager returns the path of the kube-controller-manager binary. Unless
+// ControllerManagerPath is set, it is looked up the way envtest looks up its binaries, in
+// $TEST_ASSET_KUBE_CONTROLLER_MANAGER, $KUBEBUILDER_ASSETS and /usr/local/kubebuilder/bin, and
+// then on the PATH.
+func (a *HydratorReconciler) findControllerManager() (string, error) {
+	candidates := []string{a.ControllerManagerPath}
+	if len(a.ControllerManagerPath) == 0 {
+		candidates = []string{
+			os.Getenv("TEST_ASSET_KUBE_CONTROLLER_MANAGER"),
+			filepath.Join(os.Getenv("KUBEBUILDER_ASSETS"), controllerManagerBinary),
+			filepath.Join("/usr/local/kubebuilder/bin", controllerManagerBinary),
+		}
+	}
+	for _, candidate := range candidates {
+		if info, err := os.Stat(candidate); len(candidate) > 0 && err == nil && info.Mode().IsRegular() {
+			return candidate, nil
+		}
+	}
+	if len(a.ControllerManagerPath) == 0 {
+		if path, err := exec.LookPath(controllerManagerBinary); err == nil {
+			return path, nil
+		}
+		return "", fmt.Errorf("unable to find %s in $KUBEBUILDER_ASSETS or on the PATH: it is not an envtest binary and must be installed separately", controllerManagerBinary)
+	}
+	return "", fmt.Errorf("unable to find %s", a.ControllerManagerPath)
+}
+
+// controllerManagerArgs returns the arguments of a kube-controller-manager which runs only the
+// selected controllers, without leader election or a serving port.
+func (a *HydratorReconciler) controllerManagerArgs(kubeconfigPath string, rootCAPath string, serviceAccountKeyPath string) []string {
+	return []string{
+		"--kubeconfig=" + kubeconfigPath,
+		"--authentication-kubeconfig=" + kubeconfigPath,
+		"--authorization-kubeconfig=" + kubeconfigPath,
+		"--controllers=" + strings.Join(a.Controllers, ","),
+		"--cluster-name=" + a.clusterName,
+		"--leader-elect=false",
+		"--secure-port=0",
+		"--root-ca-file=" + rootCAPath,
+		"--service-account-private-key-file=" + serviceAccountKeyPath,
+	}
+}
+
+// startControllerManager writes the kubeconfig and root CA of the kube-controller-manager to the
+// state directory and starts it once hydration has converged, so that the controllers only see
+// the complete hydrated state. It is stopped along with the hydrator.
+func (a *HydratorReconciler) startControllerManager(binary string, serviceAccountKeyPath string) error {
+	kubeconfigPath := filepath.Join(a.StateDir, "kube-controller-manager.kubeconfig")
+	if err := util.WriteKubeconfig(a.restConfig, a.clusterName, kubeconfigPath); err != nil {
+		return fmt.Errorf("unable to write the kube-controller-manager kubeconfig: %v", err)
+	}
+	a.generatedFiles = append(a.generatedFiles, kubeconfigPath)
+
+	rootCAPath := filepath.Join(a.StateDir, "kube-controller-manager-ca.crt")
+	if err := os.WriteFile(rootCAPath, a.restConfig.CAData, 0600); err != nil {
+		return fmt.Errorf("unable to write the kube-controller-manager root CA: %v", err)
+	}
+	a.generatedFiles = append(a.generatedFiles, rootCAPath)
+
+	cmd := exec.CommandContext(a.context, binary, a.controllerManagerArgs(kubeconfigPath, rootCAPath, serviceAccountKeyPath)...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(syscall.SIGTERM)
+	}
+	cmd.WaitDelay = 10 * time.Second
+
+	a.background.Add(1)
+	go func() {
+		defer a.background.Done()
+		select {
+		case <-a.Converged():
+		case <-a.context.Done():
+			return
+		}
+
+		a.log.Info("starting kube-controller-manager", "controllers", a.Controllers)
+		if err := cmd.Run(); a.context.Err() == nil {
+			a.log.Error(err, "kube-controller-manager exited before the hydrator was stopped")
+		}
+	}()
+	return nil
+}
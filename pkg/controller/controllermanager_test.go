@@ -0,0 +1,33 @@
+package controller
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFindControllerManager(t *testing.T) {
+	binary := filepath.Join(t.TempDir(), controllerManagerBinary)
+	if err := os.WriteFile(binary, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", "")
+	t.Setenv("KUBEBUILDER_ASSETS", t.TempDir())
+
+	t.Setenv("TEST_ASSET_KUBE_CONTROLLER_MANAGER", "")
+	if _, err := os.Stat("/usr/local/kubebuilder/bin/" + controllerManagerBinary); err == nil {
+		// the default envtest location holds a binary on this machine
+	} else if _, err := (&HydratorReconciler{}).findControllerManager(); err == nil {
+		t.Error("expected an error when no binary is installed")
+	}
+
+	t.Setenv("KUBEBUILDER_ASSETS", filepath.Dir(binary))
+	if found, err := (&HydratorReconciler{}).findControllerManager(); err != nil || found != binary {
+		t.Errorf("expected %s next to the envtest binaries, got %q. %v", binary, found, err)
+	}
+
+	missing := &HydratorReconciler{ControllerManagerPath: filepath.Join(t.TempDir(), "missing")}
+	if _, err := missing.findControllerManager(); err == nil {
+		t.Error("expected an error for a missing ControllerManagerPath")
+	}
+}
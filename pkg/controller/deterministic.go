@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/openshift-splat-team/must-hydrate/pkg/controller/util"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// OriginalUIDAnnotation holds the UID of a resource as it was gathered, or a UID derived from
+	// its kind, namespace and name if none was gathered. It is only set in deterministic mode.
+	OriginalUIDAnnotation = "must-hydrate.openshift.io/original-uid"
+	// OriginalCreationTimestampAnnotation holds the creation timestamp of a resource as it was
+	// gathered, or DeterministicTime if none was gathered. It is only set in deterministic mode.
+	OriginalCreationTimestampAnnotation = "must-hydrate.openshift.io/original-creation-timestamp"
+)
+
+// DeterministicTime is the time of the fixed clock used in deterministic mode for the values the
+// hydrator sets which were not gathered.
+var DeterministicTime = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// uidNamespace is the namespace of the UIDs derived for resources gathered without one.
+var uidNamespace = uuid.MustParse("3a5c2a7e-5b7d-4d51-9a55-9f5a0b6e0d11")
+
+// annotateOrigin records the gathered UID and creation timestamp of the resource, or of each item
+// of a list, in annotations before they are dropped. The API server assigns new values on create,
+// so the annotations are the stable identity of a hydrated resource. Annotations which are already
+// set, such as on a gathered resource annotated when it was loaded, are kept.
+func annotateOrigin(content map[string]any) {
+	obj := &unstructured.Unstructured{Object: content}
+	if obj.IsList() {
+		// items are annotated in place, NestedSlice would return a copy
+		items, _ := content["items"].([]any)
+		for _, item := range items {
+			if item, ok := item.(map[string]any); ok {
+				annotateOrigin(item)
+			}
+		}
+		return
+	}
+	if _, ok := content["metadata"].(map[string]any); !ok {
+		return
+	}
+
+	uid := string(obj.GetUID())
+	if len(uid) == 0 {
+		uid = stableUID(obj.GroupVersionKind(), obj.GetNamespace(), obj.GetName())
+	}
+	creationTimestamp := DeterministicTime.Format(time.RFC3339)
+	if created := obj.GetCreationTimestamp(); !created.IsZero() {
+		creationTimestamp = created.UTC().Format(time.RFC3339)
+	}
+
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	if _, ok := annotations[OriginalUIDAnnotation]; !ok {
+		annotations[OriginalUIDAnnotation] = uid
+	}
+	if _, ok := annotations[OriginalCreationTimestampAnnotation]; !ok {
+		annotations[OriginalCreationTimestampAnnotation] = creationTimestamp
+	}
+	obj.SetAnnotations(annotations)
+}
+
+// sortInstances orders the cached resources of each GVK by namespace and name, rather than the
+// order their files were walked in, so that they are applied in the same order on every run.
+func (a *HydratorReconciler) sortInstances() {
+	for _, item := range a.gvkCache {
+		sort.SliceStable(item.instances, func(i, j int) bool {
+			if item.instances[i].GetNamespace() != item.instances[j].GetNamespace() {
+				return item.instances[i].GetNamespace() < item.instances[j].GetNamespace()
+			}
+			return item.instances[i].GetName() < item.instances[j].GetName()
+		})
+	}
+}
+
+// stableUID returns a UID derived from the group, kind, namespace and name of a resource.
+func stableUID(gvk schema.GroupVersionKind, namespace string, name string) string {
+	return uuid.NewSHA1(uidNamespace, []byte(strings.Join([]string{gvk.Group, gvk.Kind, namespace, name}, "/"))).String()
+}
+
+// orderedKeys returns the keys of the cached GVKs to apply in a stable order: the GVKs in the
+// order they are given, or all GVKs ordered by key if none are given.
+func (a *HydratorReconciler) orderedKeys(applyGvks []schema.GroupVersionKind) []string {
+	rank := func(gvk schema.GroupVersionKind) int {
+		for i, applyGvk := range applyGvks {
+			if util.IsGvk(applyGvk, gvk) {
+				return i
+			}
+		}
+		return -1
+	}
+
+	var keys []string
+	for key, item := range a.gvkCache {
+		if len(applyGvks) > 0 && rank(item.GroupVersionKind) < 0 {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		ri, rj := rank(a.gvkCache[keys[i]].GroupVersionKind), rank(a.gvkCache[keys[j]].GroupVersionKind)
+		if ri != rj {
+			return ri < rj
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
@@ -0,0 +1,140 @@
+package controller
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestDeterministicLoad(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"nodes.yaml": `
+apiVersion: v1
+kind: NodeList
+items:
+- apiVersion: v1
+  kind: Node
+  metadata:
+    name: master-0
+    uid: 0b1c2d3e-0000-1111-2222-333344445555
+    creationTimestamp: "2024-05-01T10:00:00Z"
+`,
+		"configmap.yaml": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+  namespace: default
+`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	load := func() *HydratorReconciler {
+		hydrator := &HydratorReconciler{RootPath: dir, Deterministic: true}
+		if err := hydrator.Load(); err != nil {
+			t.Fatal(err)
+		}
+		return hydrator
+	}
+	first, second := load(), load()
+
+	node := first.Resources(schema.GroupVersionKind{Version: "v1", Kind: "Node"})[0]
+	if uid := node.GetAnnotations()[OriginalUIDAnnotation]; uid != "0b1c2d3e-0000-1111-2222-333344445555" {
+		t.Errorf("expected the gathered UID to be kept, got %q", uid)
+	}
+	if created := node.GetAnnotations()[OriginalCreationTimestampAnnotation]; created != "2024-05-01T10:00:00Z" {
+		t.Errorf("expected the gathered creation timestamp to be kept, got %q", created)
+	}
+
+	configMaps := [2]map[string]string{
+		first.Resources(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"})[0].GetAnnotations(),
+		second.Resources(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"})[0].GetAnnotations(),
+	}
+	if len(configMaps[0][OriginalUIDAnnotation]) == 0 || configMaps[0][OriginalUIDAnnotation] != configMaps[1][OriginalUIDAnnotation] {
+		t.Errorf("expected a stable UID to be derived, got %v and %v", configMaps[0], configMaps[1])
+	}
+	if created := configMaps[0][OriginalCreationTimestampAnnotation]; created != "2000-01-01T00:00:00Z" {
+		t.Errorf("expected the fixed clock for a missing creation timestamp, got %q", created)
+	}
+
+	if first.InputKey() != second.InputKey() {
+		t.Errorf("expected a stable input key, got %q and %q", first.InputKey(), second.InputKey())
+	}
+	plain := &HydratorReconciler{RootPath: dir}
+	if err := plain.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if plain.InputKey() == first.InputKey() {
+		t.Error("expected deterministic mode to change the input key")
+	}
+}
+
+func TestOrderedKeys(t *testing.T) {
+	hydrator := &HydratorReconciler{gvkCache: map[string]*GvkCacheItem{}}
+	for _, gvk := range []schema.GroupVersionKind{
+		{Version: "v1", Kind: "Pod"},
+		{Group: "config.openshift.io", Version: "v1", Kind: "ClusterVersion"},
+		{Group: "apiextensions.k8s.io", Version: "v1", Kind: "CustomResourceDefinition"},
+		{Version: "v1", Kind: "ConfigMap"},
+	} {
+		hydrator.gvkCache[gvk.String()] = &GvkCacheItem{GroupVersionKind: gvk}
+	}
+
+	prioritised := hydrator.orderedKeys(kindPriority)
+	if len(prioritised) != 2 || hydrator.gvkCache[prioritised[0]].Kind != "CustomResourceDefinition" {
+		t.Errorf("expected the priority kinds in priority order, got %v", prioritised)
+	}
+	all := hydrator.orderedKeys(nil)
+	for i := 1; i < len(all); i++ {
+		if all[i-1] > all[i] {
+			t.Errorf("expected the keys to be sorted, got %v", all)
+		}
+	}
+}
+
+func TestDeterministicOrderAndOverlays(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.yaml": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: zeta\n  namespace: default\n",
+		"b.yaml": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: alpha\n  namespace: default\n",
+		"c.yaml": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: alpha\n  namespace: app\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	overlayDir := t.TempDir()
+	added := "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: added\n  namespace: default\n  uid: 9f8e7d6c-0000-1111-2222-333344445555\n"
+	if err := os.WriteFile(filepath.Join(overlayDir, "added.yaml"), []byte(added), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	hydrator := &HydratorReconciler{RootPath: dir, Deterministic: true, Overlays: []string{overlayDir}}
+	if err := hydrator.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	var order []string
+	for _, instance := range hydrator.gvkCache[hydrator.orderedKeys(nil)[0]].instances {
+		order = append(order, instance.GetNamespace()+"/"+instance.GetName())
+		if len(instance.GetAnnotations()[OriginalUIDAnnotation]) == 0 {
+			t.Errorf("expected %s/%s to be annotated", instance.GetNamespace(), instance.GetName())
+		}
+		if instance.GetName() == "added" && instance.GetAnnotations()[OriginalUIDAnnotation] != "9f8e7d6c-0000-1111-2222-333344445555" {
+			t.Errorf("expected the UID of the overlay object to be kept, got %v", instance.GetAnnotations())
+		}
+	}
+	expected := []string{"app/alpha", "default/added", "default/alpha", "default/zeta"}
+	if strings.Join(order, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected resources to be applied in the order %v, got %v", expected, order)
+	}
+}
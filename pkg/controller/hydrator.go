@@ -5,14 +5,26 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-logr/logr"
+	"github.com/openshift-splat-team/must-hydrate/pkg/changes"
 	"github.com/openshift-splat-team/must-hydrate/pkg/controller/util"
+	"github.com/openshift-splat-team/must-hydrate/pkg/logs"
+	"github.com/openshift-splat-team/must-hydrate/pkg/overlay"
+	"github.com/openshift-splat-team/must-hydrate/pkg/snapshot"
 	"gopkg.in/yaml.v3"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -23,12 +35,10 @@ import (
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
-	"k8s.io/klog/v2"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/envtest"
 
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
-	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 )
 
 var (
@@ -154,23 +164,143 @@ type GvkCacheItem struct {
 type HydratorReconciler struct {
 	client.Client
 
-	RootPath      string
+	RootPath string
+	// Logger receives the log messages of the hydrator. Defaults to the controller-runtime logger.
+	Logger        logr.Logger
 	log           logr.Logger
 	testEnv       *envtest.Environment
 	dynamicClient *dynamic.DynamicClient
 	clientSet     *kubernetes.Clientset
 	context       context.Context
+	cancel        context.CancelFunc
+	background    sync.WaitGroup
 	restConfig    *rest.Config
+	userConfig    *rest.Config
+	clients       *util.ResourceClientFactory
 	LogDisabled   bool
 
-	gvkCache  map[string]*GvkCacheItem
-	podLogMap map[string]string
+	// KubeletProxyURL is the URL of the HTTP CONNECT proxy which routes the API server's
+	// kubelet connections to the kubelet stand-in.
+	KubeletProxyURL string
+
+	// APIServerBindAddress is the address the API server listens on. Defaults to 127.0.0.1.
+	APIServerBindAddress string
+	// APIServerPort is the secure port of the API server. A free port is chosen if unset.
+	APIServerPort int
+	// APIServerSANs are additional DNS names or IP addresses the API server certificate is valid for.
+	APIServerSANs []string
+	// KubeconfigServer is the API server URL written to the kubeconfig, such as a published
+	// container port. Defaults to the address the API server listens on.
+	KubeconfigServer string
+
+	// ContextName is the name of the kubeconfig context. Defaults to the name of the gathered
+	// cluster, which is not unique when several gathers of one cluster are hydrated.
+	ContextName string
+
+	// Writable gives the user of the kubeconfig the same access as the hydrator. By default the
+	// kubeconfig can only get, list and watch resources so that the hydrated evidence is not changed.
+	Writable bool
+
+	// StateDir is the directory generated files, such as the kubeconfig and the egress selector
+	// configuration, are written to. The must-gather in RootPath is never written to. A temporary
+	// directory, removed on Stop, is used if unset.
+	StateDir string
+
+	// KubeconfigPath is the kubeconfig file written for the hydrated cluster. Defaults to
+	// envtest.kubeconfig in StateDir.
+	KubeconfigPath string
+	// MergeKubeconfigPath is an existing kubeconfig file, such as ~/.kube/config, the context of
+	// the hydrated cluster is merged in to. The context is removed by CleanupKubeconfig.
+	MergeKubeconfigPath string
+
+	// SnapshotStore holds the etcd data directories of hydrated must-gathers. When set, the control
+	// plane is restored from the snapshot of the must-gather if one exists, and a snapshot is saved
+	// on Stop once hydration has converged. No snapshot is saved if anything other than the
+	// hydrator could have written to the control plane: a Writable kubeconfig, Controllers or a
+	// user provisioned with AddUser.
+	SnapshotStore *snapshot.Store
+	// Snapshot is the key of a snapshot to restore instead of the one matching the must-gather.
+	Snapshot string
+	// RefreshSnapshot hydrates the must-gather from scratch, replacing any existing snapshot.
+	RefreshSnapshot bool
+
+	// ResourceFilter, when set, returns false for resources which should not be hydrated. The
+	// resources it filters out are part of the snapshot key, so a filtered must-gather is not
+	// restored from a snapshot of the whole must-gather, or the other way round.
+	ResourceFilter func(*unstructured.Unstructured) bool
+
+	// Deterministic records the gathered UID and creation timestamp of each resource in the
+	// OriginalUIDAnnotation and OriginalCreationTimestampAnnotation annotations, deriving them from
+	// the resource and DeterministicTime when they were not gathered. The API server assigns new
+	// UIDs, creation timestamps and resource versions on every run, so tests which compare
+	// hydrated state should compare these annotations instead.
+	Deterministic bool
+
+	// Overlays are directories of patches, deletions and objects applied, in order, on top of the
+	// must-gather once it is loaded. Every patch and deletion must match a resource. See the
+	// overlay package.
+	Overlays []string
+
+	// Controllers are the kube-controller-manager controllers, such as those in DefaultControllers,
+	// run against the control plane once hydration has converged. Their changes would not be part
+	// of the gathered state, so no snapshot is saved when they are run. None are run if unset.
+	Controllers []string
+	// ControllerManagerPath is the kube-controller-manager binary which runs the Controllers. It is
+	// looked up next to the envtest binaries and then on the PATH if unset.
+	ControllerManagerPath string
+
+	// AuditLogPath is the file the API server writes its audit log to, as JSON. Nothing is audited
+	// to a log if unset.
+	AuditLogPath string
+	// AuditPolicyPath is the audit policy of the API server. Defaults to audit.DefaultPolicy when
+	// AuditLogPath is set, or to audit.WritesPolicy when only the ChangeRecorder is set.
+	AuditPolicyPath string
+
+	// ChangeRecorder, when set, receives the write requests of the API server through an audit
+	// webhook. Its baseline is taken once hydration converges, before Converged is closed, so every
+	// change made after convergence is recorded.
+	ChangeRecorder *changes.Recorder
+
+	// KubeconfigDisabled skips writing a kubeconfig, such as when the control plane is only used in-process.
+	KubeconfigDisabled bool
+
+	// LogLayouts resolve the paths of log files to container logs. logs.DefaultLayouts are used if none are provided.
+	LogLayouts []logs.LayoutResolver
+
+	gvkCache         map[string]*GvkCacheItem
+	podLogMap        map[string]logs.Source
+	unmappedLogFiles []string
+	nodeAddressMap   map[string]string
+	logIndex         *logs.Index
+	logReport        logs.Report
+
+	statusLock    sync.RWMutex
+	status        HydrationStatus
+	converged     chan struct{}
+	convergedOnce sync.Once
+
+	certDir        string
+	clusterName    string
+	generatedFiles []string
+
+	inputKey    *snapshot.KeyBuilder
+	etcdDataDir string
+	restored    bool
+	usersAdded  atomic.Bool
+
+	tempStateDir bool
 }
 
 func (a *HydratorReconciler) loadResources() error {
 	var yamlFiles []string
 	rootDir := a.RootPath
 	a.gvkCache = make(map[string]*GvkCacheItem)
+	a.inputKey = snapshot.NewKeyBuilder()
+	if a.Deterministic {
+		// the annotations change the hydrated resources, so they are not restored from a snapshot
+		// taken without them
+		a.inputKey.Add("options/deterministic", nil)
+	}
 
 	err := filepath.Walk(rootDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
@@ -182,20 +312,8 @@ func (a *HydratorReconciler) loadResources() error {
 				return err
 			}
 			yamlFiles = append(yamlFiles, path)
-		} else if info.Name() == "current.log" {
-			parts := strings.Split(path, "/namespaces/")
-			if len(parts) < 2 {
-				return nil
-			}
-			parts = strings.Split(parts[1], "/")
-			if len(parts) == 7 {
-				namespace := parts[0]
-				podName := parts[2]
-				container := parts[3]
-
-				url := fmt.Sprintf("/containerLogs/%s/%s/%s", namespace, podName, container)
-				a.podLogMap[url] = path
-			}
+		} else if !info.IsDir() && strings.HasSuffix(info.Name(), ".log") {
+			a.mapLog(path)
 		}
 		return nil
 	})
@@ -207,6 +325,113 @@ func (a *HydratorReconciler) loadResources() error {
 	return nil
 }
 
+// mapLog maps the kubelet URL of a container log to the path of the log using the first
+// layout which recognizes the path.
+func (a *HydratorReconciler) mapLog(path string) {
+	source, ok := logs.Resolve(path, a.LogLayouts)
+	if !ok {
+		if logs.IsCandidate(path) {
+			a.unmappedLogFiles = append(a.unmappedLogFiles, path)
+		}
+		return
+	}
+
+	// prefer logs retrieved with TLS verification over their insecure equivalents
+	if existing, exists := a.podLogMap[source.Key()]; exists && !strings.Contains(existing.Path, ".insecure.") {
+		return
+	}
+	a.podLogMap[source.Key()] = source
+}
+
+// LoadLogs discovers the container logs in the must-gather and indexes them for searching
+// without loading resources or starting a control plane.
+func (a *HydratorReconciler) LoadLogs() error {
+	a.initializeLogs()
+
+	err := filepath.Walk(a.RootPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && strings.HasSuffix(info.Name(), ".log") {
+			a.mapLog(path)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error walking the path. %v", err)
+	}
+
+	a.buildLogIndex()
+	return nil
+}
+
+func (a *HydratorReconciler) initializeLogs() {
+	a.podLogMap = make(map[string]logs.Source)
+	a.unmappedLogFiles = nil
+	if len(a.LogLayouts) == 0 {
+		a.LogLayouts = logs.DefaultLayouts
+	}
+}
+
+// buildLogIndex creates the search index over the discovered container logs.
+func (a *HydratorReconciler) buildLogIndex() {
+	var sources []logs.Source
+	for _, source := range a.podLogMap {
+		sources = append(sources, source)
+	}
+	a.logIndex = logs.NewIndex(sources)
+}
+
+// crossCheckLogs compares the discovered container logs with the containers of the gathered pods.
+func (a *HydratorReconciler) crossCheckLogs() {
+	pod := schema.GroupVersionKind{
+		Group:   "",
+		Version: "v1",
+		Kind:    "Pod",
+	}
+	pods, _ := a.getResourceFromCache(pod)
+
+	a.logReport = logs.CrossCheck(a.logIndex.Sources(), a.unmappedLogFiles, pods)
+	a.log.Info("mapped container logs", "logs", len(a.podLogMap),
+		"unmappedFiles", len(a.logReport.UnmappedFiles),
+		"logsWithoutPod", len(a.logReport.LogsWithoutPod),
+		"logsWithoutContainer", len(a.logReport.LogsWithoutContainer),
+		"containersWithoutLogs", len(a.logReport.ContainersWithoutLogs))
+	for _, path := range a.logReport.UnmappedFiles {
+		a.log.V(2).Info("log file does not match a known layout", "path", path)
+	}
+	for _, source := range a.logReport.LogsWithoutPod {
+		a.log.V(2).Info("log found for a pod which was not gathered", "namespace", source.Namespace, "pod", source.Pod, "container", source.Container)
+	}
+	for _, source := range a.logReport.LogsWithoutContainer {
+		a.log.V(2).Info("log found for a container which is not in the pod spec", "namespace", source.Namespace, "pod", source.Pod, "container", source.Container)
+	}
+	for _, container := range a.logReport.ContainersWithoutLogs {
+		a.log.V(2).Info("no log found for container", "namespace", container.Namespace, "pod", container.Pod, "container", container.Container)
+	}
+}
+
+// ClientSet returns a client set for the hydrated cluster. It is nil until the hydrator is initialized.
+func (a *HydratorReconciler) ClientSet() kubernetes.Interface {
+	return a.clientSet
+}
+
+// DynamicClient returns a dynamic client for the hydrated cluster. It is nil until the hydrator is initialized.
+func (a *HydratorReconciler) DynamicClient() dynamic.Interface {
+	return a.dynamicClient
+}
+
+// LogReport returns the differences between the discovered container logs and the containers of
+// the gathered pods.
+func (a *HydratorReconciler) LogReport() logs.Report {
+	return a.logReport
+}
+
+// LogIndex returns the search index over the container logs of the must-gather.
+func (a *HydratorReconciler) LogIndex() *logs.Index {
+	return a.logIndex
+}
+
 func (a *HydratorReconciler) cleanupMetadata(root map[string]any) {
 	if metadata, ok := root["metadata"].(map[string]any); ok {
 		if len(metadata) != 0 {
@@ -241,6 +466,10 @@ func (a *HydratorReconciler) cacheResources(resources []unstructured.Unstructure
 			a.log.V(4).Info("skipping hydrating resource with type", "group", gvk.Group, "version", gvk.Version, "kind", gvk.Kind)
 			continue
 		}
+		if a.ResourceFilter != nil && !a.ResourceFilter(&resource) {
+			a.inputKey.Add(fmt.Sprintf("filtered/%s/%s/%s/%s", resource.GetAPIVersion(), resource.GetKind(), resource.GetNamespace(), resource.GetName()), nil)
+			continue
+		}
 
 		var cachedResource *GvkCacheItem
 		var exists bool
@@ -262,8 +491,8 @@ func (a *HydratorReconciler) cacheResources(resources []unstructured.Unstructure
 }
 
 func (a *HydratorReconciler) GetLogPathFromUrl(url *url.URL) (string, error) {
-	if path, exists := a.podLogMap[url.Path]; exists {
-		return path, nil
+	if source, exists := a.podLogMap[logs.KeyFromURL(url)]; exists {
+		return source.Path, nil
 	}
 	return "", fmt.Errorf("unable to find log path from URL: %s", url.Path)
 }
@@ -273,6 +502,9 @@ func (a *HydratorReconciler) prepareAndCacheResource(path string) error {
 	if err != nil {
 		return fmt.Errorf("error reading file: %v", err)
 	}
+	if relPath, err := filepath.Rel(a.RootPath, path); err == nil {
+		a.inputKey.Add(filepath.ToSlash(relPath), data)
+	}
 
 	// Unmarshal YAML into a map.
 	var content map[string]interface{}
@@ -280,6 +512,9 @@ func (a *HydratorReconciler) prepareAndCacheResource(path string) error {
 		return fmt.Errorf("error unmarshalling YAML: %v", err)
 	}
 
+	if a.Deterministic {
+		annotateOrigin(content)
+	}
 	a.cleanupMetadata(content)
 
 	updatedYaml, err := yaml.Marshal(content)
@@ -321,26 +556,15 @@ func (a *HydratorReconciler) prepareAndCacheResource(path string) error {
 	return nil
 }
 
-func (a *HydratorReconciler) applyResources(applyGvks ...schema.GroupVersionKind) error {
+func (a *HydratorReconciler) applyResources(ctx context.Context, applyGvks ...schema.GroupVersionKind) error {
 	unappliedResources := false
-	for key, gvkCacheItem := range a.gvkCache {
+	for _, key := range a.orderedKeys(applyGvks) {
+		gvkCacheItem := a.gvkCache[key]
 		var unapplied []*unstructured.Unstructured
-		if len(applyGvks) > 0 {
-			var apply bool
-			for _, applyGvk := range applyGvks {
-				if util.IsGvk(applyGvk, gvkCacheItem.GroupVersionKind) {
-					apply = true
-					break
-				}
-			}
-			if !apply {
-				continue
-			}
-		}
 		a.log.Info("applying gvk", "gvk", util.GetGvkKey(gvkCacheItem.GroupVersionKind), "remaining", len(gvkCacheItem.instances))
 		for _, resourceInstance := range gvkCacheItem.instances {
 			gvk := resourceInstance.GroupVersionKind()
-			resourceIface, err := util.New(a.restConfig, gvk, resourceInstance.GetNamespace())
+			resourceIface, err := a.clients.New(gvk, resourceInstance.GetNamespace())
 			if err != nil {
 				a.log.Error(err, "unable to create resource interface", "gvk", util.GetGvkKey(gvk), "name", resourceInstance.GetName())
 				unappliedResources = true
@@ -348,11 +572,11 @@ func (a *HydratorReconciler) applyResources(applyGvks ...schema.GroupVersionKind
 				break
 			}
 
-			existing, err := resourceIface.Get(a.context, resourceInstance.GetName(), metav1.GetOptions{})
+			existing, err := resourceIface.Get(ctx, resourceInstance.GetName(), metav1.GetOptions{})
 			if apierrors.IsNotFound(err) {
-				klog.V(2).Infof("%s %s/%s not found, creating", resourceInstance.GetKind(), resourceInstance.GetNamespace(), resourceInstance.GetName())
+				a.log.V(2).Info("resource not found, creating", "gvk", util.GetGvkKey(gvk), "namespace", resourceInstance.GetNamespace(), "name", resourceInstance.GetName())
 				a.cleanupMetadata(resourceInstance.Object)
-				existing, err = resourceIface.Create(a.context, resourceInstance, metav1.CreateOptions{})
+				existing, err = resourceIface.Create(ctx, resourceInstance, metav1.CreateOptions{})
 				if err != nil {
 					a.log.Error(err, "unable to create resource", "gvk", util.GetGvkKey(gvk), "name", resourceInstance.GetName())
 					unapplied = append(unapplied, resourceInstance)
@@ -363,7 +587,7 @@ func (a *HydratorReconciler) applyResources(applyGvks ...schema.GroupVersionKind
 
 			if status, ok := resourceInstance.Object["status"]; ok {
 				existing.Object["status"] = status
-				_, err = resourceIface.UpdateStatus(a.context, existing, metav1.UpdateOptions{})
+				_, err = resourceIface.UpdateStatus(ctx, existing, metav1.UpdateOptions{})
 				if err != nil {
 					a.log.Error(err, "unable to udpate status for resource", "gvk", util.GetGvkKey(gvk), "name", resourceInstance.GetName())
 					unapplied = append(unapplied, existing)
@@ -409,7 +633,9 @@ func (a *HydratorReconciler) getResourceFromCache(gvk schema.GroupVersionKind, n
 	return resources, nil
 }
 
-// setupLogAccess sets up the log access for the HydratorReconciler.
+// setupLogAccess maps the addresses of each node to the node name so that kubelet connections
+// made by the API server can be routed to the kubelet stand-in for that node. Node resources are
+// left exactly as they were gathered.
 func (a *HydratorReconciler) setupLogAccess() error {
 	node := schema.GroupVersionKind{
 		Group:   "",
@@ -419,48 +645,46 @@ func (a *HydratorReconciler) setupLogAccess() error {
 
 	instances, err := a.getResourceFromCache(node)
 	if err != nil {
-		return errors.New("unable to find node resource. oc logs will be broken")
+		a.log.Info("unable to find node resource. oc logs will be broken")
+		return nil
 	}
 
-	var nodeList []*unstructured.Unstructured
-
 	for _, instance := range instances {
-		obj := instance.Object
-
-		status, exists := obj["status"].(map[string]any)
-		if !exists {
-			return fmt.Errorf("unable to get status from node resource. oc logs will be broken.")
-		}
+		nodeName := instance.GetName()
+		a.nodeAddressMap[nodeName] = nodeName
 
-		addresses, exists := status["addresses"].([]any)
-		if !exists {
-			return fmt.Errorf("unable to get status from node resource. oc logs will be broken.")
+		addresses, _, err := unstructured.NestedSlice(instance.Object, "status", "addresses")
+		if err != nil || len(addresses) == 0 {
+			a.log.Info("node has no addresses. oc logs will be broken for this node", "node", nodeName)
+			continue
 		}
 
-		addressList := []map[string]any{
-			{
-				"address": "localhost",
-				"type":    "Hostname",
-			},
-		}
 		for _, address := range addresses {
-			addr := address.(map[string]any)
-			if addr["type"] == "Hostname" {
+			addr, ok := address.(map[string]any)
+			if !ok {
 				continue
 			}
-			addressList = append(addressList, addr)
+			if value, ok := addr["address"].(string); ok && len(value) > 0 {
+				a.nodeAddressMap[value] = nodeName
+			}
 		}
-		status["addresses"] = addressList
-		obj["status"] = status
-		nodeList = append(nodeList, &unstructured.Unstructured{
-			Object: obj,
-		})
 	}
-	a.gvkCache[util.GetGvkKey(node)].instances = nodeList
 
 	return nil
 }
 
+// GetNodeNameFromAddress returns the name of the node which has the given address. The address
+// may optionally include a port.
+func (a *HydratorReconciler) GetNodeNameFromAddress(address string) (string, error) {
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		address = host
+	}
+	if nodeName, exists := a.nodeAddressMap[address]; exists {
+		return nodeName, nil
+	}
+	return "", fmt.Errorf("unable to find node with address: %s", address)
+}
+
 func (a *HydratorReconciler) getServiceNetwork() string {
 	serviceNetwork := "172.30.0.0/16"
 
@@ -497,50 +721,412 @@ func (a *HydratorReconciler) getServiceNetwork() string {
 	return serviceNetwork
 }
 
-func (a *HydratorReconciler) Initialize(ctx context.Context) error {
-	var err error
-
-	a.context = ctx
-	a.podLogMap = make(map[string]string)
-	logf.SetLogger(zap.New())
+// Load reads the resources and container logs of the must-gather without starting a control plane.
+func (a *HydratorReconciler) Load() error {
+	a.initializeLogs()
+	a.nodeAddressMap = make(map[string]string)
 
-	a.log = logf.Log.WithName("HydratorReconciler")
+	if a.Logger.GetSink() != nil {
+		a.log = a.Logger.WithName("HydratorReconciler")
+	} else {
+		a.log = logf.Log.WithName("HydratorReconciler")
+	}
 
 	if len(a.RootPath) == 0 {
 		a.RootPath = "./data"
 	}
 
-	err = a.loadResources()
+	err := a.loadResources()
 	if err != nil {
 		err = fmt.Errorf("unable to load resources %v", err)
 		a.log.Error(err, err.Error())
 		return err
 	}
 
-	if !a.LogDisabled {
+	if err := a.applyOverlays(); err != nil {
+		a.log.Error(err, "unable to apply overlays")
+		return err
+	}
+	a.sortInstances()
+
+	a.buildLogIndex()
+	a.crossCheckLogs()
+	a.clusterName = a.getClusterName()
+
+	loaded, remainingByKind := a.countResources()
+	a.statusLock.Lock()
+	a.status = HydrationStatus{
+		RootPath:        a.RootPath,
+		Loaded:          loaded,
+		Remaining:       loaded,
+		RemainingByKind: remainingByKind,
+		Logs:            len(a.podLogMap),
+	}
+	a.statusLock.Unlock()
+
+	return nil
+}
+
+// applyOverlays applies the overlays to the loaded resources. The files of the overlays are
+// added to the input key so that a snapshot of the must-gather alone is not restored.
+func (a *HydratorReconciler) applyOverlays() error {
+	if len(a.Overlays) == 0 {
+		return nil
+	}
+
+	resources := a.Resources()
+	for i, dir := range a.Overlays {
+		o, err := overlay.Load(dir)
+		if err != nil {
+			return err
+		}
+		for _, file := range o.Files {
+			a.inputKey.Add(fmt.Sprintf("overlay-%d/%s", i, file.Path), file.Data)
+		}
+		if resources, err = o.Apply(resources); err != nil {
+			return fmt.Errorf("unable to apply overlay %s: %v", dir, err)
+		}
+		a.log.Info("applied overlay", "dir", dir, "changes", len(o.Changes))
+	}
+
+	a.gvkCache = make(map[string]*GvkCacheItem)
+	var overlaid []unstructured.Unstructured
+	for _, resource := range resources {
+		// objects added by the overlays are annotated with the values they were written with
+		if a.Deterministic {
+			annotateOrigin(resource.Object)
+		}
+		a.cleanupMetadata(resource.Object)
+		overlaid = append(overlaid, *resource)
+	}
+	a.cacheResources(overlaid)
+	return nil
+}
+
+// Resources returns the loaded resources of the given GVKs, or all loaded resources if no GVKs
+// are provided, ordered by GVK, namespace and name. Resources are removed once they have been
+// applied to the control plane.
+func (a *HydratorReconciler) Resources(gvks ...schema.GroupVersionKind) []*unstructured.Unstructured {
+	var keys []string
+	for key, item := range a.gvkCache {
+		if len(gvks) > 0 && !slices.ContainsFunc(gvks, func(gvk schema.GroupVersionKind) bool {
+			return util.IsGvk(gvk, item.GroupVersionKind)
+		}) {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var resources []*unstructured.Unstructured
+	for _, key := range keys {
+		instances := slices.Clone(a.gvkCache[key].instances)
+		sort.SliceStable(instances, func(i, j int) bool {
+			if instances[i].GetNamespace() != instances[j].GetNamespace() {
+				return instances[i].GetNamespace() < instances[j].GetNamespace()
+			}
+			return instances[i].GetName() < instances[j].GetName()
+		})
+		resources = append(resources, instances...)
+	}
+	return resources
+}
+
+// RESTConfig returns the configuration of the hydrated control plane. It is nil until the hydrator is initialized.
+func (a *HydratorReconciler) RESTConfig() *rest.Config {
+	return a.restConfig
+}
+
+// UserRESTConfig returns the configuration written to the kubeconfig, which is read-only unless
+// Writable is set. It is nil until the hydrator is initialized.
+func (a *HydratorReconciler) UserRESTConfig() *rest.Config {
+	return a.userConfig
+}
+
+// getClusterName returns the name of the gathered cluster. The infrastructure name is preferred,
+// followed by the cluster ID.
+func (a *HydratorReconciler) getClusterName() string {
+	infrastructure := schema.GroupVersionKind{
+		Group:   "config.openshift.io",
+		Version: "v1",
+		Kind:    "Infrastructure",
+	}
+	if instances, err := a.getResourceFromCache(infrastructure, "cluster"); err == nil && len(instances) > 0 {
+		if name, _, _ := unstructured.NestedString(instances[0].Object, "status", "infrastructureName"); len(name) > 0 {
+			return name
+		}
+	}
+
+	clusterVersion := schema.GroupVersionKind{
+		Group:   "config.openshift.io",
+		Version: "v1",
+		Kind:    "ClusterVersion",
+	}
+	if instances, err := a.getResourceFromCache(clusterVersion, "version"); err == nil && len(instances) > 0 {
+		if clusterID, _, _ := unstructured.NestedString(instances[0].Object, "spec", "clusterID"); len(clusterID) > 0 {
+			return clusterID
+		}
+	}
+
+	return "envtest"
+}
+
+// InputKey returns the content hash of the resources of the must-gather, which is the key of its snapshot.
+func (a *HydratorReconciler) InputKey() string {
+	if a.inputKey == nil {
+		return ""
+	}
+	return a.inputKey.Key()
+}
+
+// ClusterName returns the name of the kubeconfig context, which is the name of the gathered cluster
+// unless ContextName is set.
+func (a *HydratorReconciler) ClusterName() string {
+	return a.clusterName
+}
+
+// writeKubeconfig writes the kubeconfig for the hydrated cluster and merges its context in to
+// MergeKubeconfigPath, if set.
+func (a *HydratorReconciler) writeKubeconfig() error {
+	kubeconfigCfg := rest.CopyConfig(a.userConfig)
+	if len(a.KubeconfigServer) > 0 {
+		kubeconfigCfg.Host = a.KubeconfigServer
+	}
+
+	kubeconfigPath := a.KubeconfigPath
+	if len(kubeconfigPath) == 0 {
+		kubeconfigPath = path.Join(a.StateDir, "envtest.kubeconfig")
+	}
+	if err := util.WriteKubeconfig(kubeconfigCfg, a.clusterName, kubeconfigPath); err != nil {
+		return fmt.Errorf("unable to write kubeconfig: %v", err)
+	}
+	// a kubeconfig at a path chosen by the user is left in place on shutdown
+	if len(a.KubeconfigPath) == 0 {
+		a.generatedFiles = append(a.generatedFiles, kubeconfigPath)
+	}
+	a.log.Info("wrote kubeconfig", "path", kubeconfigPath, "context", a.clusterName)
+
+	if len(a.MergeKubeconfigPath) > 0 {
+		if err := util.MergeKubeconfig(kubeconfigCfg, a.clusterName, a.MergeKubeconfigPath); err != nil {
+			return fmt.Errorf("unable to merge kubeconfig: %v", err)
+		}
+		a.log.Info("merged kubeconfig context", "path", a.MergeKubeconfigPath, "context", a.clusterName)
+	}
+	return nil
+}
+
+// CleanupKubeconfig removes the context of the hydrated cluster from MergeKubeconfigPath.
+func (a *HydratorReconciler) CleanupKubeconfig() error {
+	if len(a.MergeKubeconfigPath) == 0 || a.restConfig == nil {
+		return nil
+	}
+	if err := util.RemoveKubeconfigContext(a.clusterName, a.MergeKubeconfigPath); err != nil {
+		return fmt.Errorf("unable to remove kubeconfig context: %v", err)
+	}
+	return nil
+}
+
+// apiServerStartAttempts bounds how often the API server is started on another free port when the
+// one it was given is taken before it binds it.
+const apiServerStartAttempts = 3
+
+// startControlPlane starts the control plane. A free port is only free until the API server binds
+// it, so unless APIServerPort is set, an API server which fails to bind its port is started again
+// on another.
+func (a *HydratorReconciler) startControlPlane(api *envtest.APIServer) (*rest.Config, error) {
+	output := &bindErrorWriter{Writer: os.Stderr}
+	api.Err = output
+	for attempt := 1; ; attempt++ {
+		cfg, err := a.testEnv.Start()
+		if err == nil || a.APIServerPort > 0 || !output.inUse() || attempt == apiServerStartAttempts {
+			return cfg, err
+		}
+		port, err := freePort(api.SecureServing.Address)
+		if err != nil {
+			return nil, err
+		}
+		a.log.Info("API server port was taken, starting the API server on another port", "port", api.SecureServing.Port, "next", port)
+		api.SecureServing.Port = strconv.Itoa(port)
+		output.reset()
+	}
+}
+
+// bindErrorWriter passes the output of the API server through, noting whether it failed to bind
+// its port.
+type bindErrorWriter struct {
+	io.Writer
+	lock      sync.Mutex
+	addrInUse bool
+}
+
+func (w *bindErrorWriter) Write(p []byte) (int, error) {
+	if bytes.Contains(p, []byte("address already in use")) {
+		w.lock.Lock()
+		w.addrInUse = true
+		w.lock.Unlock()
+	}
+	return w.Writer.Write(p)
+}
+
+func (w *bindErrorWriter) inUse() bool {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.addrInUse
+}
+
+func (w *bindErrorWriter) reset() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.addrInUse = false
+}
+
+// freePort returns a port which is free on address.
+func freePort(address string) (int, error) {
+	listener, err := net.Listen("tcp", net.JoinHostPort(address, "0"))
+	if err != nil {
+		return 0, fmt.Errorf("unable to find a free port for the API server: %v", err)
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
+
+// configureAPIServerServing configures the address and port the API server listens on. When the
+// API server is to be reached by other names, a serving certificate valid for those names is generated.
+func (a *HydratorReconciler) configureAPIServerServing(api *envtest.APIServer) error {
+	// envtest only honours the address when the port is also set
+	if len(a.APIServerBindAddress) > 0 || a.APIServerPort > 0 {
+		address := a.APIServerBindAddress
+		if len(address) == 0 {
+			address = "127.0.0.1"
+		}
+		port := a.APIServerPort
+		if port == 0 {
+			var err error
+			if port, err = freePort(address); err != nil {
+				return err
+			}
+		}
+		api.SecureServing.Address = address
+		api.SecureServing.Port = strconv.Itoa(port)
+	}
+
+	if len(a.APIServerBindAddress) == 0 && len(a.APIServerSANs) == 0 {
+		return nil
+	}
+
+	certDir, err := os.MkdirTemp("", "must-hydrate-apiserver-")
+	if err != nil {
+		return fmt.Errorf("unable to create API server certificate directory: %v", err)
+	}
+	a.certDir = certDir
+
+	names := append([]string{a.APIServerBindAddress}, a.APIServerSANs...)
+	if len(a.KubeconfigServer) > 0 {
+		if serverURL, err := url.Parse(a.KubeconfigServer); err == nil {
+			names = append(names, serverURL.Hostname())
+		}
+	}
+
+	caPem, err := util.WriteAPIServerCerts(certDir, names...)
+	if err != nil {
+		return fmt.Errorf("unable to write API server certificates: %v", err)
+	}
+	api.CertDir = certDir
+	api.SecureServing.CA = caPem
+	return nil
+}
+
+// Initialize loads the must-gather, unless Load has already been called, starts the control plane and hydrates it in the background
+// until ctx is done or Stop is called. The control plane is stopped if initialization fails.
+func (a *HydratorReconciler) Initialize(ctx context.Context) error {
+	a.context, a.cancel = context.WithCancel(ctx)
+
+	if err := a.initialize(); err != nil {
+		if stopErr := a.Stop(); stopErr != nil {
+			a.log.Error(stopErr, "unable to stop after failing to initialize")
+		}
+		return err
+	}
+	return nil
+}
+
+func (a *HydratorReconciler) initialize() error {
+	var err error
+
+	if a.gvkCache == nil {
+		if err = a.Load(); err != nil {
+			return err
+		}
+	}
+	if len(a.ContextName) > 0 {
+		a.clusterName = a.ContextName
+	}
+
+	if err = a.prepareStateDir(); err != nil {
+		return err
+	}
+
+	var controllerManager string
+	if len(a.Controllers) > 0 {
+		if controllerManager, err = a.findControllerManager(); err != nil {
+			return err
+		}
+	}
+
+	a.background.Add(1)
+	go func() {
+		defer a.background.Done()
+		if err := a.logIndex.Build(a.context); err != nil && !errors.Is(err, context.Canceled) {
+			a.log.Error(err, "unable to build the log search index")
+		}
+	}()
+
+	api := envtest.APIServer{}
+	api.Configure().Set("service-cluster-ip-range", a.getServiceNetwork())
+	if err = a.configureAPIServerServing(&api); err != nil {
+		return err
+	}
+
+	if !a.LogDisabled && len(a.KubeletProxyURL) > 0 {
 		err = a.setupLogAccess()
 		if err != nil {
 			err = fmt.Errorf("unable to setup log access %v", err)
 			a.log.Error(err, err.Error())
 			return err
 		}
+
+		egressConfigPath, err := util.WriteEgressSelectorConfig(a.KubeletProxyURL, a.StateDir)
+		if err != nil {
+			return fmt.Errorf("unable to write egress selector configuration: %v", err)
+		}
+		a.generatedFiles = append(a.generatedFiles, egressConfigPath)
+		api.Configure().Set("egress-selector-config-file", egressConfigPath)
+	}
+	if err = a.configureAudit(&api); err != nil {
+		return err
+	}
+	etcd := &envtest.Etcd{}
+	if err = a.prepareEtcd(etcd); err != nil {
+		return err
 	}
 
-	api := envtest.APIServer{}
-	api.Configure().Set("service-cluster-ip-range", a.getServiceNetwork())
 	a.testEnv = &envtest.Environment{
 		CRDDirectoryPaths:        []string{},
 		AttachControlPlaneOutput: true,
 		ControlPlane: envtest.ControlPlane{
 			APIServer: &api,
+			Etcd:      etcd,
 		},
 	}
 
-	cfg, err := a.testEnv.Start()
+	cfg, err := a.startControlPlane(&api)
 	if err != nil {
 		a.log.Error(err, "unable to start envTest")
 		return fmt.Errorf("unable to start envTest: %v", err)
 	}
+	if ip := net.ParseIP(api.SecureServing.Address); ip != nil && ip.IsUnspecified() {
+		cfg.Host = fmt.Sprintf("https://%s", net.JoinHostPort("127.0.0.1", api.SecureServing.Port))
+	}
 	a.restConfig = cfg
 	a.dynamicClient, err = dynamic.NewForConfig(cfg)
 	if err != nil {
@@ -552,23 +1138,242 @@ func (a *HydratorReconciler) Initialize(ctx context.Context) error {
 		return fmt.Errorf("failed to create the k8s client set. %v", err)
 	}
 
-	err = util.WriteKubeconfig(cfg, a.RootPath)
+	a.clients, err = util.NewResourceClientFactory(a.context, cfg)
 	if err != nil {
-		return fmt.Errorf("unable to write kubeconfig: %v", err)
+		return fmt.Errorf("failed to create the resource client factory. %v", err)
+	}
+
+	a.userConfig = a.restConfig
+	if !a.Writable {
+		if a.userConfig, err = a.createReadOnlyUser(a.context); err != nil {
+			return err
+		}
+	}
+
+	if !a.KubeconfigDisabled {
+		if err = a.writeKubeconfig(); err != nil {
+			return err
+		}
+	}
+
+	if len(controllerManager) > 0 {
+		serviceAccountKeyPath := filepath.Join(api.CertDir, "sa-signer.key")
+		if err = a.startControllerManager(controllerManager, serviceAccountKeyPath); err != nil {
+			return err
+		}
 	}
-	go a.Reconcile()
+
+	if a.restored {
+		if err = a.takeBaseline(a.context); err != nil {
+			return err
+		}
+		a.markRestored()
+		return nil
+	}
+
+	a.background.Add(1)
+	go func() {
+		defer a.background.Done()
+		a.Reconcile(a.context)
+	}()
 
 	return nil
 }
 
-func (a *HydratorReconciler) Reconcile() {
+// takeBaseline takes the baseline of the ChangeRecorder, if it has not been taken already.
+func (a *HydratorReconciler) takeBaseline(ctx context.Context) error {
+	if a.ChangeRecorder == nil || a.ChangeRecorder.Recording() {
+		return nil
+	}
+	return a.ChangeRecorder.Baseline(ctx, a.restConfig)
+}
+
+// prepareStateDir creates the directory generated files are written to.
+func (a *HydratorReconciler) prepareStateDir() error {
+	if len(a.StateDir) == 0 {
+		stateDir, err := os.MkdirTemp("", "must-hydrate-state-")
+		if err != nil {
+			return fmt.Errorf("unable to create state directory: %v", err)
+		}
+		a.StateDir = stateDir
+		a.tempStateDir = true
+		return nil
+	}
+	if err := os.MkdirAll(a.StateDir, 0700); err != nil {
+		return fmt.Errorf("unable to create state directory: %v", err)
+	}
+	return nil
+}
+
+// prepareEtcd creates the etcd data directory, restoring it from a snapshot when one is available.
+func (a *HydratorReconciler) prepareEtcd(etcd *envtest.Etcd) error {
+	dataDir, err := os.MkdirTemp("", "must-hydrate-etcd-")
+	if err != nil {
+		return fmt.Errorf("unable to create etcd data directory: %v", err)
+	}
+	a.etcdDataDir = dataDir
+	etcd.DataDir = dataDir
+
+	if a.SnapshotStore == nil {
+		if len(a.Snapshot) > 0 {
+			return fmt.Errorf("snapshot %s can not be restored without a snapshot store", a.Snapshot)
+		}
+		return nil
+	}
+
+	key := a.Snapshot
+	if len(key) == 0 {
+		if a.RefreshSnapshot {
+			return nil
+		}
+		key = a.InputKey()
+	}
+
+	_, exists, err := a.SnapshotStore.Get(key)
+	if err != nil {
+		return fmt.Errorf("unable to read snapshot %s: %v", key, err)
+	}
+	if !exists {
+		if len(a.Snapshot) > 0 {
+			return fmt.Errorf("snapshot %s does not exist", key)
+		}
+		a.log.Info("no snapshot found, hydrating from scratch", "snapshot", key)
+		return nil
+	}
+
+	if _, err := a.SnapshotStore.Restore(key, dataDir); err != nil {
+		return err
+	}
+	a.restored = true
+	a.log.Info("restored control plane from snapshot", "snapshot", key)
+	a.statusLock.Lock()
+	a.status.Snapshot = key
+	a.statusLock.Unlock()
+	return nil
+}
+
+// markRestored records that every resource is already present in a control plane restored from a snapshot.
+func (a *HydratorReconciler) markRestored() {
+	for _, item := range a.gvkCache {
+		item.instances = nil
+	}
+	a.recordPass(true)
+}
+
+// saveSnapshot saves the etcd data directory of a converged, stopped control plane.
+func (a *HydratorReconciler) saveSnapshot() error {
+	if a.SnapshotStore == nil || a.restored || len(a.etcdDataDir) == 0 {
+		return nil
+	}
+	status := a.Status()
+	if !status.Converged {
+		a.log.Info("hydration did not converge, not saving a snapshot")
+		return nil
+	}
+	if writers := a.otherWriters(); len(writers) > 0 {
+		a.log.Info("the control plane may have been changed after hydration, not saving a snapshot", "writers", writers)
+		return nil
+	}
+
+	info := snapshot.Info{
+		Key:         a.InputKey(),
+		RootPath:    a.RootPath,
+		ClusterName: a.clusterName,
+		Resources:   status.Loaded,
+	}
+	if absPath, err := filepath.Abs(a.RootPath); err == nil {
+		info.RootPath = absPath
+	}
+	if err := a.SnapshotStore.Save(info, a.etcdDataDir); err != nil {
+		return fmt.Errorf("unable to save snapshot: %v", err)
+	}
+	a.log.Info("saved snapshot", "snapshot", info.Key)
+	return nil
+}
+
+// otherWriters returns what, other than the hydrator, could have written to the control plane
+// once hydration converged. The etcd data directory is only copied on Stop, so it would include
+// their changes.
+func (a *HydratorReconciler) otherWriters() []string {
+	var writers []string
+	if a.Writable {
+		writers = append(writers, "writable kubeconfig")
+	}
+	if len(a.Controllers) > 0 {
+		writers = append(writers, "controllers")
+	}
+	if a.usersAdded.Load() {
+		writers = append(writers, "added users")
+	}
+	return writers
+}
+
+// Stop stops hydrating, stops the control plane and removes the files generated for it. It is
+// safe to call Stop more than once.
+func (a *HydratorReconciler) Stop() error {
+	var errs []error
+
+	if a.cancel != nil {
+		a.cancel()
+	}
+	a.background.Wait()
+
+	if a.testEnv != nil {
+		a.log.Info("stopping control plane")
+		if err := a.testEnv.Stop(); err != nil {
+			errs = append(errs, fmt.Errorf("unable to stop envTest: %v", err))
+		} else if err := a.saveSnapshot(); err != nil {
+			errs = append(errs, err)
+		}
+		a.testEnv = nil
+	}
+
+	if len(a.etcdDataDir) > 0 {
+		if err := os.RemoveAll(a.etcdDataDir); err != nil {
+			errs = append(errs, fmt.Errorf("unable to remove %s: %v", a.etcdDataDir, err))
+		}
+		a.etcdDataDir = ""
+	}
+
+	if err := a.CleanupKubeconfig(); err != nil {
+		errs = append(errs, err)
+	}
+
+	for _, generatedFile := range a.generatedFiles {
+		if err := os.Remove(generatedFile); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, fmt.Errorf("unable to remove %s: %v", generatedFile, err))
+		}
+	}
+	a.generatedFiles = nil
+
+	if len(a.certDir) > 0 {
+		if err := os.RemoveAll(a.certDir); err != nil {
+			errs = append(errs, fmt.Errorf("unable to remove %s: %v", a.certDir, err))
+		}
+		a.certDir = ""
+	}
+
+	if a.tempStateDir {
+		if err := os.RemoveAll(a.StateDir); err != nil {
+			errs = append(errs, fmt.Errorf("unable to remove %s: %v", a.StateDir, err))
+		}
+		a.StateDir = ""
+		a.tempStateDir = false
+	}
+
+	return errors.Join(errs...)
+}
+
+// Reconcile applies the cached resources to the control plane, backing off between passes, until
+// ctx is done.
+func (a *HydratorReconciler) Reconcile(ctx context.Context) {
 	var priorityDone bool
 	var err error
 	backoff := 1
 
-	for {
+	for ctx.Err() == nil {
 		if !priorityDone {
-			err = a.applyResources(kindPriority...)
+			err = a.applyResources(ctx, kindPriority...)
 			if err != nil {
 				a.log.Error(err, "unable to apply all priority resources")
 			} else {
@@ -577,15 +1382,27 @@ func (a *HydratorReconciler) Reconcile() {
 			}
 		}
 
-		err = a.applyResources()
+		err = a.applyResources(ctx)
 		if err != nil {
 			a.log.Error(err, "unable to apply all resources")
 		} else {
 			a.log.Info("no errors found in reconciliation")
 		}
+		converged := err == nil
+		if converged {
+			if err := a.takeBaseline(ctx); err != nil {
+				a.log.Error(err, "unable to take the baseline of changes")
+				converged = false
+			}
+		}
+		a.recordPass(converged)
 		seconds := 1 << backoff
 		a.log.Info("backing off", "seconds", seconds)
-		time.Sleep(time.Duration(seconds) * time.Second)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Duration(seconds) * time.Second):
+		}
 		if backoff < 5 {
 			backoff++
 		}
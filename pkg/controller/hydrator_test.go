@@ -1,7 +1,16 @@
 package controller
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/openshift-splat-team/must-hydrate/pkg/changes"
+	"github.com/openshift-splat-team/must-hydrate/pkg/snapshot"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/rest"
 )
 
 func TestYamlPaths(t *testing.T) {
@@ -14,3 +23,136 @@ func TestYamlPaths(t *testing.T) {
 
 	// fmt.Printf("crd path: %v\n", crdPath)
 }
+
+func TestSaveSnapshot(t *testing.T) {
+	store := &snapshot.Store{Dir: t.TempDir()}
+	dataDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dataDir, "db"), []byte("hydrated"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	a := &HydratorReconciler{SnapshotStore: store, etcdDataDir: dataDir, inputKey: snapshot.NewKeyBuilder()}
+	a.recordPass(true)
+	if err := a.saveSnapshot(); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := t.TempDir()
+	if _, err := store.Restore(a.InputKey(), restored); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(restored, "db")); string(data) != "hydrated" {
+		t.Errorf("expected the hydrated state to be restored, got %q", data)
+	}
+}
+
+func TestSaveSnapshotOtherWriters(t *testing.T) {
+	for name, writer := range map[string]func(a *HydratorReconciler){
+		"writable":    func(a *HydratorReconciler) { a.Writable = true },
+		"controllers": func(a *HydratorReconciler) { a.Controllers = DefaultControllers },
+		"added user":  func(a *HydratorReconciler) { a.usersAdded.Store(true) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			store := &snapshot.Store{Dir: t.TempDir()}
+			dataDir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dataDir, "db"), []byte("written"), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			a := &HydratorReconciler{SnapshotStore: store, etcdDataDir: dataDir, inputKey: snapshot.NewKeyBuilder()}
+			writer(a)
+			a.recordPass(true)
+			if err := a.saveSnapshot(); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, exists, err := store.Get(a.InputKey()); err != nil || exists {
+				t.Errorf("expected no snapshot once the control plane could have been written to. %v", err)
+			}
+		})
+	}
+}
+
+func TestResourceFilterKey(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"settings.yaml": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+  namespace: default
+`,
+		"other.yaml": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: other
+  namespace: default
+`,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	key := func(filter func(*unstructured.Unstructured) bool) string {
+		hydrator := &HydratorReconciler{RootPath: dir, ResourceFilter: filter}
+		if err := hydrator.Load(); err != nil {
+			t.Fatal(err)
+		}
+		return hydrator.InputKey()
+	}
+	all := key(nil)
+	settings := key(func(u *unstructured.Unstructured) bool { return u.GetName() == "settings" })
+	other := key(func(u *unstructured.Unstructured) bool { return u.GetName() == "other" })
+
+	if all == settings || all == other || settings == other {
+		t.Errorf("expected differently filtered runs to have different keys, got %s, %s and %s", all, settings, other)
+	}
+	if keep := key(func(*unstructured.Unstructured) bool { return true }); keep != all {
+		t.Errorf("expected a filter which keeps everything to share the key of an unfiltered run, got %s and %s", keep, all)
+	}
+}
+
+func TestInternalConfig(t *testing.T) {
+	a := &HydratorReconciler{restConfig: &rest.Config{Host: "https://127.0.0.1:6443", UserAgent: "hydrator"}}
+	if userAgent := a.internalConfig().UserAgent; userAgent != changes.InternalUserAgent {
+		t.Errorf("expected users to be provisioned with the user agent the change recorder ignores, got %q", userAgent)
+	}
+	if a.restConfig.UserAgent != "hydrator" {
+		t.Error("expected the admin configuration to be left unchanged")
+	}
+}
+
+func TestUserRBAC(t *testing.T) {
+	role, binding := userRBAC("controller", "must-hydrate:controller", nil)
+	for _, labels := range []map[string]string{role.Labels, binding.Labels} {
+		if labels[ManagedByLabel] != ManagedBy {
+			t.Errorf("expected the RBAC of the user to be labelled as managed by must-hydrate, got %v", labels)
+		}
+	}
+	if binding.RoleRef.Name != role.Name || binding.Subjects[0].Name != "controller" {
+		t.Errorf("expected the role to be bound to the user, got %+v", binding)
+	}
+}
+
+func TestBindErrorWriter(t *testing.T) {
+	var out strings.Builder
+	w := &bindErrorWriter{Writer: &out}
+	fmt.Fprintln(w, "I1019 serving securely on 127.0.0.1:6443")
+	if w.inUse() {
+		t.Fatal("expected no bind error yet")
+	}
+	fmt.Fprintln(w, "E1019 failed to listen on 127.0.0.1:6443: listen tcp 127.0.0.1:6443: bind: address already in use")
+	if !w.inUse() {
+		t.Error("expected the bind error to be noted")
+	}
+	if !strings.Contains(out.String(), "serving securely") {
+		t.Errorf("expected the output to be passed through, got %q", out.String())
+	}
+	w.reset()
+	if w.inUse() {
+		t.Error("expected reset to clear the bind error")
+	}
+}
@@ -0,0 +1,89 @@
+package controller
+
+import (
+	"time"
+)
+
+// HydrationStatus describes the progress of hydrating a must-gather in to the control plane.
+type HydrationStatus struct {
+	// RootPath is the must-gather being hydrated.
+	RootPath string `json:"rootPath"`
+	// Loaded is the number of resources loaded from the must-gather.
+	Loaded int `json:"loaded"`
+	// Remaining is the number of resources which have not yet been applied.
+	Remaining int `json:"remaining"`
+	// RemainingByKind is the number of resources which have not yet been applied keyed by GVK.
+	RemainingByKind map[string]int `json:"remainingByKind,omitempty"`
+	// Passes is the number of reconciliation passes made.
+	Passes int `json:"passes"`
+	// LastPass is when the last reconciliation pass finished.
+	LastPass *time.Time `json:"lastPass,omitempty"`
+	// Converged is true once every resource has been applied.
+	Converged bool `json:"converged"`
+	// Logs is the number of container logs which can be retrieved.
+	Logs int `json:"logs"`
+	// Snapshot is the key of the snapshot the control plane was restored from, if any.
+	Snapshot string `json:"snapshot,omitempty"`
+}
+
+// countResources returns the number of cached resources, in total and keyed by GVK.
+func (a *HydratorReconciler) countResources() (int, map[string]int) {
+	total := 0
+	byKind := map[string]int{}
+	for key, item := range a.gvkCache {
+		if len(item.instances) == 0 {
+			continue
+		}
+		byKind[key] = len(item.instances)
+		total += len(item.instances)
+	}
+	return total, byKind
+}
+
+// recordPass records the outcome of a reconciliation pass.
+func (a *HydratorReconciler) recordPass(converged bool) {
+	remaining, remainingByKind := a.countResources()
+	now := time.Now()
+
+	a.statusLock.Lock()
+	defer a.statusLock.Unlock()
+	a.status.Remaining = remaining
+	a.status.RemainingByKind = remainingByKind
+	a.status.Passes++
+	a.status.LastPass = &now
+	a.status.Converged = converged
+
+	if converged {
+		a.convergedOnce.Do(func() {
+			close(a.convergedChannel())
+		})
+	}
+}
+
+// Converged returns a channel which is closed once every resource has been applied.
+func (a *HydratorReconciler) Converged() <-chan struct{} {
+	a.statusLock.Lock()
+	defer a.statusLock.Unlock()
+	return a.convergedChannel()
+}
+
+// convergedChannel returns the channel closed on convergence. statusLock must be held.
+func (a *HydratorReconciler) convergedChannel() chan struct{} {
+	if a.converged == nil {
+		a.converged = make(chan struct{})
+	}
+	return a.converged
+}
+
+// Status returns the progress of hydrating the must-gather.
+func (a *HydratorReconciler) Status() HydrationStatus {
+	a.statusLock.RLock()
+	defer a.statusLock.RUnlock()
+
+	status := a.status
+	status.RemainingByKind = make(map[string]int, len(a.status.RemainingByKind))
+	for k, v := range a.status.RemainingByKind {
+		status.RemainingByKind[k] = v
+	}
+	return status
+}
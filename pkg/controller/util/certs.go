@@ -91,6 +91,42 @@ func (c *CertificateSigner) GenerateCertificate(ipAddresses ...net.IP) error {
 	return c.PersistToPem(caBytes, caPrivKey)
 }
 
+// GenerateServingCertificate generates a serving certificate, signed by the CA, which is valid for
+// the given DNS names and IP addresses.
+//
+// Returns:
+// - []byte: The PEM encoded certificate.
+// - []byte: The PEM encoded private key.
+// - error: An error if the certificate could not be generated.
+func (c *CertificateSigner) GenerateServingCertificate(dnsNames []string, ipAddresses []net.IP) ([]byte, []byte, error) {
+	cert := templateCA()
+	cert.SerialNumber = big.NewInt(time.Now().UnixNano())
+	cert.Subject.CommonName = "localhost"
+	cert.IsCA = false
+	cert.KeyUsage = x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
+	cert.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	cert.DNSNames = dnsNames
+	cert.IPAddresses = ipAddresses
+
+	privKey, err := rsa.GenerateKey(rand.Reader, 4096)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to generate serving private key. %v", err)
+	}
+
+	certBytes, err := x509.CreateCertificate(rand.Reader, cert, c.ca, &privKey.PublicKey, c.caPrivateKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to generate serving certificate. %v", err)
+	}
+
+	return c.GetPEMs(certBytes, privKey)
+}
+
+// CAPEM returns the PEM encoded CA certificate.
+func (c *CertificateSigner) CAPEM() ([]byte, error) {
+	caPem, _, err := c.GetPEMs(c.caBytes, c.caPrivateKey)
+	return caPem, err
+}
+
 func (c *CertificateSigner) GetPEMs(caBytes []byte, caPrivKey *rsa.PrivateKey) ([]byte, []byte, error) {
 	caPEM := new(bytes.Buffer)
 	err := pem.Encode(caPEM, &pem.Block{
@@ -118,6 +154,10 @@ func (c *CertificateSigner) PersistCAToPem() error {
 	if err != nil {
 		return fmt.Errorf("unable to convert certificate media to PEM. %v", err)
 	}
+	err = os.MkdirAll(c.RootPath, 0700)
+	if err != nil {
+		return fmt.Errorf("unable to create certificate directory. %v", err)
+	}
 	err = os.WriteFile(path.Join(c.RootPath, "ca.pem"), certPem, 0644)
 	if err != nil {
 		return fmt.Errorf("unable to write CA certificate PEM. %v", err)
@@ -136,7 +176,7 @@ func (c *CertificateSigner) PersistToPem(certBytes []byte, privKey *rsa.PrivateK
 	if err != nil {
 		return fmt.Errorf("unable to write certificate PEM. %v", err)
 	}
-	err = os.WriteFile(path.Join(c.RootPath, "key.pem"), keyPem, 0644)
+	err = os.WriteFile(path.Join(c.RootPath, "key.pem"), keyPem, 0600)
 	if err != nil {
 		return fmt.Errorf("unable to write key PEM. %v", err)
 	}
@@ -1,6 +1,10 @@
 package util
 
 import (
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path"
 	"testing"
 )
 
@@ -21,3 +25,36 @@ func TestGenerateCACertificate(t *testing.T) {
 	}
 
 }
+
+func TestWriteAPIServerCerts(t *testing.T) {
+	certDir := t.TempDir()
+
+	caPem, err := WriteAPIServerCerts(certDir, "0.0.0.0", "must-hydrate.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPem, err := os.ReadFile(path.Join(certDir, "apiserver.crt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(certPem)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(caPem)
+	for _, name := range []string{"localhost", "127.0.0.1", "0.0.0.0", "must-hydrate.example.com"} {
+		if _, err := cert.Verify(x509.VerifyOptions{DNSName: name, Roots: roots}); err != nil {
+			t.Errorf("expected the serving certificate to be valid for %s. %v", name, err)
+		}
+	}
+
+	for _, name := range []string{"apiserver.key", "sa-signer.crt", "sa-signer.key"} {
+		if _, err := os.Stat(path.Join(certDir, name)); err != nil {
+			t.Errorf("expected %s to be written. %v", name, err)
+		}
+	}
+}
@@ -1,7 +1,7 @@
 package util
 
 import (
-	"sync"
+	"context"
 	"time"
 
 	"github.com/pkg/errors"
@@ -16,45 +16,45 @@ import (
 	"k8s.io/client-go/restmapper"
 )
 
-type resourceClientFactory struct {
+// ResourceClientFactory returns dynamic clients for the resources of a control plane. Each
+// control plane needs its own factory.
+type ResourceClientFactory struct {
 	dynamicClient dynamic.Interface
 	restMapper    *restmapper.DeferredDiscoveryRESTMapper
 }
 
-var (
-	// this stores the singleton in a package local
-	singletonFactory *resourceClientFactory
-	once             sync.Once
-)
-
-// Private constructor for once.Do
-func newSingletonFactory(config *rest.Config) func() {
-	return func() {
-		cachedDiscoveryClient := memory.NewMemCacheClient(kubernetes.NewForConfigOrDie(config).Discovery())
-		restMapper := restmapper.NewDeferredDiscoveryRESTMapper(cachedDiscoveryClient)
-		restMapper.Reset()
+// NewResourceClientFactory returns a factory for the control plane of config. The cached
+// discovery information is refreshed periodically until ctx is done.
+func NewResourceClientFactory(ctx context.Context, config *rest.Config) (*ResourceClientFactory, error) {
+	clientSet, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create the discovery client")
+	}
+	cachedDiscoveryClient := memory.NewMemCacheClient(clientSet.Discovery())
+	restMapper := restmapper.NewDeferredDiscoveryRESTMapper(cachedDiscoveryClient)
+	restMapper.Reset()
 
-		dynamicClient, err := dynamic.NewForConfig(config)
-		if err != nil {
-			panic(err)
-		}
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create the dynamic client")
+	}
 
-		singletonFactory = &resourceClientFactory{
-			dynamicClient: dynamicClient,
-			restMapper:    restMapper,
-		}
-		singletonFactory.runBackgroundCacheReset(1 * time.Minute)
+	factory := &ResourceClientFactory{
+		dynamicClient: dynamicClient,
+		restMapper:    restMapper,
 	}
+	factory.runBackgroundCacheReset(ctx, 1*time.Minute)
+	return factory, nil
 }
 
-// New returns the resource client using a singleton factory
-func New(config *rest.Config, gvk schema.GroupVersionKind, namespace string) (dynamic.ResourceInterface, error) {
-	once.Do(newSingletonFactory(config))
-	return singletonFactory.getResourceClient(gvk, namespace)
+// New returns the resource client for the gvk in namespace. The namespace is ignored for
+// cluster scoped resources.
+func (c *ResourceClientFactory) New(gvk schema.GroupVersionKind, namespace string) (dynamic.ResourceInterface, error) {
+	return c.getResourceClient(gvk, namespace)
 }
 
 // getResourceClient returns the dynamic client for the resource specified by the gvk.
-func (c *resourceClientFactory) getResourceClient(gvk schema.GroupVersionKind, namespace string) (dynamic.ResourceInterface, error) {
+func (c *ResourceClientFactory) getResourceClient(gvk schema.GroupVersionKind, namespace string) (dynamic.ResourceInterface, error) {
 	var (
 		gvr        *schema.GroupVersionResource
 		namespaced bool
@@ -93,12 +93,18 @@ func gvkToGVR(gvk schema.GroupVersionKind, restMapper *restmapper.DeferredDiscov
 }
 
 // runBackgroundCacheReset - Starts the rest mapper cache reseting
-// at a duration given.
-func (c *resourceClientFactory) runBackgroundCacheReset(duration time.Duration) {
+// at a duration given until ctx is done.
+func (c *ResourceClientFactory) runBackgroundCacheReset(ctx context.Context, duration time.Duration) {
 	ticker := time.NewTicker(duration)
 	go func() {
-		for range ticker.C {
-			c.restMapper.Reset()
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				c.restMapper.Reset()
+			}
 		}
 	}()
 }
@@ -1,7 +1,12 @@
 package util
 
 import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
 	"fmt"
+	"net"
 	"os"
 	"path"
 
@@ -23,49 +28,217 @@ func IsGvk(a schema.GroupVersionKind, b schema.GroupVersionKind) bool {
 		a.Version == b.Version
 }
 
-// WriteKubeconfig writes a kubeconfig file to the specified path.
+// BuildKubeconfig returns a kubeconfig for the configuration with a cluster and context named
+// after the hydrated cluster.
+//
+// Parameters:
+// - cfg: The configuration of the hydrated cluster.
+// - name: The name of the cluster and context.
+//
+// Returns:
+// - *api.Config: The kubeconfig.
+func BuildKubeconfig(cfg *rest.Config, name string) *api.Config {
+	userName := fmt.Sprintf("%s@%s", cfg.Username, name)
+	c := api.NewConfig()
+	c.Clusters[name] = &api.Cluster{
+		Server:                   cfg.Host,
+		CertificateAuthorityData: cfg.CAData,
+	}
+	c.AuthInfos[userName] = &api.AuthInfo{
+		ClientKeyData:         cfg.KeyData,
+		ClientCertificateData: cfg.CertData,
+	}
+	c.Contexts[name] = &api.Context{
+		Cluster:  name,
+		AuthInfo: userName,
+	}
+	c.CurrentContext = name
+	return c
+}
+
+// WriteKubeconfig writes a kubeconfig file, readable only by the current user, to the specified path.
 //
 // Parameters:
 // - cfg: The configuration to write to the kubeconfig file.
-// - outPath: The path to write the kubeconfig file to.
+// - name: The name of the cluster and context.
+// - kubeconfigPath: The path of the kubeconfig file.
 //
 // Returns:
 // - error: An error if the kubeconfig file could not be written.
-func WriteKubeconfig(cfg *rest.Config, outPath string) error {
-	clusterName := "envtest"
-	contextName := fmt.Sprintf("%s@%s", cfg.Username, clusterName)
-	c := api.Config{
-		Clusters: map[string]*api.Cluster{
-			clusterName: {
-				Server:                   cfg.Host,
-				CertificateAuthorityData: cfg.CAData,
-			},
-		},
-		Contexts: map[string]*api.Context{
-			contextName: {
-				Cluster:  clusterName,
-				AuthInfo: cfg.Username,
-			},
-		},
-		AuthInfos: map[string]*api.AuthInfo{
-			cfg.Username: {
-				ClientKeyData:         cfg.KeyData,
-				ClientCertificateData: cfg.CertData,
-			},
-		},
-		CurrentContext: contextName,
-	}
-	data, err := clientcmd.Write(c)
+func WriteKubeconfig(cfg *rest.Config, name string, kubeconfigPath string) error {
+	err := clientcmd.WriteToFile(*BuildKubeconfig(cfg, name), kubeconfigPath)
 	if err != nil {
-		return fmt.Errorf("unable to write kubeconfig. %v", err)
+		return fmt.Errorf("unable to write kubeconfig to disk. %v", err)
 	}
+	// WriteToFile does not change the permissions of an existing file
+	if err := os.Chmod(kubeconfigPath, 0600); err != nil {
+		return fmt.Errorf("unable to set kubeconfig permissions. %v", err)
+	}
+	return nil
+}
 
-	err = os.WriteFile(path.Join(outPath, "envtest.kubeconfig"), data, 0666)
+// MergeKubeconfig adds the cluster, user and context of the configuration to an existing kubeconfig
+// file, creating the file if it does not exist. The current context of the file is not changed.
+//
+// Parameters:
+// - cfg: The configuration to merge in to the kubeconfig file.
+// - name: The name of the cluster and context.
+// - kubeconfigPath: The path of the kubeconfig file.
+//
+// Returns:
+// - error: An error if the kubeconfig file could not be updated.
+func MergeKubeconfig(cfg *rest.Config, name string, kubeconfigPath string) error {
+	existing, err := loadKubeconfig(kubeconfigPath)
 	if err != nil {
+		return err
+	}
+
+	merged := BuildKubeconfig(cfg, name)
+	for k, v := range merged.Clusters {
+		existing.Clusters[k] = v
+	}
+	for k, v := range merged.AuthInfos {
+		existing.AuthInfos[k] = v
+	}
+	for k, v := range merged.Contexts {
+		existing.Contexts[k] = v
+	}
+
+	if err := clientcmd.WriteToFile(*existing, kubeconfigPath); err != nil {
 		return fmt.Errorf("unable to write kubeconfig to disk. %v", err)
 	}
-	if _, err := os.Stat("/data"); err == nil {
-		_ = os.WriteFile("/data/envtest.kubeconfig", data, 0666)
+	return nil
+}
+
+// RemoveKubeconfigContext removes a context, and the cluster and user it references, from a
+// kubeconfig file.
+//
+// Parameters:
+// - name: The name of the context.
+// - kubeconfigPath: The path of the kubeconfig file.
+//
+// Returns:
+// - error: An error if the kubeconfig file could not be updated.
+func RemoveKubeconfigContext(name string, kubeconfigPath string) error {
+	existing, err := loadKubeconfig(kubeconfigPath)
+	if err != nil {
+		return err
+	}
+
+	context, exists := existing.Contexts[name]
+	if !exists {
+		return nil
+	}
+	delete(existing.Clusters, context.Cluster)
+	delete(existing.AuthInfos, context.AuthInfo)
+	delete(existing.Contexts, name)
+	if existing.CurrentContext == name {
+		existing.CurrentContext = ""
+	}
+
+	if err := clientcmd.WriteToFile(*existing, kubeconfigPath); err != nil {
+		return fmt.Errorf("unable to write kubeconfig to disk. %v", err)
 	}
 	return nil
 }
+
+func loadKubeconfig(kubeconfigPath string) (*api.Config, error) {
+	existing, err := clientcmd.LoadFromFile(kubeconfigPath)
+	if os.IsNotExist(err) {
+		return api.NewConfig(), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to load kubeconfig %s. %v", kubeconfigPath, err)
+	}
+	return existing, nil
+}
+
+const egressSelectorConfigTemplate = `apiVersion: apiserver.k8s.io/v1beta1
+kind: EgressSelectorConfiguration
+egressSelections:
+- name: cluster
+  connection:
+    proxyProtocol: HTTPConnect
+    transport:
+      tcp:
+        url: %s
+`
+
+// WriteEgressSelectorConfig writes an EgressSelectorConfiguration which sends all of the
+// API server's cluster bound traffic (i.e. kubelet connections) through an HTTP CONNECT proxy.
+//
+// Parameters:
+// - proxyURL: The URL of the HTTP CONNECT proxy.
+// - outPath: The path to write the configuration file to.
+//
+// Returns:
+// - string: The path of the written configuration file.
+// - error: An error if the configuration file could not be written.
+func WriteEgressSelectorConfig(proxyURL string, outPath string) (string, error) {
+	configPath := path.Join(outPath, "egress-selector.yaml")
+	err := os.WriteFile(configPath, []byte(fmt.Sprintf(egressSelectorConfigTemplate, proxyURL)), 0644)
+	if err != nil {
+		return "", fmt.Errorf("unable to write egress selector configuration to disk. %v", err)
+	}
+	return configPath, nil
+}
+
+// WriteAPIServerCerts writes the serving certificate, and service account signing keys, of an
+// envtest API server to certDir. The serving certificate is valid for localhost and the provided
+// names, which may be DNS names or IP addresses.
+//
+// Parameters:
+// - certDir: The certificate directory of the API server.
+// - names: Additional subject alternative names for the serving certificate.
+//
+// Returns:
+// - []byte: The PEM encoded CA which signed the serving certificate.
+// - error: An error if the certificates could not be written.
+func WriteAPIServerCerts(certDir string, names ...string) ([]byte, error) {
+	signer := &CertificateSigner{
+		RootPath: certDir,
+	}
+	if err := signer.Initialize(); err != nil {
+		return nil, fmt.Errorf("unable to initialize the certificate signer. %v", err)
+	}
+
+	dnsNames := []string{"localhost"}
+	ipAddresses := []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback}
+	for _, name := range names {
+		if ip := net.ParseIP(name); ip != nil {
+			ipAddresses = append(ipAddresses, ip)
+		} else if len(name) > 0 {
+			dnsNames = append(dnsNames, name)
+		}
+	}
+
+	certPem, keyPem, err := signer.GenerateServingCertificate(dnsNames, ipAddresses)
+	if err != nil {
+		return nil, err
+	}
+
+	saKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate service account signing key. %v", err)
+	}
+	saPublicKey, err := x509.MarshalPKIXPublicKey(&saKey.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal service account public key. %v", err)
+	}
+	saCertPem := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: saPublicKey})
+	saKeyPem := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(saKey)})
+
+	files := map[string][]byte{
+		"apiserver.crt": certPem,
+		"apiserver.key": keyPem,
+		"sa-signer.crt": saCertPem,
+		"sa-signer.key": saKeyPem,
+	}
+	for name, data := range files {
+		if err := os.WriteFile(path.Join(certDir, name), data, 0600); err != nil {
+			return nil, fmt.Errorf("unable to write %s. %v", name, err)
+		}
+	}
+
+	return signer.CAPEM()
+}
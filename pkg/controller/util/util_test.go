@@ -0,0 +1,60 @@
+package util
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+func TestMergeKubeconfig(t *testing.T) {
+	kubeconfigPath := path.Join(t.TempDir(), "config")
+
+	existing := api.NewConfig()
+	existing.Clusters["prod"] = &api.Cluster{Server: "https://prod:6443"}
+	existing.AuthInfos["admin"] = &api.AuthInfo{Token: "token"}
+	existing.Contexts["prod"] = &api.Context{Cluster: "prod", AuthInfo: "admin"}
+	existing.CurrentContext = "prod"
+	if err := clientcmd.WriteToFile(*existing, kubeconfigPath); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &rest.Config{Host: "https://127.0.0.1:6443", Username: "envtest-admin"}
+	if err := MergeKubeconfig(cfg, "customer-a-x7k2p", kubeconfigPath); err != nil {
+		t.Fatal(err)
+	}
+
+	merged, err := clientcmd.LoadFromFile(kubeconfigPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if merged.CurrentContext != "prod" {
+		t.Errorf("expected the current context to be unchanged, got %s", merged.CurrentContext)
+	}
+	context, exists := merged.Contexts["customer-a-x7k2p"]
+	if !exists || merged.Clusters[context.Cluster].Server != cfg.Host {
+		t.Fatalf("expected the customer-a-x7k2p context to be merged, got %v", merged.Contexts)
+	}
+
+	if err := RemoveKubeconfigContext("customer-a-x7k2p", kubeconfigPath); err != nil {
+		t.Fatal(err)
+	}
+	cleaned, err := clientcmd.LoadFromFile(kubeconfigPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cleaned.Contexts) != 1 || len(cleaned.Clusters) != 1 || len(cleaned.AuthInfos) != 1 {
+		t.Errorf("expected only the prod entries to remain, got %v", cleaned.Contexts)
+	}
+
+	info, err := os.Stat(kubeconfigPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("expected kubeconfig to be readable only by its owner, got %v", info.Mode().Perm())
+	}
+}
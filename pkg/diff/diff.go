@@ -0,0 +1,309 @@
+package diff
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/openshift-splat-team/must-hydrate/pkg/controller/util"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// ChangeType describes how an object differs between two must-gathers.
+type ChangeType string
+
+const (
+	Added   ChangeType = "Added"
+	Removed ChangeType = "Removed"
+	Changed ChangeType = "Changed"
+)
+
+// volatileMetadataFields are the fields of .metadata assigned by the API server, which change
+// without the state of the cluster changing.
+var volatileMetadataFields = map[string]bool{
+	"resourceVersion":   true,
+	"managedFields":     true,
+	"creationTimestamp": true,
+	"uid":               true,
+	"generation":        true,
+}
+
+// volatileConditionFields are the fields of the entries of .status.conditions which change without
+// the state of the cluster changing, such as the heartbeats of node conditions.
+var volatileConditionFields = map[string]bool{
+	"observedGeneration": true,
+	"lastHeartbeatTime":  true,
+	"lastProbeTime":      true,
+	"lastTransitionTime": true,
+	"lastUpdateTime":     true,
+}
+
+// conditionPath matches the path of an entry of .status.conditions.
+var conditionPath = regexp.MustCompile(`^\.status\.conditions\[[^\]]*\]$`)
+
+// listKeys are the fields used, in order of preference, to match the items of lists of objects so
+// that a reordered list is not reported as changed.
+var listKeys = []string{"name", "type"}
+
+// FieldChange is a field which differs between two versions of an object.
+type FieldChange struct {
+	// Path locates the field, such as .status.conditions[type=Available].status.
+	Path string `json:"path"`
+	// Type is Added when the field is only in the second must-gather, Removed when it is only in
+	// the first, and Changed when its value differs, including to or from null.
+	Type ChangeType `json:"type"`
+	// From is the value in the first must-gather. It is null when the field was added.
+	From any `json:"from"`
+	// To is the value in the second must-gather. It is null when the field was removed.
+	To any `json:"to"`
+}
+
+// HasFrom returns true if the field is in the first must-gather.
+func (f FieldChange) HasFrom() bool {
+	return f.Type != Added
+}
+
+// HasTo returns true if the field is in the second must-gather.
+func (f FieldChange) HasTo() bool {
+	return f.Type != Removed
+}
+
+// ObjectChange is an object which differs between two must-gathers.
+type ObjectChange struct {
+	Type      ChangeType    `json:"type"`
+	GVK       string        `json:"gvk"`
+	Namespace string        `json:"namespace,omitempty"`
+	Name      string        `json:"name"`
+	Fields    []FieldChange `json:"fields,omitempty"`
+}
+
+// Result is the difference between two must-gathers.
+type Result struct {
+	From    string         `json:"from"`
+	To      string         `json:"to"`
+	Changes []ObjectChange `json:"changes"`
+}
+
+// Summary counts the changes of each type.
+func (r *Result) Summary() map[ChangeType]int {
+	summary := map[ChangeType]int{}
+	for _, change := range r.Changes {
+		summary[change.Type]++
+	}
+	return summary
+}
+
+type objectKey struct {
+	gvk       string
+	namespace string
+	name      string
+}
+
+func keyOf(obj *unstructured.Unstructured) objectKey {
+	return objectKey{
+		gvk:       util.GetGvkKey(obj.GroupVersionKind()),
+		namespace: obj.GetNamespace(),
+		name:      obj.GetName(),
+	}
+}
+
+// Compare returns the objects which were added, removed or changed between the from and to
+// must-gathers, ordered by GVK, namespace and name. Objects should already be normalised as they
+// are for hydration.
+func Compare(from []*unstructured.Unstructured, to []*unstructured.Unstructured) *Result {
+	fromObjects := map[objectKey]*unstructured.Unstructured{}
+	for _, obj := range from {
+		fromObjects[keyOf(obj)] = obj
+	}
+	toObjects := map[objectKey]*unstructured.Unstructured{}
+	for _, obj := range to {
+		toObjects[keyOf(obj)] = obj
+	}
+
+	result := &Result{
+		Changes: []ObjectChange{},
+	}
+	for key, fromObj := range fromObjects {
+		change := ObjectChange{
+			GVK:       key.gvk,
+			Namespace: key.namespace,
+			Name:      key.name,
+		}
+		toObj, exists := toObjects[key]
+		if !exists {
+			change.Type = Removed
+			result.Changes = append(result.Changes, change)
+			continue
+		}
+		change.Fields = compareValues("", fromObj.Object, toObj.Object, nil)
+		if len(change.Fields) > 0 {
+			change.Type = Changed
+			result.Changes = append(result.Changes, change)
+		}
+	}
+	for key := range toObjects {
+		if _, exists := fromObjects[key]; !exists {
+			result.Changes = append(result.Changes, ObjectChange{
+				Type:      Added,
+				GVK:       key.gvk,
+				Namespace: key.namespace,
+				Name:      key.name,
+			})
+		}
+	}
+
+	sort.Slice(result.Changes, func(i, j int) bool {
+		a, b := result.Changes[i], result.Changes[j]
+		if a.GVK != b.GVK {
+			return a.GVK < b.GVK
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+	return result
+}
+
+// compareValues appends the fields which differ between from and to, which are found at path.
+func compareValues(path string, from any, to any, changes []FieldChange) []FieldChange {
+	switch fromValue := from.(type) {
+	case map[string]any:
+		if toValue, ok := to.(map[string]any); ok {
+			return compareMaps(path, fromValue, toValue, changes)
+		}
+	case []any:
+		if toValue, ok := to.([]any); ok {
+			return compareLists(path, fromValue, toValue, changes)
+		}
+	}
+
+	if !reflect.DeepEqual(from, to) {
+		changes = append(changes, FieldChange{Path: path, Type: Changed, From: from, To: to})
+	}
+	return changes
+}
+
+func compareMaps(path string, from map[string]any, to map[string]any, changes []FieldChange) []FieldChange {
+	keys := map[string]bool{}
+	for key := range from {
+		keys[key] = true
+	}
+	for key := range to {
+		keys[key] = true
+	}
+	sortedKeys := make([]string, 0, len(keys))
+	for key := range keys {
+		if !isVolatile(path, key) {
+			sortedKeys = append(sortedKeys, key)
+		}
+	}
+	sort.Strings(sortedKeys)
+
+	for _, key := range sortedKeys {
+		fieldPath := path + "." + key
+		if strings.ContainsAny(key, ".[]") {
+			fieldPath = fmt.Sprintf("%s[%q]", path, key)
+		}
+
+		fromValue, inFrom := from[key]
+		toValue, inTo := to[key]
+		switch {
+		case !inFrom:
+			changes = append(changes, FieldChange{Path: fieldPath, Type: Added, To: toValue})
+		case !inTo:
+			changes = append(changes, FieldChange{Path: fieldPath, Type: Removed, From: fromValue})
+		default:
+			changes = compareValues(fieldPath, fromValue, toValue, changes)
+		}
+	}
+	return changes
+}
+
+// isVolatile returns true if the field key of the object at path is volatile: a field of .metadata
+// assigned by the API server, or a timestamp of a condition.
+func isVolatile(path string, key string) bool {
+	if path == ".metadata" {
+		return volatileMetadataFields[key]
+	}
+	return volatileConditionFields[key] && conditionPath.MatchString(path)
+}
+
+// compareLists matches the items of lists of objects by their name or type, and the items of
+// any other list by their position.
+func compareLists(path string, from []any, to []any, changes []FieldChange) []FieldChange {
+	key := commonListKey(from, to)
+	if len(key) == 0 {
+		for i := 0; i < len(from) || i < len(to); i++ {
+			itemPath := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i >= len(from):
+				changes = append(changes, FieldChange{Path: itemPath, Type: Added, To: to[i]})
+			case i >= len(to):
+				changes = append(changes, FieldChange{Path: itemPath, Type: Removed, From: from[i]})
+			default:
+				changes = compareValues(itemPath, from[i], to[i], changes)
+			}
+		}
+		return changes
+	}
+
+	toItems := map[string]any{}
+	for _, item := range to {
+		toItems[fmt.Sprint(item.(map[string]any)[key])] = item
+	}
+	fromItems := map[string]bool{}
+	for _, item := range from {
+		value := fmt.Sprint(item.(map[string]any)[key])
+		fromItems[value] = true
+		itemPath := fmt.Sprintf("%s[%s=%s]", path, key, value)
+		if toItem, exists := toItems[value]; exists {
+			changes = compareValues(itemPath, item, toItem, changes)
+		} else {
+			changes = append(changes, FieldChange{Path: itemPath, Type: Removed, From: item})
+		}
+	}
+	for _, item := range to {
+		value := fmt.Sprint(item.(map[string]any)[key])
+		if !fromItems[value] {
+			changes = append(changes, FieldChange{Path: fmt.Sprintf("%s[%s=%s]", path, key, value), Type: Added, To: item})
+		}
+	}
+	return changes
+}
+
+// commonListKey returns the field which uniquely identifies every item of both lists, or an empty
+// string if there is none.
+func commonListKey(from []any, to []any) string {
+	if len(from) == 0 && len(to) == 0 {
+		return ""
+	}
+	for _, key := range listKeys {
+		unique := true
+		for _, list := range [][]any{from, to} {
+			seen := map[string]bool{}
+			for _, item := range list {
+				obj, ok := item.(map[string]any)
+				if !ok {
+					unique = false
+					break
+				}
+				value, ok := obj[key].(string)
+				if !ok || seen[value] {
+					unique = false
+					break
+				}
+				seen[value] = true
+			}
+			if !unique {
+				break
+			}
+		}
+		if unique {
+			return key
+		}
+	}
+	return ""
+}
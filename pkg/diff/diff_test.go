@@ -0,0 +1,189 @@
+package diff
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func node(name string, ready string, heartbeat string, labels map[string]any) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "v1",
+		"kind":       "Node",
+		"metadata": map[string]any{
+			"name":            name,
+			"resourceVersion": heartbeat,
+			"labels":          labels,
+		},
+		"status": map[string]any{
+			"conditions": []any{
+				map[string]any{"type": "MemoryPressure", "status": "False", "lastHeartbeatTime": heartbeat},
+				map[string]any{"type": "Ready", "status": ready, "lastHeartbeatTime": heartbeat},
+			},
+		},
+	}}
+}
+
+func TestCompare(t *testing.T) {
+	from := []*unstructured.Unstructured{
+		node("a", "True", "1", map[string]any{"role": "master"}),
+		node("b", "True", "1", nil),
+		node("c", "True", "1", nil),
+	}
+	to := []*unstructured.Unstructured{
+		node("a", "False", "2", map[string]any{"role": "master", "zone": "z1"}),
+		node("b", "True", "2", nil),
+		node("d", "True", "1", nil),
+	}
+	// reordering conditions is not a change
+	conditions := to[1].Object["status"].(map[string]any)["conditions"].([]any)
+	conditions[0], conditions[1] = conditions[1], conditions[0]
+
+	result := Compare(from, to)
+
+	if len(result.Changes) != 3 {
+		t.Fatalf("expected 3 changes, got %+v", result.Changes)
+	}
+	expected := []struct {
+		name       string
+		changeType ChangeType
+	}{
+		{"a", Changed},
+		{"c", Removed},
+		{"d", Added},
+	}
+	for i, e := range expected {
+		if result.Changes[i].Name != e.name || result.Changes[i].Type != e.changeType {
+			t.Errorf("expected %s to be %s, got %+v", e.name, e.changeType, result.Changes[i])
+		}
+	}
+
+	fields := map[string]FieldChange{}
+	for _, field := range result.Changes[0].Fields {
+		fields[field.Path] = field
+	}
+	if len(fields) != 2 {
+		t.Errorf("expected 2 field changes, got %+v", result.Changes[0].Fields)
+	}
+	if field, ok := fields[".metadata.labels.zone"]; !ok || field.From != nil || field.To != "z1" {
+		t.Errorf("expected the zone label to be added, got %+v", fields)
+	}
+	if field, ok := fields[".status.conditions[type=Ready].status"]; !ok || field.From != "True" || field.To != "False" {
+		t.Errorf("expected the Ready condition to change, got %+v", fields)
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	result := Compare(
+		[]*unstructured.Unstructured{node("a", "True", "1", nil)},
+		[]*unstructured.Unstructured{node("a", "False", "1", nil)},
+	)
+	result.From, result.To = "before", "after"
+
+	var out bytes.Buffer
+	if err := result.WriteText(&out); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"--- before\n+++ after\n",
+		"~ a\n",
+		"    - .status.conditions[type=Ready].status: True\n",
+		"    + .status.conditions[type=Ready].status: False\n",
+		"0 added, 0 removed, 1 changed\n",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("expected %q in output:\n%s", expected, out.String())
+		}
+	}
+
+	out.Reset()
+	if err := result.WriteHTML(&out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), `<tr class="Changed">`) {
+		t.Errorf("expected a changed row in output:\n%s", out.String())
+	}
+}
+
+func TestCompareVolatileScope(t *testing.T) {
+	object := func(uid string, generation int64, progressed string) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]any{
+			"apiVersion": "v1",
+			"kind":       "Widget",
+			"metadata":   map[string]any{"name": "w", "uid": uid, "generation": generation},
+			"spec": map[string]any{
+				"owner":    map[string]any{"uid": uid},
+				"template": map[string]any{"metadata": map[string]any{"generation": generation}},
+			},
+			"status": map[string]any{
+				"lastUpdateTime": progressed,
+				"conditions": []any{
+					map[string]any{"type": "Ready", "status": "True", "lastTransitionTime": progressed},
+				},
+			},
+		}}
+	}
+
+	result := Compare(
+		[]*unstructured.Unstructured{object("1", 1, "a")},
+		[]*unstructured.Unstructured{object("2", 2, "b")},
+	)
+	if len(result.Changes) != 1 {
+		t.Fatalf("expected 1 change, got %+v", result.Changes)
+	}
+	var paths []string
+	for _, field := range result.Changes[0].Fields {
+		paths = append(paths, field.Path)
+	}
+	expected := []string{".spec.owner.uid", ".spec.template.metadata.generation", ".status.lastUpdateTime"}
+	if strings.Join(paths, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected only fields outside .metadata and the conditions to be compared, got %v", paths)
+	}
+}
+
+func TestCompareNull(t *testing.T) {
+	object := func(spec map[string]any) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]any{
+			"apiVersion": "v1",
+			"kind":       "Widget",
+			"metadata":   map[string]any{"name": "w"},
+			"spec":       spec,
+		}}
+	}
+
+	result := Compare(
+		[]*unstructured.Unstructured{object(map[string]any{"replicas": int64(1), "paused": true})},
+		[]*unstructured.Unstructured{object(map[string]any{"replicas": nil})},
+	)
+	if len(result.Changes) != 1 {
+		t.Fatalf("expected 1 change, got %+v", result.Changes)
+	}
+	fields := map[string]FieldChange{}
+	for _, field := range result.Changes[0].Fields {
+		fields[field.Path] = field
+	}
+	if field := fields[".spec.replicas"]; field.Type != Changed || !field.HasTo() || field.To != nil {
+		t.Errorf("expected replicas to be set to null, got %+v", field)
+	}
+	if field := fields[".spec.paused"]; field.Type != Removed || field.HasTo() {
+		t.Errorf("expected paused to be removed, got %+v", field)
+	}
+
+	var out bytes.Buffer
+	if err := result.WriteText(&out); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"    - .spec.replicas: 1\n    + .spec.replicas: null\n",
+		"    - .spec.paused: true\n",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("expected %q in output:\n%s", expected, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "+ .spec.paused") {
+		t.Errorf("expected no value for the removed field:\n%s", out.String())
+	}
+}
@@ -0,0 +1,114 @@
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+)
+
+// WriteText writes the changes in a form similar to a unified diff.
+func (r *Result) WriteText(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", r.From, r.To)
+
+	gvk := ""
+	for _, change := range r.Changes {
+		if change.GVK != gvk {
+			gvk = change.GVK
+			fmt.Fprintf(&b, "\n%s\n", gvk)
+		}
+		switch change.Type {
+		case Added:
+			fmt.Fprintf(&b, "+ %s\n", objectName(change))
+		case Removed:
+			fmt.Fprintf(&b, "- %s\n", objectName(change))
+		case Changed:
+			fmt.Fprintf(&b, "~ %s\n", objectName(change))
+			for _, field := range change.Fields {
+				if field.HasFrom() {
+					fmt.Fprintf(&b, "    - %s: %s\n", field.Path, FormatValue(field.From))
+				}
+				if field.HasTo() {
+					fmt.Fprintf(&b, "    + %s: %s\n", field.Path, FormatValue(field.To))
+				}
+			}
+		}
+	}
+
+	summary := r.Summary()
+	fmt.Fprintf(&b, "\n%d added, %d removed, %d changed\n", summary[Added], summary[Removed], summary[Changed])
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteJSON writes the result as indented JSON.
+func (r *Result) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+var htmlTemplate = template.Must(template.New("diff").Funcs(template.FuncMap{
+	"name":   objectName,
+	"format": FormatValue,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.From}} / {{.To}}</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; width: 100%; }
+td, th { border: 1px solid #ccc; padding: 4px; text-align: left; vertical-align: top; }
+pre { margin: 0; white-space: pre-wrap; }
+.Added { background: #e6ffec; }
+.Removed { background: #ffebe9; }
+.Changed { background: #fff8c5; }
+</style>
+</head>
+<body>
+<h1>{{.From}} / {{.To}}</h1>
+<table>
+<tr><th>Change</th><th>GVK</th><th>Object</th><th>Fields</th></tr>
+{{- range .Changes}}
+<tr class="{{.Type}}">
+<td>{{.Type}}</td>
+<td>{{.GVK}}</td>
+<td>{{name .}}</td>
+<td>{{if .Fields}}<table>
+{{- range .Fields}}
+<tr><td><code>{{.Path}}</code></td><td><pre>{{if .HasFrom}}{{format .From}}{{end}}</pre></td><td><pre>{{if .HasTo}}{{format .To}}{{end}}</pre></td></tr>
+{{- end}}
+</table>{{end}}</td>
+</tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
+
+// WriteHTML writes the result as a standalone HTML page.
+func (r *Result) WriteHTML(w io.Writer) error {
+	return htmlTemplate.Execute(w, r)
+}
+
+// FormatValue formats a field value on a single line.
+func FormatValue(value any) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
+
+func objectName(change ObjectChange) string {
+	if len(change.Namespace) == 0 {
+		return change.Name
+	}
+	return change.Namespace + "/" + change.Name
+}
@@ -0,0 +1,230 @@
+package export
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// podSpecPaths are the paths of the pod specs of the kinds which run pods. Jobs are not hydrated,
+// so they are left out.
+var podSpecPaths = map[schema.GroupKind][]string{
+	{Kind: "Pod"}:                                          {"spec"},
+	{Kind: "ReplicationController"}:                        {"spec", "template", "spec"},
+	{Kind: "PodTemplate"}:                                  {"template", "spec"},
+	{Group: "apps", Kind: "Deployment"}:                    {"spec", "template", "spec"},
+	{Group: "apps", Kind: "ReplicaSet"}:                    {"spec", "template", "spec"},
+	{Group: "apps", Kind: "DaemonSet"}:                     {"spec", "template", "spec"},
+	{Group: "apps", Kind: "StatefulSet"}:                   {"spec", "template", "spec"},
+	{Group: "batch", Kind: "CronJob"}:                      {"spec", "jobTemplate", "spec", "template", "spec"},
+	{Group: "apps.openshift.io", Kind: "DeploymentConfig"}: {"spec", "template", "spec"},
+}
+
+// objectKey identifies an object by group, kind, namespace and name. Gathered objects have no
+// UIDs once loaded, so owners are identified by their key.
+type objectKey struct {
+	group     string
+	kind      string
+	namespace string
+	name      string
+}
+
+func keyOf(obj *unstructured.Unstructured) objectKey {
+	gvk := obj.GroupVersionKind()
+	return objectKey{group: gvk.Group, kind: gvk.Kind, namespace: obj.GetNamespace(), name: obj.GetName()}
+}
+
+// Closure returns the roots and the objects they depend on, in the order of objects, so that
+// they can be hydrated or exported as a self-contained set. From the roots it follows:
+//
+//   - the objects they own, and the objects those own
+//   - their owners, and the owners of those
+//   - their namespaces
+//   - the ConfigMaps, ServiceAccounts and PersistentVolumeClaims of their pod specs
+//   - the CustomResourceDefinitions of their kinds
+//
+// The objects depended on are followed in turn, except that the other objects owned by an owner
+// are not. Secrets and Jobs are not hydrated, so they are never part of a closure. An error is
+// returned if a root matches no object.
+func Closure(objects []*unstructured.Unstructured, roots []Ref) ([]*unstructured.Unstructured, error) {
+	byKey := map[objectKey]*unstructured.Unstructured{}
+	dependents := map[objectKey][]*unstructured.Unstructured{}
+	crds := map[schema.GroupKind]*unstructured.Unstructured{}
+	for _, obj := range objects {
+		byKey[keyOf(obj)] = obj
+		for _, owner := range obj.GetOwnerReferences() {
+			gv, err := schema.ParseGroupVersion(owner.APIVersion)
+			if err != nil {
+				continue
+			}
+			// the owner is in the namespace of the object, or is cluster scoped
+			for _, namespace := range ownerNamespaces(obj) {
+				key := objectKey{group: gv.Group, kind: owner.Kind, namespace: namespace, name: owner.Name}
+				dependents[key] = append(dependents[key], obj)
+			}
+		}
+		if gvk := obj.GroupVersionKind(); gvk.Group == "apiextensions.k8s.io" && gvk.Kind == "CustomResourceDefinition" {
+			group, _, _ := unstructured.NestedString(obj.Object, "spec", "group")
+			kind, _, _ := unstructured.NestedString(obj.Object, "spec", "names", "kind")
+			crds[schema.GroupKind{Group: group, Kind: kind}] = obj
+		}
+	}
+
+	type item struct {
+		obj *unstructured.Unstructured
+		// owned is set for the roots and the objects reached through their owners, whose
+		// dependents are followed
+		owned bool
+	}
+	var queue []item
+	included := map[objectKey]bool{}
+	followed := map[objectKey]bool{}
+
+	for _, ref := range roots {
+		matched := false
+		for _, obj := range objects {
+			if (Selector{Refs: []Ref{ref}}).Matches(obj) {
+				matched = true
+				queue = append(queue, item{obj: obj, owned: true})
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("no object matches %s", formatRef(ref))
+		}
+	}
+
+	lookup := func(key objectKey) {
+		if obj, ok := byKey[key]; ok {
+			queue = append(queue, item{obj: obj})
+		}
+	}
+	for len(queue) > 0 {
+		next := queue[0]
+		queue = queue[1:]
+		obj, key := next.obj, keyOf(next.obj)
+
+		if next.owned && !followed[key] {
+			followed[key] = true
+			for _, dependent := range dependents[key] {
+				queue = append(queue, item{obj: dependent, owned: true})
+			}
+		}
+		if included[key] {
+			continue
+		}
+		included[key] = true
+
+		for _, owner := range obj.GetOwnerReferences() {
+			gv, err := schema.ParseGroupVersion(owner.APIVersion)
+			if err != nil {
+				continue
+			}
+			for _, namespace := range ownerNamespaces(obj) {
+				lookup(objectKey{group: gv.Group, kind: owner.Kind, namespace: namespace, name: owner.Name})
+			}
+		}
+		if namespace := obj.GetNamespace(); len(namespace) > 0 {
+			lookup(objectKey{kind: "Namespace", name: namespace})
+		}
+		for _, ref := range podSpecReferences(obj) {
+			lookup(ref)
+		}
+		if crd, ok := crds[obj.GroupVersionKind().GroupKind()]; ok {
+			queue = append(queue, item{obj: crd})
+		}
+	}
+
+	var closure []*unstructured.Unstructured
+	for _, obj := range objects {
+		if included[keyOf(obj)] {
+			closure = append(closure, obj)
+		}
+	}
+	return closure, nil
+}
+
+// ownerNamespaces returns the namespaces an owner of the object may be in.
+func ownerNamespaces(obj *unstructured.Unstructured) []string {
+	if len(obj.GetNamespace()) == 0 {
+		return []string{""}
+	}
+	return []string{obj.GetNamespace(), ""}
+}
+
+// podSpecReferences returns the ConfigMaps, ServiceAccounts and PersistentVolumeClaims referenced
+// by the pod spec of the object, if it has one.
+func podSpecReferences(obj *unstructured.Unstructured) []objectKey {
+	path, ok := podSpecPaths[obj.GroupVersionKind().GroupKind()]
+	if !ok {
+		return nil
+	}
+	spec, ok, _ := unstructured.NestedMap(obj.Object, path...)
+	if !ok {
+		return nil
+	}
+
+	namespace := obj.GetNamespace()
+	var refs []objectKey
+	ref := func(kind string, value any) {
+		if name, ok := value.(string); ok && len(name) > 0 {
+			refs = append(refs, objectKey{kind: kind, namespace: namespace, name: name})
+		}
+	}
+
+	if name, ok := spec["serviceAccountName"]; ok {
+		ref("ServiceAccount", name)
+	} else {
+		ref("ServiceAccount", spec["serviceAccount"])
+	}
+	for _, volume := range maps(spec["volumes"]) {
+		ref("ConfigMap", nested(volume, "configMap", "name"))
+		ref("PersistentVolumeClaim", nested(volume, "persistentVolumeClaim", "claimName"))
+		for _, source := range maps(nested(volume, "projected", "sources")) {
+			ref("ConfigMap", nested(source, "configMap", "name"))
+		}
+	}
+	for _, containers := range []string{"initContainers", "containers", "ephemeralContainers"} {
+		for _, container := range maps(spec[containers]) {
+			for _, env := range maps(container["env"]) {
+				ref("ConfigMap", nested(env, "valueFrom", "configMapKeyRef", "name"))
+			}
+			for _, envFrom := range maps(container["envFrom"]) {
+				ref("ConfigMap", nested(envFrom, "configMapRef", "name"))
+			}
+		}
+	}
+	return refs
+}
+
+// maps returns the maps of a list, skipping any other values.
+func maps(value any) []map[string]any {
+	list, _ := value.([]any)
+	var result []map[string]any
+	for _, item := range list {
+		if m, ok := item.(map[string]any); ok {
+			result = append(result, m)
+		}
+	}
+	return result
+}
+
+// nested returns the value at the path, or nil if there is none.
+func nested(m map[string]any, path ...string) any {
+	var value any = m
+	for _, field := range path {
+		current, ok := value.(map[string]any)
+		if !ok {
+			return nil
+		}
+		value = current[field]
+	}
+	return value
+}
+
+func formatRef(ref Ref) string {
+	if len(ref.Namespace) > 0 {
+		return fmt.Sprintf("%s/%s/%s", ref.Kind, ref.Namespace, ref.Name)
+	}
+	return fmt.Sprintf("%s/%s", ref.Kind, ref.Name)
+}
@@ -0,0 +1,169 @@
+package export
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+func object(apiVersion, kind, namespace, name string, objLabels map[string]string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion(apiVersion)
+	obj.SetKind(kind)
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	obj.SetLabels(objLabels)
+	return obj
+}
+
+func TestSelect(t *testing.T) {
+	objects := []*unstructured.Unstructured{
+		object("v1", "Pod", "openshift-etcd", "etcd-0", map[string]string{"app": "etcd"}),
+		object("v1", "Pod", "openshift-etcd", "installer-1", map[string]string{"app": "installer"}),
+		object("v1", "Pod", "default", "etcd-0", map[string]string{"app": "etcd"}),
+		object("config.openshift.io/v1", "Infrastructure", "", "cluster", nil),
+	}
+
+	names := func(selected []*unstructured.Unstructured) []string {
+		var result []string
+		for _, obj := range selected {
+			result = append(result, obj.GetNamespace()+"/"+obj.GetName())
+		}
+		return result
+	}
+
+	appEtcd, _ := labels.Parse("app=etcd")
+	tests := []struct {
+		name     string
+		selector Selector
+		expected string
+	}{
+		{"kind", Selector{Kinds: []string{"pod"}}, "openshift-etcd/etcd-0,openshift-etcd/installer-1,default/etcd-0"},
+		{"qualified kind", Selector{Kinds: []string{"Infrastructure.config.openshift.io"}}, "/cluster"},
+		{"wrong group", Selector{Kinds: []string{"Infrastructure.operator.openshift.io"}}, ""},
+		{"namespace and labels", Selector{Namespaces: []string{"openshift-etcd"}, Labels: appEtcd}, "openshift-etcd/etcd-0"},
+		{"ref in any namespace", Selector{Refs: []Ref{{Kind: "Pod", Name: "etcd-0"}}}, "openshift-etcd/etcd-0,default/etcd-0"},
+		{"namespaced ref", Selector{Refs: []Ref{{Kind: "Pod", Namespace: "default", Name: "etcd-0"}}}, "default/etcd-0"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual := strings.Join(names(Select(objects, test.selector)), ",")
+			if actual != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestParseRef(t *testing.T) {
+	ref, err := ParseRef("Pod/openshift-etcd/etcd-0")
+	if err != nil || ref != (Ref{Kind: "Pod", Namespace: "openshift-etcd", Name: "etcd-0"}) {
+		t.Errorf("unexpected ref %+v. %v", ref, err)
+	}
+	for _, invalid := range []string{"Pod", "Pod//etcd-0", "a/b/c/d"} {
+		if _, err := ParseRef(invalid); err == nil {
+			t.Errorf("expected %q to be invalid", invalid)
+		}
+	}
+}
+
+func TestWriteGo(t *testing.T) {
+	obj := object("v1", "ConfigMap", "default", "settings", nil)
+	obj.Object["data"] = map[string]any{"b": "2", "a": "1"}
+	obj.Object["replicas"] = 3
+	obj.Object["items"] = []any{true, nil, 1.5}
+
+	var out bytes.Buffer
+	err := WriteGo(&out, []*unstructured.Unstructured{obj}, GoOptions{Package: "fixtures", Variable: "Objects", Source: "must-gather"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		"package fixtures\n",
+		"// Objects are the objects exported from must-gather.\n",
+		"var Objects = []*unstructured.Unstructured{\n",
+		"\"data\": map[string]any{\n\t\t\t\"a\": \"1\",\n\t\t\t\"b\": \"2\",\n\t\t},",
+		"\"replicas\": int64(3),",
+		"true,\n\t\t\tnil,\n\t\t\tfloat64(1.5),",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("expected %q in output:\n%s", expected, out.String())
+		}
+	}
+}
+
+func TestClosure(t *testing.T) {
+	owned := func(obj *unstructured.Unstructured, apiVersion, kind, name string) *unstructured.Unstructured {
+		obj.SetOwnerReferences([]metav1.OwnerReference{{APIVersion: apiVersion, Kind: kind, Name: name}})
+		return obj
+	}
+	machineSet := object("machine.openshift.io/v1beta1", "MachineSet", "openshift-machine-api", "worker-a", nil)
+	machine := owned(object("machine.openshift.io/v1beta1", "Machine", "openshift-machine-api", "worker-a-1", nil), "machine.openshift.io/v1beta1", "MachineSet", "worker-a")
+	sibling := owned(object("machine.openshift.io/v1beta1", "Machine", "openshift-machine-api", "worker-a-2", nil), "machine.openshift.io/v1beta1", "MachineSet", "worker-a")
+	dependent := owned(object("v1", "ConfigMap", "openshift-machine-api", "worker-a-1-status", nil), "machine.openshift.io/v1beta1", "Machine", "worker-a-1")
+	pod := owned(object("v1", "Pod", "openshift-machine-api", "controller-0", nil), "apps/v1", "ReplicaSet", "controller")
+	pod.Object["spec"] = map[string]any{
+		"serviceAccountName": "machine-api-controllers",
+		"volumes": []any{
+			map[string]any{"name": "config", "configMap": map[string]any{"name": "controller-config"}},
+		},
+		"containers": []any{
+			map[string]any{"name": "controller", "env": []any{
+				map[string]any{"name": "TOKEN", "valueFrom": map[string]any{"secretKeyRef": map[string]any{"name": "token"}}},
+			}},
+		},
+	}
+	crd := object("apiextensions.k8s.io/v1", "CustomResourceDefinition", "", "machines.machine.openshift.io", nil)
+	crd.Object["spec"] = map[string]any{"group": "machine.openshift.io", "names": map[string]any{"kind": "Machine"}}
+
+	objects := []*unstructured.Unstructured{
+		crd,
+		object("v1", "Namespace", "", "openshift-machine-api", nil),
+		object("v1", "Namespace", "", "default", nil),
+		machineSet,
+		machine,
+		sibling,
+		dependent,
+		pod,
+		object("apps/v1", "ReplicaSet", "openshift-machine-api", "controller", nil),
+		object("v1", "ServiceAccount", "openshift-machine-api", "machine-api-controllers", nil),
+		object("v1", "ConfigMap", "openshift-machine-api", "controller-config", nil),
+		object("v1", "ConfigMap", "openshift-machine-api", "unrelated", nil),
+		object("v1", "Secret", "openshift-machine-api", "token", nil),
+	}
+
+	names := func(objs []*unstructured.Unstructured) string {
+		var result []string
+		for _, obj := range objs {
+			result = append(result, obj.GetKind()+"/"+obj.GetName())
+		}
+		return strings.Join(result, ",")
+	}
+
+	closure, err := Closure(objects, []Ref{{Kind: "Machine", Namespace: "openshift-machine-api", Name: "worker-a-1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "CustomResourceDefinition/machines.machine.openshift.io,Namespace/openshift-machine-api,MachineSet/worker-a,Machine/worker-a-1,ConfigMap/worker-a-1-status"
+	if actual := names(closure); actual != expected {
+		t.Errorf("expected %s, got %s", expected, actual)
+	}
+
+	closure, err = Closure(objects, []Ref{{Kind: "Pod", Name: "controller-0"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = "Namespace/openshift-machine-api,Pod/controller-0,ReplicaSet/controller,ServiceAccount/machine-api-controllers,ConfigMap/controller-config"
+	if actual := names(closure); actual != expected {
+		t.Errorf("expected %s, got %s", expected, actual)
+	}
+
+	if _, err := Closure(objects, []Ref{{Kind: "Machine", Name: "missing"}}); err == nil {
+		t.Error("expected an error for a reference which matches no object")
+	}
+}
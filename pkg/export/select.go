@@ -0,0 +1,111 @@
+package export
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Ref identifies an object by kind, and optionally namespace, and name.
+type Ref struct {
+	// Kind is a kind, optionally qualified by its group, such as Pod or Infrastructure.config.openshift.io.
+	Kind      string
+	Namespace string
+	Name      string
+}
+
+// ParseRef parses a reference of the form Kind[.group]/name or Kind[.group]/namespace/name.
+// A reference without a namespace matches the named object in any namespace.
+func ParseRef(ref string) (Ref, error) {
+	parts := strings.Split(ref, "/")
+	for _, part := range parts {
+		if len(part) == 0 {
+			return Ref{}, fmt.Errorf("invalid object reference %q", ref)
+		}
+	}
+	switch len(parts) {
+	case 2:
+		return Ref{Kind: parts[0], Name: parts[1]}, nil
+	case 3:
+		return Ref{Kind: parts[0], Namespace: parts[1], Name: parts[2]}, nil
+	}
+	return Ref{}, fmt.Errorf("invalid object reference %q. Expected Kind[.group]/[namespace/]name", ref)
+}
+
+// Selector selects objects to export. Objects must match every criteria which is set, and any
+// of the values of each criteria.
+type Selector struct {
+	// Kinds are kinds, optionally qualified by their group, such as Pod or Infrastructure.config.openshift.io.
+	Kinds []string
+	// Namespaces are the namespaces of the objects.
+	Namespaces []string
+	// Labels selects objects by their labels.
+	Labels labels.Selector
+	// Refs are individual objects.
+	Refs []Ref
+}
+
+// Select returns the objects which match the selector.
+func Select(objects []*unstructured.Unstructured, selector Selector) []*unstructured.Unstructured {
+	var selected []*unstructured.Unstructured
+	for _, obj := range objects {
+		if selector.Matches(obj) {
+			selected = append(selected, obj)
+		}
+	}
+	return selected
+}
+
+// Matches returns true if the object matches the selector.
+func (s Selector) Matches(obj *unstructured.Unstructured) bool {
+	if len(s.Kinds) > 0 && !anyKindMatches(s.Kinds, obj) {
+		return false
+	}
+	if len(s.Namespaces) > 0 && !contains(s.Namespaces, obj.GetNamespace()) {
+		return false
+	}
+	if s.Labels != nil && !s.Labels.Matches(labels.Set(obj.GetLabels())) {
+		return false
+	}
+	if len(s.Refs) > 0 {
+		for _, ref := range s.Refs {
+			if KindMatches(ref.Kind, obj) && ref.Name == obj.GetName() &&
+				(len(ref.Namespace) == 0 || ref.Namespace == obj.GetNamespace()) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// KindMatches returns true if the object is of the kind, which may be qualified by its group.
+// Kinds are matched case insensitively.
+func KindMatches(kind string, obj *unstructured.Unstructured) bool {
+	gvk := obj.GroupVersionKind()
+	name, group, qualified := strings.Cut(kind, ".")
+	if !strings.EqualFold(name, gvk.Kind) {
+		return false
+	}
+	return !qualified || strings.EqualFold(group, gvk.Group)
+}
+
+func anyKindMatches(kinds []string, obj *unstructured.Unstructured) bool {
+	for _, kind := range kinds {
+		if KindMatches(kind, obj) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+package export
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"sort"
+	"strconv"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+// WriteYAML writes the objects as multi-document YAML.
+func WriteYAML(w io.Writer, objects []*unstructured.Unstructured) error {
+	for _, obj := range objects {
+		data, err := yaml.Marshal(obj.Object)
+		if err != nil {
+			return fmt.Errorf("unable to marshal %s %s/%s. %v", obj.GetKind(), obj.GetNamespace(), obj.GetName(), err)
+		}
+		if _, err := fmt.Fprintf(w, "---\n%s", data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GoOptions describe the Go file written by WriteGo.
+type GoOptions struct {
+	// Package is the package of the file.
+	Package string
+	// Variable is the name of the []*unstructured.Unstructured variable holding the objects.
+	Variable string
+	// Source describes where the objects were exported from.
+	Source string
+}
+
+// WriteGo writes the objects as a Go file declaring a []*unstructured.Unstructured variable, for
+// use as the fixtures of envtest or fake client based tests.
+func WriteGo(w io.Writer, objects []*unstructured.Unstructured, options GoOptions) error {
+	var b bytes.Buffer
+	b.WriteString("// Code generated by must-hydrate export. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&b, "package %s\n\n", options.Package)
+	b.WriteString("import \"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured\"\n\n")
+	if len(options.Source) > 0 {
+		fmt.Fprintf(&b, "// %s are the objects exported from %s.\n", options.Variable, options.Source)
+	}
+	fmt.Fprintf(&b, "var %s = []*unstructured.Unstructured{\n", options.Variable)
+	for _, obj := range objects {
+		b.WriteString("{Object: ")
+		if err := writeGoValue(&b, obj.Object); err != nil {
+			return fmt.Errorf("unable to export %s %s/%s. %v", obj.GetKind(), obj.GetNamespace(), obj.GetName(), err)
+		}
+		b.WriteString("},\n")
+	}
+	b.WriteString("}\n")
+
+	formatted, err := format.Source(b.Bytes())
+	if err != nil {
+		return fmt.Errorf("unable to format Go source. %v", err)
+	}
+	_, err = w.Write(formatted)
+	return err
+}
+
+// writeGoValue writes a literal of the value using the types unstructured objects hold.
+func writeGoValue(b *bytes.Buffer, value any) error {
+	switch v := value.(type) {
+	case nil:
+		b.WriteString("nil")
+	case string:
+		b.WriteString(strconv.Quote(v))
+	case bool:
+		b.WriteString(strconv.FormatBool(v))
+	case int:
+		fmt.Fprintf(b, "int64(%d)", v)
+	case int64:
+		fmt.Fprintf(b, "int64(%d)", v)
+	case float64:
+		fmt.Fprintf(b, "float64(%s)", strconv.FormatFloat(v, 'g', -1, 64))
+	case []any:
+		b.WriteString("[]any{\n")
+		for _, item := range v {
+			if err := writeGoValue(b, item); err != nil {
+				return err
+			}
+			b.WriteString(",\n")
+		}
+		b.WriteString("}")
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		b.WriteString("map[string]any{\n")
+		for _, key := range keys {
+			fmt.Fprintf(b, "%s: ", strconv.Quote(key))
+			if err := writeGoValue(b, v[key]); err != nil {
+				return err
+			}
+			b.WriteString(",\n")
+		}
+		b.WriteString("}")
+	default:
+		return fmt.Errorf("unsupported value of type %T", value)
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+package hydrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/openshift-splat-team/must-hydrate/pkg/controller"
+	"github.com/openshift-splat-team/must-hydrate/pkg/controller/util"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+)
+
+// DefaultControllerUser is the user registered controllers and sidecars authenticate as, and
+// their field manager, unless ControllerOptions says otherwise.
+const DefaultControllerUser = "must-hydrate-controllers"
+
+// ControllerFunc adds controllers to a manager, such as with builder.ControllerManagedBy.
+type ControllerFunc func(mgr manager.Manager) error
+
+var (
+	registryLock sync.Mutex
+	registry     []ControllerFunc
+)
+
+// RegisterController registers controllers to run against the hydrated control plane. It is
+// typically called from an init function, such as that of a Go plugin loaded by must_hydrate serve.
+func RegisterController(add ControllerFunc) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	registry = append(registry, add)
+}
+
+// RegisteredControllers returns the controllers registered with RegisterController.
+func RegisteredControllers() []ControllerFunc {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	return append([]ControllerFunc{}, registry...)
+}
+
+// ControllerOptions configure how controllers run against the hydrated control plane.
+type ControllerOptions struct {
+	// User is the user the controllers authenticate as. Defaults to DefaultControllerUser.
+	User string
+	// Rules are the RBAC rules granted to User. Defaults to every verb on every resource, which
+	// still separates the requests of the controllers from those of the hydrator.
+	Rules []rbacv1.PolicyRule
+	// FieldManager is the field manager of the creates, updates and patches of the controllers.
+	// Defaults to User. Sidecars choose their own field manager, which defaults to their user agent.
+	FieldManager string
+	// Scheme is the scheme of the manager. Defaults to the Kubernetes and OpenShift APIs.
+	Scheme *runtime.Scheme
+	// Logger receives the log messages of the manager. Defaults to the controller-runtime logger.
+	Logger logr.Logger
+}
+
+// defaulted returns the options with their defaults applied.
+func (o ControllerOptions) defaulted() (ControllerOptions, error) {
+	if len(o.User) == 0 {
+		o.User = DefaultControllerUser
+	}
+	if len(o.Rules) == 0 {
+		o.Rules = []rbacv1.PolicyRule{
+			{
+				APIGroups: []string{"*"},
+				Resources: []string{"*"},
+				Verbs:     []string{"*"},
+			},
+			{
+				NonResourceURLs: []string{"*"},
+				Verbs:           []string{"*"},
+			},
+		}
+	}
+	if len(o.FieldManager) == 0 {
+		o.FieldManager = o.User
+	}
+	if o.Scheme == nil {
+		var err error
+		if o.Scheme, err = DefaultScheme(); err != nil {
+			return o, err
+		}
+	}
+	if o.Logger.GetSink() == nil {
+		o.Logger = logf.Log.WithName("controllers")
+	}
+	return o, nil
+}
+
+// userConfig waits for hydration to converge and provisions the user of the options. It returns
+// nil if ctx is done first.
+func userConfig(ctx context.Context, hydrator *controller.HydratorReconciler, options ControllerOptions) (*rest.Config, error) {
+	select {
+	case <-hydrator.Converged():
+	case <-ctx.Done():
+		return nil, nil
+	}
+	cfg, err := hydrator.AddUser(ctx, options.User, options.Rules)
+	if err != nil {
+		return nil, err
+	}
+	// the API server defaults the field manager of requests without one to their user agent
+	cfg.UserAgent = options.FieldManager
+	return cfg, nil
+}
+
+// RunControllers waits for hydration to converge and then runs the controllers, along with those
+// registered with RegisterController, in a manager until ctx is done. The manager authenticates as
+// options.User, which is granted only options.Rules, and its client writes as options.FieldManager.
+func RunControllers(ctx context.Context, hydrator *controller.HydratorReconciler, options ControllerOptions, controllers ...ControllerFunc) error {
+	controllers = append(RegisteredControllers(), controllers...)
+	if len(controllers) == 0 {
+		return errors.New("no controllers are registered")
+	}
+	options, err := options.defaulted()
+	if err != nil {
+		return err
+	}
+
+	cfg, err := userConfig(ctx, hydrator, options)
+	if err != nil || cfg == nil {
+		return err
+	}
+
+	mgr, err := manager.New(cfg, manager.Options{
+		Scheme: options.Scheme,
+		Logger: options.Logger,
+		// the metrics would conflict with those of other managers, and are of no use for a hydrated cluster
+		Metrics: metricsserver.Options{BindAddress: "0"},
+		NewClient: func(config *rest.Config, clientOptions client.Options) (client.Client, error) {
+			c, err := client.New(config, clientOptions)
+			if err != nil {
+				return nil, err
+			}
+			return client.WithFieldOwner(c, options.FieldManager), nil
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("unable to create the controller manager. %v", err)
+	}
+	for _, add := range controllers {
+		if err := add(mgr); err != nil {
+			return fmt.Errorf("unable to add controllers to the manager. %v", err)
+		}
+	}
+
+	options.Logger.Info("starting controllers", "user", options.User, "fieldManager", options.FieldManager)
+	return mgr.Start(ctx)
+}
+
+// RunSidecar waits for hydration to converge and then runs the command, such as an operator
+// binary, until ctx is done. KUBECONFIG is set to a kubeconfig which authenticates as
+// options.User, which is granted only options.Rules. The command is sent SIGTERM when ctx is done.
+func RunSidecar(ctx context.Context, hydrator *controller.HydratorReconciler, options ControllerOptions, command []string) error {
+	if len(command) == 0 {
+		return errors.New("the command of a sidecar is required")
+	}
+	options, err := options.defaulted()
+	if err != nil {
+		return err
+	}
+
+	cfg, err := userConfig(ctx, hydrator, options)
+	if err != nil || cfg == nil {
+		return err
+	}
+	kubeconfig, err := os.CreateTemp(hydrator.StateDir, options.User+"-*.kubeconfig")
+	if err != nil {
+		return fmt.Errorf("unable to create the sidecar kubeconfig. %v", err)
+	}
+	kubeconfig.Close()
+	defer os.Remove(kubeconfig.Name())
+	if err := util.WriteKubeconfig(cfg, hydrator.ClusterName(), kubeconfig.Name()); err != nil {
+		return err
+	}
+
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Env = append(os.Environ(), "KUBECONFIG="+kubeconfig.Name())
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(syscall.SIGTERM)
+	}
+	cmd.WaitDelay = 10 * time.Second
+
+	options.Logger.Info("starting sidecar", "command", filepath.Base(command[0]), "user", options.User)
+	if err := cmd.Run(); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("sidecar %s exited. %v", command[0], err)
+	}
+	return nil
+}
+
+// RunControllers waits for hydration to converge and then runs the controllers, along with those
+// registered with RegisterController, until ctx is done. See RunControllers.
+func (c *Cluster) RunControllers(ctx context.Context, options ControllerOptions, controllers ...ControllerFunc) error {
+	return RunControllers(ctx, c.hydrator, options, controllers...)
+}
@@ -0,0 +1,56 @@
+package hydrate
+
+import (
+	"context"
+	"testing"
+
+	"github.com/openshift-splat-team/must-hydrate/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+func TestControllerOptions(t *testing.T) {
+	options, err := ControllerOptions{}.defaulted()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if options.User != DefaultControllerUser || options.FieldManager != DefaultControllerUser || len(options.Rules) == 0 || options.Scheme == nil {
+		t.Errorf("unexpected defaults %+v", options)
+	}
+
+	options, err = ControllerOptions{User: "my-operator"}.defaulted()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if options.FieldManager != "my-operator" {
+		t.Errorf("expected the field manager to default to the user, got %s", options.FieldManager)
+	}
+}
+
+func TestRunControllers(t *testing.T) {
+	hydrator := &controller.HydratorReconciler{}
+	if err := RunControllers(context.Background(), hydrator, ControllerOptions{}); err == nil {
+		t.Error("expected an error when no controllers are registered")
+	}
+
+	t.Cleanup(func() {
+		registry = nil
+	})
+	added := false
+	RegisterController(func(mgr manager.Manager) error {
+		added = true
+		return nil
+	})
+	if len(RegisteredControllers()) != 1 {
+		t.Fatalf("expected one registered controller, got %d", len(RegisteredControllers()))
+	}
+
+	// the controllers never start when the context is done before hydration converges
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := RunControllers(ctx, hydrator, ControllerOptions{}); err != nil || added {
+		t.Errorf("expected the controllers not to be started, got %v", err)
+	}
+	if err := RunSidecar(ctx, hydrator, ControllerOptions{}, []string{"true"}); err != nil {
+		t.Errorf("expected the sidecar not to be started, got %v", err)
+	}
+}
@@ -0,0 +1,401 @@
+package hydrate
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/openshift-splat-team/must-hydrate/pkg/controller"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// rootScopedKinds are the cluster scoped kinds of the scheme, as marked +genclient:nonNamespaced in
+// the Kubernetes and OpenShift APIs it installs. Kinds defined by a gathered CustomResourceDefinition
+// take their scope from it, and kinds outside the scheme only gathered without a namespace are also
+// cluster scoped.
+var rootScopedKinds = map[schema.GroupKind]bool{
+	{Group: "admissionregistration.k8s.io", Kind: "MutatingAdmissionPolicy"}:                  true,
+	{Group: "admissionregistration.k8s.io", Kind: "MutatingAdmissionPolicyBinding"}:           true,
+	{Group: "admissionregistration.k8s.io", Kind: "MutatingWebhookConfiguration"}:             true,
+	{Group: "admissionregistration.k8s.io", Kind: "ValidatingAdmissionPolicy"}:                true,
+	{Group: "admissionregistration.k8s.io", Kind: "ValidatingAdmissionPolicyBinding"}:         true,
+	{Group: "admissionregistration.k8s.io", Kind: "ValidatingWebhookConfiguration"}:           true,
+	{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"}:                         true,
+	{Group: "apiregistration.k8s.io", Kind: "APIService"}:                                     true,
+	{Group: "apiserver.openshift.io", Kind: "APIRequestCount"}:                                true,
+	{Group: "authentication.k8s.io", Kind: "SelfSubjectReview"}:                               true,
+	{Group: "authentication.k8s.io", Kind: "TokenReview"}:                                     true,
+	{Group: "authorization.k8s.io", Kind: "SelfSubjectAccessReview"}:                          true,
+	{Group: "authorization.k8s.io", Kind: "SelfSubjectRulesReview"}:                           true,
+	{Group: "authorization.k8s.io", Kind: "SubjectAccessReview"}:                              true,
+	{Group: "authorization.openshift.io", Kind: "ClusterRole"}:                                true,
+	{Group: "authorization.openshift.io", Kind: "ClusterRoleBinding"}:                         true,
+	{Group: "authorization.openshift.io", Kind: "ResourceAccessReview"}:                       true,
+	{Group: "authorization.openshift.io", Kind: "SubjectAccessReview"}:                        true,
+	{Group: "certificates.k8s.io", Kind: "CertificateSigningRequest"}:                         true,
+	{Group: "certificates.k8s.io", Kind: "ClusterTrustBundle"}:                                true,
+	{Group: "cloud.network.openshift.io", Kind: "CloudPrivateIPConfig"}:                       true,
+	{Group: "config.openshift.io", Kind: "APIServer"}:                                         true,
+	{Group: "config.openshift.io", Kind: "Authentication"}:                                    true,
+	{Group: "config.openshift.io", Kind: "Backup"}:                                            true,
+	{Group: "config.openshift.io", Kind: "Build"}:                                             true,
+	{Group: "config.openshift.io", Kind: "ClusterImagePolicy"}:                                true,
+	{Group: "config.openshift.io", Kind: "ClusterMonitoring"}:                                 true,
+	{Group: "config.openshift.io", Kind: "ClusterOperator"}:                                   true,
+	{Group: "config.openshift.io", Kind: "ClusterVersion"}:                                    true,
+	{Group: "config.openshift.io", Kind: "Console"}:                                           true,
+	{Group: "config.openshift.io", Kind: "DNS"}:                                               true,
+	{Group: "config.openshift.io", Kind: "FeatureGate"}:                                       true,
+	{Group: "config.openshift.io", Kind: "Image"}:                                             true,
+	{Group: "config.openshift.io", Kind: "ImageContentPolicy"}:                                true,
+	{Group: "config.openshift.io", Kind: "ImageDigestMirrorSet"}:                              true,
+	{Group: "config.openshift.io", Kind: "ImageTagMirrorSet"}:                                 true,
+	{Group: "config.openshift.io", Kind: "Infrastructure"}:                                    true,
+	{Group: "config.openshift.io", Kind: "Ingress"}:                                           true,
+	{Group: "config.openshift.io", Kind: "InsightsDataGather"}:                                true,
+	{Group: "config.openshift.io", Kind: "Network"}:                                           true,
+	{Group: "config.openshift.io", Kind: "Node"}:                                              true,
+	{Group: "config.openshift.io", Kind: "OAuth"}:                                             true,
+	{Group: "config.openshift.io", Kind: "OperatorHub"}:                                       true,
+	{Group: "config.openshift.io", Kind: "Project"}:                                           true,
+	{Group: "config.openshift.io", Kind: "Proxy"}:                                             true,
+	{Group: "config.openshift.io", Kind: "Scheduler"}:                                         true,
+	{Group: "console.openshift.io", Kind: "ConsoleCLIDownload"}:                               true,
+	{Group: "console.openshift.io", Kind: "ConsoleExternalLogLink"}:                           true,
+	{Group: "console.openshift.io", Kind: "ConsoleLink"}:                                      true,
+	{Group: "console.openshift.io", Kind: "ConsoleNotification"}:                              true,
+	{Group: "console.openshift.io", Kind: "ConsolePlugin"}:                                    true,
+	{Group: "console.openshift.io", Kind: "ConsoleQuickStart"}:                                true,
+	{Group: "console.openshift.io", Kind: "ConsoleSample"}:                                    true,
+	{Group: "console.openshift.io", Kind: "ConsoleYAMLSample"}:                                true,
+	{Group: "flowcontrol.apiserver.k8s.io", Kind: "FlowSchema"}:                               true,
+	{Group: "flowcontrol.apiserver.k8s.io", Kind: "PriorityLevelConfiguration"}:               true,
+	{Group: "helm.openshift.io", Kind: "HelmChartRepository"}:                                 true,
+	{Group: "image.openshift.io", Kind: "Image"}:                                              true,
+	{Group: "image.openshift.io", Kind: "ImageSignature"}:                                     true,
+	{Group: "imageregistry.operator.openshift.io", Kind: "Config"}:                            true,
+	{Group: "imageregistry.operator.openshift.io", Kind: "ImagePruner"}:                       true,
+	{Group: "internal.apiserver.k8s.io", Kind: "StorageVersion"}:                              true,
+	{Group: "network.openshift.io", Kind: "ClusterNetwork"}:                                   true,
+	{Group: "network.openshift.io", Kind: "HostSubnet"}:                                       true,
+	{Group: "network.openshift.io", Kind: "NetNamespace"}:                                     true,
+	{Group: "networking.k8s.io", Kind: "IPAddress"}:                                           true,
+	{Group: "networking.k8s.io", Kind: "IngressClass"}:                                        true,
+	{Group: "networking.k8s.io", Kind: "ServiceCIDR"}:                                         true,
+	{Group: "node.k8s.io", Kind: "RuntimeClass"}:                                              true,
+	{Group: "oauth.openshift.io", Kind: "OAuthAccessToken"}:                                   true,
+	{Group: "oauth.openshift.io", Kind: "OAuthAuthorizeToken"}:                                true,
+	{Group: "oauth.openshift.io", Kind: "OAuthClient"}:                                        true,
+	{Group: "oauth.openshift.io", Kind: "OAuthClientAuthorization"}:                           true,
+	{Group: "operator.openshift.io", Kind: "Authentication"}:                                  true,
+	{Group: "operator.openshift.io", Kind: "CSISnapshotController"}:                           true,
+	{Group: "operator.openshift.io", Kind: "CloudCredential"}:                                 true,
+	{Group: "operator.openshift.io", Kind: "ClusterCSIDriver"}:                                true,
+	{Group: "operator.openshift.io", Kind: "ClusterVersionOperator"}:                          true,
+	{Group: "operator.openshift.io", Kind: "Console"}:                                         true,
+	{Group: "operator.openshift.io", Kind: "DNS"}:                                             true,
+	{Group: "operator.openshift.io", Kind: "Etcd"}:                                            true,
+	{Group: "operator.openshift.io", Kind: "EtcdBackup"}:                                      true,
+	{Group: "operator.openshift.io", Kind: "ImageContentSourcePolicy"}:                        true,
+	{Group: "operator.openshift.io", Kind: "InsightsOperator"}:                                true,
+	{Group: "operator.openshift.io", Kind: "KubeAPIServer"}:                                   true,
+	{Group: "operator.openshift.io", Kind: "KubeControllerManager"}:                           true,
+	{Group: "operator.openshift.io", Kind: "KubeScheduler"}:                                   true,
+	{Group: "operator.openshift.io", Kind: "KubeStorageVersionMigrator"}:                      true,
+	{Group: "operator.openshift.io", Kind: "MachineConfiguration"}:                            true,
+	{Group: "operator.openshift.io", Kind: "Network"}:                                         true,
+	{Group: "operator.openshift.io", Kind: "OLM"}:                                             true,
+	{Group: "operator.openshift.io", Kind: "OpenShiftAPIServer"}:                              true,
+	{Group: "operator.openshift.io", Kind: "OpenShiftControllerManager"}:                      true,
+	{Group: "operator.openshift.io", Kind: "ServiceCA"}:                                       true,
+	{Group: "operator.openshift.io", Kind: "ServiceCatalogAPIServer"}:                         true,
+	{Group: "operator.openshift.io", Kind: "ServiceCatalogControllerManager"}:                 true,
+	{Group: "operator.openshift.io", Kind: "Storage"}:                                         true,
+	{Group: "project.openshift.io", Kind: "Project"}:                                          true,
+	{Group: "project.openshift.io", Kind: "ProjectRequest"}:                                   true,
+	{Group: "quota.openshift.io", Kind: "ClusterResourceQuota"}:                               true,
+	{Group: "rbac.authorization.k8s.io", Kind: "ClusterRole"}:                                 true,
+	{Group: "rbac.authorization.k8s.io", Kind: "ClusterRoleBinding"}:                          true,
+	{Group: "resource.k8s.io", Kind: "DeviceClass"}:                                           true,
+	{Group: "resource.k8s.io", Kind: "ResourceSlice"}:                                         true,
+	{Group: "samples.operator.openshift.io", Kind: "Config"}:                                  true,
+	{Group: "scheduling.k8s.io", Kind: "PriorityClass"}:                                       true,
+	{Group: "security.openshift.io", Kind: "RangeAllocation"}:                                 true,
+	{Group: "security.openshift.io", Kind: "SecurityContextConstraints"}:                      true,
+	{Group: "servicecertsigner.config.openshift.io", Kind: "ServiceCertSignerOperatorConfig"}: true,
+	{Group: "sharedresource.openshift.io", Kind: "SharedConfigMap"}:                           true,
+	{Group: "sharedresource.openshift.io", Kind: "SharedSecret"}:                              true,
+	{Group: "storage.k8s.io", Kind: "CSIDriver"}:                                              true,
+	{Group: "storage.k8s.io", Kind: "CSINode"}:                                                true,
+	{Group: "storage.k8s.io", Kind: "StorageClass"}:                                           true,
+	{Group: "storage.k8s.io", Kind: "VolumeAttachment"}:                                       true,
+	{Group: "storage.k8s.io", Kind: "VolumeAttributesClass"}:                                  true,
+	{Group: "storagemigration.k8s.io", Kind: "StorageVersionMigration"}:                       true,
+	{Group: "template.openshift.io", Kind: "BrokerTemplateInstance"}:                          true,
+	{Group: "user.openshift.io", Kind: "Group"}:                                               true,
+	{Group: "user.openshift.io", Kind: "Identity"}:                                            true,
+	{Group: "user.openshift.io", Kind: "User"}:                                                true,
+	{Group: "user.openshift.io", Kind: "UserIdentityMapping"}:                                 true,
+	{Kind: "ComponentStatus"}:                                                                 true,
+	{Kind: "Namespace"}:                                                                       true,
+	{Kind: "Node"}:                                                                            true,
+	{Kind: "PersistentVolume"}:                                                                true,
+}
+
+// FakeClients are clients backed by an in-memory object tracker seeded with the objects of a
+// must-gather, for tests which do not need a control plane.
+type FakeClients struct {
+	// Client is a controller-runtime client. Status is a subresource of the kinds whose gathered
+	// CustomResourceDefinition declares it, and of the built-in kinds which have one.
+	Client client.WithWatch
+	// Dynamic is a dynamic client seeded with the same objects as Client. Writes through one
+	// client are not visible through the other.
+	Dynamic *dynamicfake.FakeDynamicClient
+	// Informers is an informer factory for Dynamic.
+	Informers dynamicinformer.DynamicSharedInformerFactory
+	// RESTMapper maps the kinds of the scheme and of the must-gather to their resources.
+	RESTMapper meta.RESTMapper
+	// Objects are the objects the clients were seeded with.
+	Objects []*unstructured.Unstructured
+}
+
+// NewFakeClient loads the must-gather at path and returns fake clients seeded with its objects.
+// The scheme defaults to the Kubernetes and OpenShift APIs; gathered kinds which are not in the
+// scheme are served as unstructured objects.
+func NewFakeClient(path string, scheme *runtime.Scheme) (*FakeClients, error) {
+	if len(path) == 0 {
+		return nil, errors.New("the path of a must-gather is required")
+	}
+	if scheme == nil {
+		var err error
+		if scheme, err = DefaultScheme(); err != nil {
+			return nil, err
+		}
+	}
+
+	hydrator := &controller.HydratorReconciler{
+		RootPath:    path,
+		LogDisabled: true,
+	}
+	if err := hydrator.Load(); err != nil {
+		return nil, err
+	}
+	objects := uniqueObjects(hydrator.Resources())
+
+	mapper, statusKinds, err := newRESTMapper(scheme, objects)
+	if err != nil {
+		return nil, err
+	}
+
+	var seed []client.Object
+	for _, obj := range objects {
+		typed, err := toTyped(scheme, obj)
+		if err != nil {
+			return nil, fmt.Errorf("unable to convert %s %s/%s. %v", obj.GetKind(), obj.GetNamespace(), obj.GetName(), err)
+		}
+		seed = append(seed, typed)
+	}
+
+	var statusObjects []client.Object
+	for _, gvk := range statusKinds {
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(gvk)
+		statusObjects = append(statusObjects, obj)
+	}
+
+	c := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRESTMapper(mapper).
+		WithStatusSubresource(statusObjects...).
+		WithObjects(seed...).
+		Build()
+
+	listKinds := map[schema.GroupVersionResource]string{}
+	for _, obj := range objects {
+		gvk := obj.GroupVersionKind()
+		mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			return nil, fmt.Errorf("unable to map %s. %v", gvk, err)
+		}
+		listKinds[mapping.Resource] = gvk.Kind + "List"
+	}
+	dynamic := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), listKinds)
+	for _, obj := range objects {
+		gvk := obj.GroupVersionKind()
+		mapping, _ := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err := dynamic.Tracker().Create(mapping.Resource, obj.DeepCopy(), obj.GetNamespace()); err != nil {
+			return nil, fmt.Errorf("unable to seed the dynamic client with %s %s/%s. %v", gvk.Kind, obj.GetNamespace(), obj.GetName(), err)
+		}
+	}
+
+	return &FakeClients{
+		Client:     c,
+		Dynamic:    dynamic,
+		Informers:  dynamicinformer.NewDynamicSharedInformerFactory(dynamic, 0),
+		RESTMapper: mapper,
+		Objects:    objects,
+	}, nil
+}
+
+// uniqueObjects drops the objects gathered more than once, such as those listed in both a list
+// and an individual file, keeping the last.
+func uniqueObjects(objects []*unstructured.Unstructured) []*unstructured.Unstructured {
+	index := map[string]int{}
+	var unique []*unstructured.Unstructured
+	for _, obj := range objects {
+		key := strings.Join([]string{obj.GetAPIVersion(), obj.GetKind(), obj.GetNamespace(), obj.GetName()}, "/")
+		if i, ok := index[key]; ok {
+			unique[i] = obj
+			continue
+		}
+		index[key] = len(unique)
+		unique = append(unique, obj)
+	}
+	return unique
+}
+
+// toTyped converts the object to its type in the scheme, so that conversion errors are returned
+// rather than raised when the fake client is built. Objects of kinds not in the scheme are
+// returned as they are.
+func toTyped(scheme *runtime.Scheme, obj *unstructured.Unstructured) (client.Object, error) {
+	if !scheme.Recognizes(obj.GroupVersionKind()) {
+		return obj.DeepCopy(), nil
+	}
+	typed, err := scheme.New(obj.GroupVersionKind())
+	if err != nil {
+		return nil, err
+	}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, typed); err != nil {
+		return nil, err
+	}
+	typed.GetObjectKind().SetGroupVersionKind(obj.GroupVersionKind())
+	result, ok := typed.(client.Object)
+	if !ok {
+		return nil, fmt.Errorf("%T is not a client.Object", typed)
+	}
+	return result, nil
+}
+
+// newRESTMapper returns a RESTMapper for the kinds of the scheme and of the objects, and the
+// kinds whose gathered CustomResourceDefinition declares a status subresource. The resources and
+// scope of kinds defined by a gathered CustomResourceDefinition are taken from it.
+func newRESTMapper(scheme *runtime.Scheme, objects []*unstructured.Unstructured) (meta.RESTMapper, []schema.GroupVersionKind, error) {
+	mapper := meta.NewDefaultRESTMapper(preferredVersions(scheme, objects))
+	defined := map[schema.GroupKind]bool{}
+	var statusKinds []schema.GroupVersionKind
+
+	for _, obj := range objects {
+		if obj.GroupVersionKind().GroupKind() != (schema.GroupKind{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"}) {
+			continue
+		}
+		group, _, _ := unstructured.NestedString(obj.Object, "spec", "group")
+		kind, _, _ := unstructured.NestedString(obj.Object, "spec", "names", "kind")
+		plural, _, _ := unstructured.NestedString(obj.Object, "spec", "names", "plural")
+		singular, _, _ := unstructured.NestedString(obj.Object, "spec", "names", "singular")
+		scope, _, _ := unstructured.NestedString(obj.Object, "spec", "scope")
+		versions, _, err := unstructured.NestedSlice(obj.Object, "spec", "versions")
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid versions in CustomResourceDefinition %s. %v", obj.GetName(), err)
+		}
+		if len(kind) == 0 || len(plural) == 0 {
+			continue
+		}
+		if len(singular) == 0 {
+			singular = strings.ToLower(kind)
+		}
+		restScope := meta.RESTScopeNamespace
+		if scope == "Cluster" {
+			restScope = meta.RESTScopeRoot
+		}
+
+		for _, item := range versions {
+			version, ok := item.(map[string]any)
+			if !ok {
+				continue
+			}
+			name, _, _ := unstructured.NestedString(version, "name")
+			gvk := schema.GroupVersionKind{Group: group, Version: name, Kind: kind}
+			mapper.AddSpecific(gvk,
+				gvk.GroupVersion().WithResource(plural),
+				gvk.GroupVersion().WithResource(singular),
+				restScope)
+			if _, ok, _ := unstructured.NestedMap(version, "subresources", "status"); ok {
+				statusKinds = append(statusKinds, gvk)
+			}
+		}
+		defined[schema.GroupKind{Group: group, Kind: kind}] = true
+	}
+
+	gathered := map[schema.GroupKind]bool{}
+	namespaced := map[schema.GroupKind]bool{}
+	for _, obj := range objects {
+		gathered[obj.GroupVersionKind().GroupKind()] = true
+		if len(obj.GetNamespace()) > 0 {
+			namespaced[obj.GroupVersionKind().GroupKind()] = true
+		}
+	}
+	add := func(gvk schema.GroupVersionKind, root bool) {
+		if defined[gvk.GroupKind()] || strings.HasSuffix(gvk.Kind, "List") {
+			return
+		}
+		scope := meta.RESTScopeNamespace
+		if root {
+			scope = meta.RESTScopeRoot
+		}
+		mapper.Add(gvk, scope)
+	}
+	for gvk := range scheme.AllKnownTypes() {
+		if gvk.Version == runtime.APIVersionInternal {
+			continue
+		}
+		add(gvk, rootScopedKinds[gvk.GroupKind()])
+	}
+	for _, obj := range objects {
+		gvk := obj.GroupVersionKind()
+		if !scheme.Recognizes(gvk) {
+			add(gvk, !namespaced[gvk.GroupKind()])
+		}
+	}
+
+	return mapper, statusKinds, nil
+}
+
+// preferredVersions returns the group versions a kind is mapped to when no version is asked for:
+// the prioritized versions of the scheme, then the versions of the gathered CustomResourceDefinitions
+// and objects in the order they appear.
+func preferredVersions(scheme *runtime.Scheme, objects []*unstructured.Unstructured) []schema.GroupVersion {
+	versions := scheme.PrioritizedVersionsAllGroups()
+	seen := map[schema.GroupVersion]bool{}
+	for _, gv := range versions {
+		seen[gv] = true
+	}
+	add := func(gv schema.GroupVersion) {
+		if !seen[gv] {
+			seen[gv] = true
+			versions = append(versions, gv)
+		}
+	}
+	for _, obj := range objects {
+		if obj.GroupVersionKind().GroupKind() == (schema.GroupKind{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"}) {
+			group, _, _ := unstructured.NestedString(obj.Object, "spec", "group")
+			items, _, _ := unstructured.NestedSlice(obj.Object, "spec", "versions")
+			for _, item := range items {
+				if version, ok := item.(map[string]any); ok {
+					name, _, _ := unstructured.NestedString(version, "name")
+					add(schema.GroupVersion{Group: group, Version: name})
+				}
+			}
+		}
+	}
+	for _, obj := range objects {
+		add(obj.GroupVersionKind().GroupVersion())
+	}
+	return versions
+}
@@ -0,0 +1,186 @@
+package hydrate
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	configv1 "github.com/openshift/api/config/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var fakeMustGather = map[string]string{
+	"cluster-scoped-resources/core/nodes/master-0.yaml": `
+apiVersion: v1
+kind: Node
+metadata:
+  name: master-0
+status:
+  nodeInfo:
+    kubeletVersion: v1.31.0
+`,
+	"namespaces/default/core/configmaps.yaml": `
+apiVersion: v1
+kind: ConfigMapList
+items:
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: settings
+    namespace: default
+  data:
+    mode: test
+`,
+	"cluster-scoped-resources/apiextensions.k8s.io/customresourcedefinitions/widgets.example.com.yaml": `
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+spec:
+  group: example.com
+  scope: Cluster
+  names:
+    kind: Widget
+    plural: widgets
+    singular: widget
+  versions:
+  - name: v1
+    served: true
+    storage: true
+    subresources:
+      status: {}
+`,
+	"cluster-scoped-resources/config.openshift.io/clusteroperators/storage.yaml": `
+apiVersion: config.openshift.io/v1
+kind: ClusterOperator
+metadata:
+  name: storage
+status:
+  versions:
+  - name: operator
+    version: 4.19.0
+`,
+	"cluster-scoped-resources/example.com/widgets/cluster.yaml": `
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: cluster
+spec:
+  size: 3
+`,
+}
+
+func TestNewFakeClient(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range fakeMustGather {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	clients, err := NewFakeClient(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	node := &corev1.Node{}
+	if err := clients.Client.Get(ctx, client.ObjectKey{Name: "master-0"}, node); err != nil {
+		t.Fatal(err)
+	}
+	if node.Status.NodeInfo.KubeletVersion != "v1.31.0" {
+		t.Errorf("unexpected kubelet version %q", node.Status.NodeInfo.KubeletVersion)
+	}
+
+	// the scope of a kind of the scheme without a gathered CustomResourceDefinition
+	operator := &configv1.ClusterOperator{}
+	if err := clients.Client.Get(ctx, client.ObjectKey{Name: "storage"}, operator); err != nil {
+		t.Fatal(err)
+	}
+	if len(operator.Status.Versions) != 1 || operator.Status.Versions[0].Version != "4.19.0" {
+		t.Errorf("unexpected cluster operator status %+v", operator.Status)
+	}
+	scopes := map[schema.GroupKind]meta.RESTScopeName{
+		{Group: "config.openshift.io", Kind: "ClusterOperator"}:              meta.RESTScopeNameRoot,
+		{Group: "config.openshift.io", Kind: "Infrastructure"}:               meta.RESTScopeNameRoot,
+		{Group: "security.openshift.io", Kind: "SecurityContextConstraints"}: meta.RESTScopeNameRoot,
+		{Group: "project.openshift.io", Kind: "Project"}:                     meta.RESTScopeNameRoot,
+		{Group: "user.openshift.io", Kind: "User"}:                           meta.RESTScopeNameRoot,
+		{Group: "user.openshift.io", Kind: "Group"}:                          meta.RESTScopeNameRoot,
+		{Group: "quota.openshift.io", Kind: "ClusterResourceQuota"}:          meta.RESTScopeNameRoot,
+		{Group: "image.openshift.io", Kind: "Image"}:                         meta.RESTScopeNameRoot,
+		{Group: "oauth.openshift.io", Kind: "OAuthClient"}:                   meta.RESTScopeNameRoot,
+		{Group: "operator.openshift.io", Kind: "Network"}:                    meta.RESTScopeNameRoot,
+		{Group: "operator.openshift.io", Kind: "KubeAPIServer"}:              meta.RESTScopeNameRoot,
+		{Group: "operator.openshift.io", Kind: "IngressController"}:          meta.RESTScopeNameNamespace,
+		{Group: "route.openshift.io", Kind: "Route"}:                         meta.RESTScopeNameNamespace,
+		{Group: "apps", Kind: "Deployment"}:                                  meta.RESTScopeNameNamespace,
+		{Group: "rbac.authorization.k8s.io", Kind: "ClusterRole"}:            meta.RESTScopeNameRoot,
+		{Group: "example.com", Kind: "Widget"}:                               meta.RESTScopeNameRoot,
+	}
+	for groupKind, scope := range scopes {
+		// no version, so the mapper must pick the preferred one
+		mapping, err := clients.RESTMapper.RESTMapping(groupKind)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mapping.Scope.Name() != scope {
+			t.Errorf("expected %s to be %s scoped, got %s", groupKind, scope, mapping.Scope.Name())
+		}
+	}
+
+	configMaps := &corev1.ConfigMapList{}
+	if err := clients.Client.List(ctx, configMaps, client.InNamespace("default")); err != nil {
+		t.Fatal(err)
+	}
+	if len(configMaps.Items) != 1 || configMaps.Items[0].Data["mode"] != "test" {
+		t.Errorf("unexpected config maps %+v", configMaps.Items)
+	}
+
+	widgetGVK := schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"}
+	mapping, err := clients.RESTMapper.RESTMapping(widgetGVK.GroupKind(), widgetGVK.Version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mapping.Resource.Resource != "widgets" || mapping.Scope.Name() != "root" {
+		t.Errorf("unexpected mapping %+v", mapping)
+	}
+
+	widget := &unstructured.Unstructured{}
+	widget.SetGroupVersionKind(widgetGVK)
+	if err := clients.Client.Get(ctx, client.ObjectKey{Name: "cluster"}, widget); err != nil {
+		t.Fatal(err)
+	}
+	widget.Object["status"] = map[string]any{"ready": true}
+	widget.Object["spec"] = map[string]any{"size": int64(5)}
+	if err := clients.Client.Status().Update(ctx, widget); err != nil {
+		t.Fatal(err)
+	}
+	if err := clients.Client.Get(ctx, client.ObjectKey{Name: "cluster"}, widget); err != nil {
+		t.Fatal(err)
+	}
+	if ready, _, _ := unstructured.NestedBool(widget.Object, "status", "ready"); !ready {
+		t.Error("expected the status to be updated")
+	}
+	if size, _, _ := unstructured.NestedInt64(widget.Object, "spec", "size"); size != 3 {
+		t.Errorf("expected a status update to leave the spec unchanged, got size %d", size)
+	}
+
+	widgets, err := clients.Dynamic.Resource(mapping.Resource).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(widgets.Items) != 1 || widgets.Items[0].GetName() != "cluster" {
+		t.Errorf("unexpected widgets %+v", widgets.Items)
+	}
+}
@@ -0,0 +1,274 @@
+// Package hydrate starts a control plane hydrated from a must-gather for use in tests.
+//
+//	cluster, err := hydrate.Start(ctx, hydrate.Options{
+//		Path:    "testdata/must-gather",
+//		Include: []string{"Node", "Infrastructure.config.openshift.io"},
+//	})
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//	defer cluster.Stop()
+//	if err := cluster.WaitForHydrated(ctx); err != nil {
+//		t.Fatal(err)
+//	}
+package hydrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/openshift-splat-team/must-hydrate/pkg/changes"
+	"github.com/openshift-splat-team/must-hydrate/pkg/controller"
+	"github.com/openshift-splat-team/must-hydrate/pkg/export"
+	oainstall "github.com/openshift/api"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// alwaysIncluded are the kinds hydrated even when they are not included, so that the included
+// resources can be created.
+var alwaysIncluded = []string{
+	"CustomResourceDefinition.apiextensions.k8s.io",
+	"Namespace",
+}
+
+// Options configure the hydrated control plane.
+type Options struct {
+	// Path is the must-gather directory.
+	Path string
+	// Include are the kinds to hydrate, optionally qualified by their group such as
+	// Infrastructure.config.openshift.io. All kinds are hydrated if none are included.
+	// CustomResourceDefinitions and Namespaces are always hydrated unless they are excluded.
+	Include []string
+	// Exclude are the kinds not to hydrate.
+	Exclude []string
+	// Closure are objects to hydrate along with the objects they depend on, such as their owners,
+	// namespaces and the ConfigMaps and Secrets of their pods. No other objects are hydrated. See
+	// export.Closure.
+	Closure []export.Ref
+	// Overlays are directories of patches, deletions and objects applied on top of the must-gather.
+	// See the overlay package.
+	Overlays []string
+	// Deterministic records the gathered UID and creation timestamp of each object in the
+	// controller.OriginalUIDAnnotation and controller.OriginalCreationTimestampAnnotation
+	// annotations, which are the same on every run, unlike the values assigned by the API server.
+	Deterministic bool
+	// Controllers are kube-controller-manager controllers, such as controller.DefaultControllers,
+	// run once hydration converges. The kube-controller-manager binary is looked up next to the
+	// envtest binaries and then on the PATH.
+	Controllers []string
+	// RecordChanges records every create, update, patch and delete made once hydration converges,
+	// and who made it. See Cluster.Changes.
+	RecordChanges bool
+	// AuditLogPath is the file the API server writes its audit log to. See audit.ReadLog.
+	AuditLogPath string
+	// AuditPolicyPath is the audit policy of the API server. Defaults to audit.DefaultPolicy when
+	// AuditLogPath is set.
+	AuditPolicyPath string
+	// Scheme is the scheme of the returned client. Defaults to the Kubernetes and OpenShift APIs.
+	Scheme *runtime.Scheme
+	// Logger receives the log messages of the hydrator. Defaults to the controller-runtime logger.
+	Logger logr.Logger
+}
+
+// Cluster is a control plane hydrated from a must-gather.
+type Cluster struct {
+	// Config is the configuration of the control plane, with full access.
+	Config *rest.Config
+	// Client is a client for the control plane.
+	Client client.Client
+
+	hydrator *controller.HydratorReconciler
+	recorder *changes.Recorder
+}
+
+// Start starts a control plane and begins hydrating the must-gather in to it. The must-gather is
+// never written to and no kubeconfig is written. Resources are hydrated in the background until
+// ctx is done or Stop is called; use WaitForHydrated to wait for every resource to be applied.
+func Start(ctx context.Context, options Options) (*Cluster, error) {
+	if len(options.Path) == 0 {
+		return nil, errors.New("the path of a must-gather is required")
+	}
+
+	scheme := options.Scheme
+	if scheme == nil {
+		var err error
+		if scheme, err = DefaultScheme(); err != nil {
+			return nil, err
+		}
+	}
+
+	filter := newFilter(options.Include, options.Exclude)
+	if len(options.Closure) > 0 {
+		closureFilter, err := newClosureFilter(options)
+		if err != nil {
+			return nil, err
+		}
+		filter = both(filter, closureFilter)
+	}
+
+	hydrator := &controller.HydratorReconciler{
+		RootPath:           options.Path,
+		Logger:             options.Logger,
+		LogDisabled:        true,
+		Writable:           true,
+		KubeconfigDisabled: true,
+		ResourceFilter:     filter,
+		Overlays:           options.Overlays,
+		Deterministic:      options.Deterministic,
+		Controllers:        options.Controllers,
+		AuditLogPath:       options.AuditLogPath,
+		AuditPolicyPath:    options.AuditPolicyPath,
+	}
+	if options.RecordChanges {
+		recorder, err := changes.NewRecorder()
+		if err != nil {
+			return nil, err
+		}
+		hydrator.ChangeRecorder = recorder
+	}
+	if err := hydrator.Initialize(ctx); err != nil {
+		return nil, errors.Join(err, closeRecorder(hydrator.ChangeRecorder))
+	}
+
+	c, err := client.New(hydrator.RESTConfig(), client.Options{Scheme: scheme})
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("unable to create client. %v", err), hydrator.Stop(), closeRecorder(hydrator.ChangeRecorder))
+	}
+
+	return &Cluster{
+		Config:   hydrator.RESTConfig(),
+		Client:   c,
+		hydrator: hydrator,
+		recorder: hydrator.ChangeRecorder,
+	}, nil
+}
+
+// closeRecorder stops the audit webhook of the recorder, if there is one.
+func closeRecorder(recorder *changes.Recorder) error {
+	if recorder == nil {
+		return nil
+	}
+	return recorder.Close()
+}
+
+// DefaultScheme returns a scheme with the Kubernetes and OpenShift APIs.
+func DefaultScheme() (*runtime.Scheme, error) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		return nil, fmt.Errorf("unable to add the Kubernetes APIs to the scheme. %v", err)
+	}
+	if err := oainstall.Install(scheme); err != nil {
+		return nil, fmt.Errorf("unable to add the OpenShift APIs to the scheme. %v", err)
+	}
+	return scheme, nil
+}
+
+// WaitForHydrated waits until every resource of the must-gather has been applied to the control
+// plane, or ctx is done.
+func (c *Cluster) WaitForHydrated(ctx context.Context) error {
+	select {
+	case <-c.hydrator.Converged():
+		return nil
+	case <-ctx.Done():
+		status := c.hydrator.Status()
+		return fmt.Errorf("%d of %d resources were not hydrated: %v. %v", status.Remaining, status.Loaded, status.RemainingByKind, ctx.Err())
+	}
+}
+
+// Status returns the progress of hydrating the must-gather.
+func (c *Cluster) Status() controller.HydrationStatus {
+	return c.hydrator.Status()
+}
+
+// Changes reports how each object written since hydration converged differs from its hydrated
+// state, along with the requests which wrote it and who made them. Options.RecordChanges must be set.
+func (c *Cluster) Changes(ctx context.Context) (*changes.Report, error) {
+	if c.recorder == nil {
+		return nil, errors.New("changes are not recorded unless RecordChanges is set")
+	}
+	return c.recorder.Report(ctx)
+}
+
+// Stop stops the control plane and removes the files generated for it. It is safe to call Stop
+// more than once.
+func (c *Cluster) Stop() error {
+	return errors.Join(c.hydrator.Stop(), closeRecorder(c.recorder))
+}
+
+// newFilter returns a filter which accepts the included kinds, or all kinds if none are
+// included, unless they are excluded.
+func newFilter(include []string, exclude []string) func(*unstructured.Unstructured) bool {
+	if len(include) == 0 && len(exclude) == 0 {
+		return nil
+	}
+	if len(include) > 0 {
+		include = append(append([]string{}, include...), alwaysIncluded...)
+	}
+	return func(obj *unstructured.Unstructured) bool {
+		for _, kind := range exclude {
+			if export.KindMatches(kind, obj) {
+				return false
+			}
+		}
+		if len(include) == 0 {
+			return true
+		}
+		for _, kind := range include {
+			if export.KindMatches(kind, obj) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// newClosureFilter loads the must-gather and returns a filter which accepts the objects of the
+// closure of options.Closure.
+func newClosureFilter(options Options) (func(*unstructured.Unstructured) bool, error) {
+	loader := &controller.HydratorReconciler{
+		RootPath:    options.Path,
+		Logger:      options.Logger,
+		LogDisabled: true,
+		Overlays:    options.Overlays,
+	}
+	if err := loader.Load(); err != nil {
+		return nil, err
+	}
+	closure, err := export.Closure(loader.Resources(), options.Closure)
+	if err != nil {
+		return nil, err
+	}
+
+	included := map[string]bool{}
+	for _, obj := range closure {
+		included[closureKey(obj)] = true
+	}
+	return func(obj *unstructured.Unstructured) bool {
+		return included[closureKey(obj)]
+	}, nil
+}
+
+func closureKey(obj *unstructured.Unstructured) string {
+	return strings.Join([]string{obj.GetAPIVersion(), obj.GetKind(), obj.GetNamespace(), obj.GetName()}, "/")
+}
+
+// both returns a filter which accepts the objects accepted by both filters, either of which may
+// be nil.
+func both(a, b func(*unstructured.Unstructured) bool) func(*unstructured.Unstructured) bool {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	return func(obj *unstructured.Unstructured) bool {
+		return a(obj) && b(obj)
+	}
+}
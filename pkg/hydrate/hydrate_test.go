@@ -0,0 +1,38 @@
+package hydrate
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestNewFilter(t *testing.T) {
+	object := func(apiVersion, kind string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion(apiVersion)
+		obj.SetKind(kind)
+		return obj
+	}
+	node := object("v1", "Node")
+	pod := object("v1", "Pod")
+	namespace := object("v1", "Namespace")
+	crd := object("apiextensions.k8s.io/v1", "CustomResourceDefinition")
+
+	if newFilter(nil, nil) != nil {
+		t.Error("expected no filter when nothing is included or excluded")
+	}
+
+	include := newFilter([]string{"Node"}, nil)
+	for obj, expected := range map[*unstructured.Unstructured]bool{node: true, pod: false, namespace: true, crd: true} {
+		if include(obj) != expected {
+			t.Errorf("expected include filter to return %t for %s", expected, obj.GetKind())
+		}
+	}
+
+	exclude := newFilter(nil, []string{"pod", "Namespace"})
+	for obj, expected := range map[*unstructured.Unstructured]bool{node: true, pod: false, namespace: false, crd: true} {
+		if exclude(obj) != expected {
+			t.Errorf("expected exclude filter to return %t for %s", expected, obj.GetKind())
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package logs
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// LayoutResolver maps the path of a log file to the container log it holds.
+type LayoutResolver interface {
+	// Name returns a short description of the layout.
+	Name() string
+	// Resolve returns the container log held by the file at logPath. false is returned if
+	// the path does not match the layout.
+	Resolve(logPath string) (Source, bool)
+}
+
+// DefaultLayouts are the layouts produced by must-gather, oc adm inspect and CI artifact gathering.
+var DefaultLayouts = []LayoutResolver{
+	MustGatherLayout{},
+	InspectLayout{},
+	CILayout{},
+}
+
+// Resolve returns the container log held by the file at logPath using the first resolver which
+// recognizes the path.
+func Resolve(logPath string, resolvers []LayoutResolver) (Source, bool) {
+	for _, resolver := range resolvers {
+		if source, ok := resolver.Resolve(logPath); ok {
+			return source, true
+		}
+	}
+	return Source{}, false
+}
+
+// IsCandidate returns true if the file at logPath looks like a container log. Candidates which
+// are not recognized by any layout are reported as unmapped.
+func IsCandidate(logPath string) bool {
+	return strings.HasSuffix(logPath, ".log") && strings.Contains(filepath.ToSlash(logPath), "/pods/")
+}
+
+// logFileKind returns whether a kubelet log file name is for the current or previous container
+// instance.
+func logFileKind(name string) (previous bool, ok bool) {
+	switch name {
+	case "current.log", "current.insecure.log":
+		return false, true
+	case "previous.log", "previous.insecure.log":
+		return true, true
+	}
+	return false, false
+}
+
+// namespacedTail returns the path components following the last "namespaces" directory which
+// leaves exactly n components. Any prefix, such as the image directory of a must-gather, is ignored.
+func namespacedTail(logPath string, n int) ([]string, bool) {
+	parts := strings.Split(filepath.ToSlash(logPath), "/")
+	if len(parts) < n+1 || parts[len(parts)-n-1] != "namespaces" {
+		return nil, false
+	}
+	return parts[len(parts)-n:], true
+}
+
+// MustGatherLayout resolves logs written by must-gather:
+// namespaces/<namespace>/pods/<pod>/<container>/<container>/logs/{current,previous}.log
+type MustGatherLayout struct{}
+
+func (MustGatherLayout) Name() string {
+	return "must-gather"
+}
+
+func (MustGatherLayout) Resolve(logPath string) (Source, bool) {
+	parts, ok := namespacedTail(logPath, 7)
+	if !ok || parts[1] != "pods" || parts[3] != parts[4] || parts[5] != "logs" {
+		return Source{}, false
+	}
+	previous, ok := logFileKind(parts[6])
+	if !ok {
+		return Source{}, false
+	}
+	return Source{
+		Namespace: parts[0],
+		Pod:       parts[2],
+		Container: parts[3],
+		Path:      logPath,
+		Previous:  previous,
+	}, true
+}
+
+// InspectLayout resolves logs written by older releases of oc adm inspect:
+// namespaces/<namespace>/pods/<pod>/<container>/logs/{current,previous}.log
+type InspectLayout struct{}
+
+func (InspectLayout) Name() string {
+	return "inspect"
+}
+
+func (InspectLayout) Resolve(logPath string) (Source, bool) {
+	parts, ok := namespacedTail(logPath, 6)
+	if !ok || parts[1] != "pods" || parts[4] != "logs" {
+		return Source{}, false
+	}
+	previous, ok := logFileKind(parts[5])
+	if !ok {
+		return Source{}, false
+	}
+	return Source{
+		Namespace: parts[0],
+		Pod:       parts[2],
+		Container: parts[3],
+		Path:      logPath,
+		Previous:  previous,
+	}, true
+}
+
+// CILayout resolves the flat files gathered from CI clusters:
+// pods/<namespace>_<pod>_<container>[_previous].log
+type CILayout struct{}
+
+func (CILayout) Name() string {
+	return "ci"
+}
+
+func (CILayout) Resolve(logPath string) (Source, bool) {
+	dir, name := filepath.Split(logPath)
+	if filepath.Base(dir) != "pods" || !strings.HasSuffix(name, ".log") {
+		return Source{}, false
+	}
+
+	// underscores are not valid in namespace, pod or container names
+	parts := strings.Split(strings.TrimSuffix(name, ".log"), "_")
+	previous := false
+	if len(parts) == 4 && parts[3] == "previous" {
+		previous = true
+		parts = parts[:3]
+	}
+	if len(parts) != 3 {
+		return Source{}, false
+	}
+	return Source{
+		Namespace: parts[0],
+		Pod:       parts[1],
+		Container: parts[2],
+		Path:      logPath,
+		Previous:  previous,
+	}, true
+}
@@ -0,0 +1,86 @@
+package logs
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected *Source
+	}{
+		{
+			path:     "/data/quay-io-openshift-release-dev-sha256-abc/namespaces/openshift-etcd/pods/etcd-master-0/etcd/etcd/logs/current.log",
+			expected: &Source{Namespace: "openshift-etcd", Pod: "etcd-master-0", Container: "etcd"},
+		},
+		{
+			path:     "/data/namespaces/openshift-etcd/pods/etcd-master-0/setup/setup/logs/previous.log",
+			expected: &Source{Namespace: "openshift-etcd", Pod: "etcd-master-0", Container: "setup", Previous: true},
+		},
+		{
+			path:     "/data/inspect.local.123/namespaces/openshift-ingress/pods/router-1/router/logs/current.log",
+			expected: &Source{Namespace: "openshift-ingress", Pod: "router-1", Container: "router"},
+		},
+		{
+			path:     "/artifacts/gather-extra/artifacts/pods/openshift-ingress_router-1_router_previous.log",
+			expected: &Source{Namespace: "openshift-ingress", Pod: "router-1", Container: "router", Previous: true},
+		},
+		{
+			path: "/data/host_service_logs/masters/kubelet_service.log",
+		},
+		{
+			path: "/data/namespaces/openshift-etcd/pods/etcd-master-0/etcd/etcd/logs/rotated.log",
+		},
+	}
+
+	for _, test := range tests {
+		source, ok := Resolve(test.path, DefaultLayouts)
+		if test.expected == nil {
+			if ok {
+				t.Errorf("expected %s to be unresolved, got %+v", test.path, source)
+			}
+			continue
+		}
+		test.expected.Path = test.path
+		if !ok || source != *test.expected {
+			t.Errorf("expected %s to resolve to %+v, got %+v", test.path, *test.expected, source)
+		}
+	}
+}
+
+func TestCrossCheck(t *testing.T) {
+	pod := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "v1",
+		"kind":       "Pod",
+		"metadata": map[string]any{
+			"namespace": "openshift-etcd",
+			"name":      "etcd-master-0",
+		},
+		"spec": map[string]any{
+			"initContainers": []any{map[string]any{"name": "setup"}},
+			"containers":     []any{map[string]any{"name": "etcd"}, map[string]any{"name": "etcdctl"}},
+		},
+	}}
+	sources := []Source{
+		{Namespace: "openshift-etcd", Pod: "etcd-master-0", Container: "setup"},
+		{Namespace: "openshift-etcd", Pod: "etcd-master-0", Container: "etcd"},
+		{Namespace: "openshift-etcd", Pod: "etcd-master-0", Container: "etcd-metrics"},
+		{Namespace: "openshift-etcd", Pod: "etcd-master-1", Container: "etcd"},
+	}
+
+	report := CrossCheck(sources, []string{"/data/namespaces/x/pods/y/z.log"}, []*unstructured.Unstructured{pod})
+	if len(report.UnmappedFiles) != 1 {
+		t.Errorf("expected 1 unmapped file, got %v", report.UnmappedFiles)
+	}
+	if len(report.LogsWithoutPod) != 1 || report.LogsWithoutPod[0].Pod != "etcd-master-1" {
+		t.Errorf("unexpected logs without pod %v", report.LogsWithoutPod)
+	}
+	if len(report.LogsWithoutContainer) != 1 || report.LogsWithoutContainer[0].Container != "etcd-metrics" {
+		t.Errorf("unexpected logs without container %v", report.LogsWithoutContainer)
+	}
+	if len(report.ContainersWithoutLogs) != 1 || report.ContainersWithoutLogs[0].Container != "etcdctl" {
+		t.Errorf("unexpected containers without logs %v", report.ContainersWithoutLogs)
+	}
+}
@@ -0,0 +1,54 @@
+package logs
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Replay writes each line read from r to w, waiting between lines for the time which passed
+// between their timestamps divided by speed. Lines without a timestamp are written immediately.
+// flush is called after each line so that the line is delivered to streaming consumers.
+func Replay(ctx context.Context, r io.Reader, w io.Writer, flush func() error, speed float64) error {
+	if speed <= 0 {
+		return fmt.Errorf("replay speed must be greater than zero")
+	}
+
+	reader := bufio.NewReaderSize(r, 64*1024)
+	var last time.Time
+
+	for {
+		line, readErr := reader.ReadString('\n')
+		if len(line) > 0 {
+			if timestamp, ok := ParseTimestamp(line); ok {
+				if !last.IsZero() && timestamp.After(last) {
+					delay := time.Duration(float64(timestamp.Sub(last)) / speed)
+					timer := time.NewTimer(delay)
+					select {
+					case <-ctx.Done():
+						timer.Stop()
+						return ctx.Err()
+					case <-timer.C:
+					}
+				}
+				last = timestamp
+			}
+
+			if _, err := io.WriteString(w, line); err != nil {
+				return err
+			}
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+
+		if readErr == io.EOF {
+			return nil
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+}
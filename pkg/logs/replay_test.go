@@ -0,0 +1,41 @@
+package logs
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReplay(t *testing.T) {
+	log := "2025-02-20T10:00:00Z first\nno timestamp\n2025-02-20T10:00:01Z second\n2025-02-20T10:00:01.5Z third"
+
+	var out bytes.Buffer
+	flushes := 0
+	start := time.Now()
+	err := Replay(context.TODO(), strings.NewReader(log), &out, func() error {
+		flushes++
+		return nil
+	}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("expected the replay to be paced by the log timestamps, took %s", elapsed)
+	}
+	if out.String() != log {
+		t.Errorf("unexpected replay output %q", out.String())
+	}
+	if flushes != 4 {
+		t.Errorf("expected a flush per line, got %d", flushes)
+	}
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	err = Replay(ctx, strings.NewReader(log), &out, func() error { return nil }, 0.001)
+	if err != context.Canceled {
+		t.Errorf("expected the replay to be canceled, got %v", err)
+	}
+}
@@ -0,0 +1,93 @@
+package logs
+
+import (
+	"sort"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// ContainerRef identifies a container of a pod.
+type ContainerRef struct {
+	Namespace string `json:"namespace"`
+	Pod       string `json:"pod"`
+	Container string `json:"container"`
+}
+
+// Report describes the differences between the logs found in a must-gather and the containers
+// of the gathered pods.
+type Report struct {
+	// UnmappedFiles are files which look like container logs but match no known layout.
+	UnmappedFiles []string `json:"unmappedFiles,omitempty"`
+	// LogsWithoutPod are logs for pods which were not gathered.
+	LogsWithoutPod []Source `json:"logsWithoutPod,omitempty"`
+	// LogsWithoutContainer are logs for containers which are not in the spec of the gathered pod.
+	LogsWithoutContainer []Source `json:"logsWithoutContainer,omitempty"`
+	// ContainersWithoutLogs are containers of gathered pods which have no log. Only namespaces
+	// with at least one log are considered since logs are not gathered for every namespace.
+	ContainersWithoutLogs []ContainerRef `json:"containersWithoutLogs,omitempty"`
+}
+
+// CrossCheck compares the discovered logs with the containers, init containers and ephemeral
+// containers of the gathered pods.
+func CrossCheck(sources []Source, unmappedFiles []string, pods []*unstructured.Unstructured) Report {
+	report := Report{
+		UnmappedFiles: unmappedFiles,
+	}
+
+	podContainers := map[string]map[string]bool{}
+	for _, pod := range pods {
+		containers := map[string]bool{}
+		for _, field := range []string{"containers", "initContainers", "ephemeralContainers"} {
+			specContainers, _, _ := unstructured.NestedSlice(pod.Object, "spec", field)
+			for _, specContainer := range specContainers {
+				if container, ok := specContainer.(map[string]any); ok {
+					if name, ok := container["name"].(string); ok {
+						containers[name] = false
+					}
+				}
+			}
+		}
+		podContainers[pod.GetNamespace()+"/"+pod.GetName()] = containers
+	}
+
+	namespacesWithLogs := map[string]bool{}
+	for _, source := range sources {
+		namespacesWithLogs[source.Namespace] = true
+
+		containers, exists := podContainers[source.Namespace+"/"+source.Pod]
+		if !exists {
+			report.LogsWithoutPod = append(report.LogsWithoutPod, source)
+			continue
+		}
+		if _, exists := containers[source.Container]; !exists {
+			report.LogsWithoutContainer = append(report.LogsWithoutContainer, source)
+			continue
+		}
+		containers[source.Container] = true
+	}
+
+	for _, pod := range pods {
+		if !namespacesWithLogs[pod.GetNamespace()] {
+			continue
+		}
+		for container, hasLog := range podContainers[pod.GetNamespace()+"/"+pod.GetName()] {
+			if !hasLog {
+				report.ContainersWithoutLogs = append(report.ContainersWithoutLogs, ContainerRef{
+					Namespace: pod.GetNamespace(),
+					Pod:       pod.GetName(),
+					Container: container,
+				})
+			}
+		}
+	}
+
+	sort.Strings(report.UnmappedFiles)
+	sortSources(report.LogsWithoutPod)
+	sortSources(report.LogsWithoutContainer)
+	sort.Slice(report.ContainersWithoutLogs, func(i, j int) bool {
+		a, b := report.ContainersWithoutLogs[i], report.ContainersWithoutLogs[j]
+		return a.Namespace+"/"+a.Pod+"/"+a.Container < b.Namespace+"/"+b.Pod+"/"+b.Container
+	})
+
+	return report
+}
@@ -0,0 +1,296 @@
+package logs
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path"
+	"regexp"
+	"regexp/syntax"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultSearchLimit is the number of matches returned when a query does not set a limit.
+	DefaultSearchLimit = 100
+
+	// trigramFilterBits is the number of bits in the trigram filter kept for each log.
+	trigramFilterBits = 1 << 16
+
+	maxLineLength = 1024 * 1024
+)
+
+// trigramFilter is a fixed size bit set of the hashed trigrams found in a log. A literal
+// can only be present in a log if all of its trigrams are set.
+type trigramFilter [trigramFilterBits / 64]uint64
+
+func trigramBit(trigram string) uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(trigram))
+	return h.Sum32() % trigramFilterBits
+}
+
+func (f *trigramFilter) add(line string) {
+	for i := 0; i+3 <= len(line); i++ {
+		bit := trigramBit(line[i : i+3])
+		f[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+func (f *trigramFilter) mayContain(literal string) bool {
+	for i := 0; i+3 <= len(literal); i++ {
+		bit := trigramBit(literal[i : i+3])
+		if f[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+type indexedSource struct {
+	Source
+
+	filter *trigramFilter
+}
+
+// Index is a search index over the container logs of a must-gather.
+type Index struct {
+	lock    sync.RWMutex
+	sources []*indexedSource
+}
+
+// Query describes a search across container logs.
+type Query struct {
+	// Pattern is a regular expression matched against each log line.
+	Pattern string
+	// Namespace, Pod and Container optionally restrict the logs searched. Glob patterns are supported.
+	Namespace string
+	Pod       string
+	Container string
+	// Offset is the number of matches to skip.
+	Offset int
+	// Limit is the maximum number of matches to return.
+	Limit int
+}
+
+// Match is a log line which matched a query.
+type Match struct {
+	Namespace string     `json:"namespace"`
+	Pod       string     `json:"pod"`
+	Container string     `json:"container"`
+	Previous  bool       `json:"previous,omitempty"`
+	Line      int        `json:"line"`
+	Timestamp *time.Time `json:"timestamp,omitempty"`
+	Text      string     `json:"text"`
+}
+
+// Result is a page of matches.
+type Result struct {
+	Matches []Match `json:"matches"`
+	// NextOffset is the offset of the next page of matches. It is zero when there are no more matches.
+	NextOffset int `json:"nextOffset,omitempty"`
+}
+
+// NewIndex returns an index over the provided sources. Sources are searched in namespace, pod
+// and container order with current logs ahead of previous logs.
+func NewIndex(sources []Source) *Index {
+	index := &Index{}
+	for _, source := range sources {
+		index.sources = append(index.sources, &indexedSource{Source: source})
+	}
+	sort.SliceStable(index.sources, func(i, j int) bool {
+		return sourceLess(index.sources[i].Source, index.sources[j].Source)
+	})
+	return index
+}
+
+// Build reads each log and records the trigrams it contains. Logs which have not yet been
+// indexed are still searched, just without being filtered first.
+func (i *Index) Build(ctx context.Context) error {
+	for _, source := range i.sources {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		filter := &trigramFilter{}
+		err := forEachLine(source.Path, func(_ int, line string) bool {
+			filter.add(line)
+			return true
+		})
+		if err != nil {
+			return fmt.Errorf("unable to index log %s. %v", source.Path, err)
+		}
+
+		i.lock.Lock()
+		source.filter = filter
+		i.lock.Unlock()
+	}
+	return nil
+}
+
+// Sources returns the logs covered by the index.
+func (i *Index) Sources() []Source {
+	var sources []Source
+	for _, source := range i.sources {
+		sources = append(sources, source.Source)
+	}
+	return sources
+}
+
+// Search returns the log lines which match the query.
+func (i *Index) Search(ctx context.Context, query Query) (*Result, error) {
+	expr, err := regexp.Compile(query.Pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern. %v", err)
+	}
+	literals := requiredLiterals(query.Pattern)
+
+	if query.Limit <= 0 {
+		query.Limit = DefaultSearchLimit
+	}
+
+	result := &Result{
+		Matches: []Match{},
+	}
+	skipped := 0
+
+	for _, source := range i.sources {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if !globMatch(query.Namespace, source.Namespace) || !globMatch(query.Pod, source.Pod) || !globMatch(query.Container, source.Container) {
+			continue
+		}
+
+		i.lock.RLock()
+		filter := source.filter
+		i.lock.RUnlock()
+		if filter != nil && !mayContainAll(filter, literals) {
+			continue
+		}
+
+		more := false
+		err := forEachLine(source.Path, func(lineNumber int, line string) bool {
+			if !expr.MatchString(line) {
+				return true
+			}
+			if skipped < query.Offset {
+				skipped++
+				return true
+			}
+			if len(result.Matches) == query.Limit {
+				more = true
+				return false
+			}
+
+			match := Match{
+				Namespace: source.Namespace,
+				Pod:       source.Pod,
+				Container: source.Container,
+				Previous:  source.Previous,
+				Line:      lineNumber,
+				Text:      line,
+			}
+			if timestamp, ok := ParseTimestamp(line); ok {
+				match.Timestamp = &timestamp
+			}
+			result.Matches = append(result.Matches, match)
+			return true
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to search log %s. %v", source.Path, err)
+		}
+		if more {
+			result.NextOffset = query.Offset + query.Limit
+			break
+		}
+	}
+
+	return result, nil
+}
+
+func sourceLess(a, b Source) bool {
+	if a.Namespace != b.Namespace {
+		return a.Namespace < b.Namespace
+	}
+	if a.Pod != b.Pod {
+		return a.Pod < b.Pod
+	}
+	if a.Container != b.Container {
+		return a.Container < b.Container
+	}
+	return !a.Previous && b.Previous
+}
+
+func sortSources(sources []Source) {
+	sort.SliceStable(sources, func(i, j int) bool {
+		return sourceLess(sources[i], sources[j])
+	})
+}
+
+func globMatch(pattern string, value string) bool {
+	if len(pattern) == 0 {
+		return true
+	}
+	matched, err := path.Match(pattern, value)
+	return err == nil && matched
+}
+
+func mayContainAll(filter *trigramFilter, literals []string) bool {
+	for _, literal := range literals {
+		if !filter.mayContain(literal) {
+			return false
+		}
+	}
+	return true
+}
+
+// requiredLiterals returns the case sensitive literals which must appear in any line matched
+// by the pattern.
+func requiredLiterals(pattern string) []string {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return nil
+	}
+	re = re.Simplify()
+
+	var subs []*syntax.Regexp
+	switch re.Op {
+	case syntax.OpLiteral:
+		subs = []*syntax.Regexp{re}
+	case syntax.OpConcat:
+		subs = re.Sub
+	}
+
+	var literals []string
+	for _, sub := range subs {
+		if sub.Op == syntax.OpLiteral && sub.Flags&syntax.FoldCase == 0 {
+			literals = append(literals, string(sub.Rune))
+		}
+	}
+	return literals
+}
+
+// forEachLine calls fn with each line, and its 1-based line number, until fn returns false.
+func forEachLine(logPath string, fn func(lineNumber int, line string) bool) error {
+	file, err := os.Open(logPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), maxLineLength)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		if !fn(lineNumber, scanner.Text()) {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
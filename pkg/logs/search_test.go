@@ -0,0 +1,75 @@
+package logs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeLog(t *testing.T, dir string, name string, content string) string {
+	logPath := filepath.Join(dir, name)
+	if err := os.WriteFile(logPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return logPath
+}
+
+func TestSearch(t *testing.T) {
+	dir := t.TempDir()
+	index := NewIndex([]Source{
+		{
+			Namespace: "openshift-ingress",
+			Pod:       "router-1",
+			Container: "router",
+			Path:      writeLog(t, dir, "router.log", "2025-02-20T10:00:00.000000000Z starting\n2025-02-20T10:00:01.000000000Z x509: certificate has expired\n"),
+		},
+		{
+			Namespace: "openshift-etcd",
+			Pod:       "etcd-master-0",
+			Container: "etcd",
+			Path:      writeLog(t, dir, "etcd.log", "x509: certificate has expired\nready\nx509: certificate has expired\n"),
+		},
+	})
+	if err := index.Build(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := index.Search(context.TODO(), Query{Pattern: "certificate has expired"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Matches) != 3 {
+		t.Fatalf("expected 3 matches, got %d", len(result.Matches))
+	}
+	if result.Matches[0].Namespace != "openshift-etcd" || result.Matches[0].Line != 1 {
+		t.Errorf("unexpected first match: %+v", result.Matches[0])
+	}
+	if last := result.Matches[2]; last.Timestamp == nil || last.Line != 2 {
+		t.Errorf("expected the last match to have a timestamp: %+v", last)
+	}
+
+	result, err = index.Search(context.TODO(), Query{Pattern: "x509: .* expired", Namespace: "openshift-e*", Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Matches) != 1 || result.NextOffset != 1 {
+		t.Fatalf("expected a single match with more to follow, got %+v", result)
+	}
+
+	result, err = index.Search(context.TODO(), Query{Pattern: "x509: .* expired", Namespace: "openshift-e*", Offset: 1, Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Matches) != 1 || result.Matches[0].Line != 3 || result.NextOffset != 0 {
+		t.Fatalf("unexpected second page %+v", result)
+	}
+
+	result, err = index.Search(context.TODO(), Query{Pattern: "not present"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Matches) != 0 {
+		t.Fatalf("expected no matches, got %d", len(result.Matches))
+	}
+}
@@ -0,0 +1,50 @@
+package logs
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Source is a container log found in a must-gather.
+type Source struct {
+	Namespace string `json:"namespace"`
+	Pod       string `json:"pod"`
+	Container string `json:"container"`
+	Path      string `json:"path"`
+	// Previous is true if the log is for the previous instance of the container.
+	Previous bool `json:"previous,omitempty"`
+}
+
+// URLPath returns the kubelet URL path which serves the log.
+func (s Source) URLPath() string {
+	return fmt.Sprintf("/containerLogs/%s/%s/%s", s.Namespace, s.Pod, s.Container)
+}
+
+// Key uniquely identifies the log among the logs of a must-gather.
+func (s Source) Key() string {
+	return urlKey(s.URLPath(), s.Previous)
+}
+
+// KeyFromURL returns the key of the log requested by a kubelet container log URL.
+func KeyFromURL(u *url.URL) string {
+	return urlKey(u.Path, u.Query().Get("previous") == "true")
+}
+
+func urlKey(urlPath string, previous bool) string {
+	if previous {
+		return urlPath + "?previous=true"
+	}
+	return urlPath
+}
+
+// ParseTimestamp returns the timestamp which prefixes a log line, if there is one.
+func ParseTimestamp(line string) (time.Time, bool) {
+	field, _, _ := strings.Cut(line, " ")
+	timestamp, err := time.Parse(time.RFC3339Nano, field)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return timestamp, true
+}
@@ -0,0 +1,350 @@
+// Package overlay applies patches, deletions and new objects on top of the objects of a
+// must-gather, so that variations of one gathered cluster can be hydrated.
+//
+// An overlay is a directory of YAML or JSON files. Documents of the Patch and Delete kinds
+// change gathered objects, and any other object is added, replacing a gathered object of the
+// same kind, namespace and name:
+//
+//	apiVersion: must-hydrate.openshift.io/v1alpha1
+//	kind: Patch
+//	target:
+//	  kind: ClusterOperator.config.openshift.io
+//	  name: storage
+//	type: json
+//	patch:
+//	- op: replace
+//	  path: /status/conditions/0/status
+//	  value: "True"
+//	---
+//	apiVersion: must-hydrate.openshift.io/v1alpha1
+//	kind: Delete
+//	target:
+//	  kind: Pod
+//	  namespace: openshift-etcd
+//	  name: etcd-master-0
+package overlay
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"github.com/openshift-splat-team/must-hydrate/pkg/export"
+	oainstall "github.com/openshift/api"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	k8syaml "k8s.io/apimachinery/pkg/util/yaml"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+)
+
+// APIVersion is the apiVersion of the Patch and Delete documents of an overlay.
+const APIVersion = "must-hydrate.openshift.io/v1alpha1"
+
+// ChangeType is the type of a change made by an overlay.
+type ChangeType string
+
+const (
+	// ChangePatch patches the objects matching the target.
+	ChangePatch ChangeType = "Patch"
+	// ChangeDelete deletes the objects matching the target.
+	ChangeDelete ChangeType = "Delete"
+	// ChangeObject adds an object, replacing any object of the same kind, namespace and name.
+	ChangeObject ChangeType = "Object"
+)
+
+// PatchType is the format of a patch.
+type PatchType string
+
+const (
+	// PatchStrategic is a strategic merge patch, as applied by kubectl patch. It is only supported
+	// for the kinds of the Kubernetes and OpenShift APIs.
+	PatchStrategic PatchType = "strategic"
+	// PatchMerge is a JSON merge patch (RFC 7386).
+	PatchMerge PatchType = "merge"
+	// PatchJSON is a JSON patch (RFC 6902).
+	PatchJSON PatchType = "json"
+)
+
+// Target selects the objects a patch or deletion applies to. A target without a namespace
+// matches the named objects in any namespace.
+type Target struct {
+	// Kind is a kind, optionally qualified by its group, such as Pod or ClusterOperator.config.openshift.io.
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+}
+
+func (t Target) String() string {
+	if len(t.Namespace) > 0 {
+		return fmt.Sprintf("%s/%s/%s", t.Kind, t.Namespace, t.Name)
+	}
+	return fmt.Sprintf("%s/%s", t.Kind, t.Name)
+}
+
+// Change is one change made by an overlay.
+type Change struct {
+	// Source is the file the change was read from.
+	Source string
+	Type   ChangeType
+	// Target selects the objects patched or deleted.
+	Target Target
+	// PatchType and Patch are the format and content, as JSON, of a patch.
+	PatchType PatchType
+	Patch     []byte
+	// Object is the object added.
+	Object *unstructured.Unstructured
+}
+
+// File is a file of an overlay.
+type File struct {
+	// Path is the path of the file relative to the overlay directory.
+	Path string
+	Data []byte
+}
+
+// Overlay is a set of changes applied, in order, on top of the objects of a must-gather.
+type Overlay struct {
+	Changes []Change
+	// Files are the files the changes were read from, in the order they were read.
+	Files []File
+	// Scheme provides the types strategic merge patches are applied with. Defaults to the
+	// Kubernetes and OpenShift APIs.
+	Scheme *runtime.Scheme
+}
+
+// document is a Patch or Delete document.
+type document struct {
+	Target Target          `json:"target"`
+	Type   PatchType       `json:"type,omitempty"`
+	Patch  json.RawMessage `json:"patch,omitempty"`
+}
+
+// Load reads the overlay in dir. Files are read in lexical order, and the documents of each file
+// in the order they appear.
+func Load(dir string) (*Overlay, error) {
+	overlay := &Overlay{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !(strings.HasSuffix(path, ".yaml") || strings.HasSuffix(path, ".yml") || strings.HasSuffix(path, ".json")) {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("unable to read %s: %v", path, err)
+		}
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		overlay.Files = append(overlay.Files, File{Path: filepath.ToSlash(relPath), Data: data})
+
+		changes, err := parse(path, data)
+		if err != nil {
+			return err
+		}
+		overlay.Changes = append(overlay.Changes, changes...)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to load overlay %s: %v", dir, err)
+	}
+	return overlay, nil
+}
+
+// parse returns the changes of the documents of a file.
+func parse(source string, data []byte) ([]Change, error) {
+	var changes []Change
+	decoder := k8syaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), 4096)
+	for {
+		obj := &unstructured.Unstructured{}
+		if err := decoder.Decode(&obj.Object); err != nil {
+			if errors.Is(err, io.EOF) {
+				return changes, nil
+			}
+			return nil, fmt.Errorf("unable to decode %s: %v", source, err)
+		}
+		if len(obj.Object) == 0 {
+			continue
+		}
+
+		if obj.GetAPIVersion() != APIVersion {
+			if !obj.IsList() {
+				changes = append(changes, Change{Source: source, Type: ChangeObject, Object: obj})
+				continue
+			}
+			items, _, _ := unstructured.NestedSlice(obj.Object, "items")
+			for _, item := range items {
+				if item, ok := item.(map[string]any); ok {
+					changes = append(changes, Change{Source: source, Type: ChangeObject, Object: &unstructured.Unstructured{Object: item}})
+				}
+			}
+			continue
+		}
+
+		raw, err := json.Marshal(obj.Object)
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode %s: %v", source, err)
+		}
+		var doc document
+		if err := json.Unmarshal(raw, &doc); err != nil {
+			return nil, fmt.Errorf("unable to decode %s: %v", source, err)
+		}
+		if len(doc.Target.Kind) == 0 || len(doc.Target.Name) == 0 {
+			return nil, fmt.Errorf("%s %s: the target requires a kind and a name", source, obj.GetKind())
+		}
+
+		switch ChangeType(obj.GetKind()) {
+		case ChangePatch:
+			switch doc.Type {
+			case PatchStrategic, PatchMerge, PatchJSON:
+			case "":
+				doc.Type = PatchStrategic
+			default:
+				return nil, fmt.Errorf("%s: unsupported patch type %q. Expected strategic, merge or json", source, doc.Type)
+			}
+			if len(doc.Patch) == 0 {
+				return nil, fmt.Errorf("%s: the patch of %s is empty", source, doc.Target)
+			}
+			changes = append(changes, Change{Source: source, Type: ChangePatch, Target: doc.Target, PatchType: doc.Type, Patch: doc.Patch})
+		case ChangeDelete:
+			changes = append(changes, Change{Source: source, Type: ChangeDelete, Target: doc.Target})
+		default:
+			return nil, fmt.Errorf("%s: unsupported kind %q. Expected Patch or Delete", source, obj.GetKind())
+		}
+	}
+}
+
+// Apply applies the changes to the objects and returns the result. The objects are not modified.
+// Every patch and deletion must match at least one object; all that do not are reported in the
+// returned error.
+func (o *Overlay) Apply(objects []*unstructured.Unstructured) ([]*unstructured.Unstructured, error) {
+	scheme := o.Scheme
+	if scheme == nil {
+		var err error
+		if scheme, err = defaultScheme(); err != nil {
+			return nil, err
+		}
+	}
+
+	result := make([]*unstructured.Unstructured, len(objects))
+	copy(result, objects)
+
+	var errs []error
+	for _, change := range o.Changes {
+		switch change.Type {
+		case ChangeObject:
+			result = replace(result, change.Object.DeepCopy())
+		case ChangeDelete:
+			var kept []*unstructured.Unstructured
+			for _, obj := range result {
+				if !change.Target.matches(obj) {
+					kept = append(kept, obj)
+				}
+			}
+			if len(kept) == len(result) {
+				errs = append(errs, fmt.Errorf("%s: no object matches the deletion of %s", change.Source, change.Target))
+			}
+			result = kept
+		case ChangePatch:
+			matched := false
+			for i, obj := range result {
+				if !change.Target.matches(obj) {
+					continue
+				}
+				matched = true
+				patched, err := patch(scheme, obj, change)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("%s: unable to patch %s %s/%s: %v", change.Source, obj.GetKind(), obj.GetNamespace(), obj.GetName(), err))
+					continue
+				}
+				result[i] = patched
+			}
+			if !matched {
+				errs = append(errs, fmt.Errorf("%s: no object matches the patch of %s", change.Source, change.Target))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return result, nil
+}
+
+func (t Target) matches(obj *unstructured.Unstructured) bool {
+	return export.Selector{Refs: []export.Ref{{Kind: t.Kind, Namespace: t.Namespace, Name: t.Name}}}.Matches(obj)
+}
+
+// replace replaces the object of the same apiVersion, kind, namespace and name, or appends it.
+func replace(objects []*unstructured.Unstructured, obj *unstructured.Unstructured) []*unstructured.Unstructured {
+	for i, existing := range objects {
+		if existing.GetAPIVersion() == obj.GetAPIVersion() && existing.GetKind() == obj.GetKind() &&
+			existing.GetNamespace() == obj.GetNamespace() && existing.GetName() == obj.GetName() {
+			objects[i] = obj
+			return objects
+		}
+	}
+	return append(objects, obj)
+}
+
+// patch returns a patched copy of the object.
+func patch(scheme *runtime.Scheme, obj *unstructured.Unstructured, change Change) (*unstructured.Unstructured, error) {
+	original, err := json.Marshal(obj.Object)
+	if err != nil {
+		return nil, err
+	}
+
+	var patched []byte
+	switch change.PatchType {
+	case PatchStrategic:
+		if !scheme.Recognizes(obj.GroupVersionKind()) {
+			return nil, fmt.Errorf("strategic merge patches are not supported for %s. Use a merge or json patch", obj.GroupVersionKind())
+		}
+		dataStruct, err := scheme.New(obj.GroupVersionKind())
+		if err != nil {
+			return nil, err
+		}
+		patched, err = strategicpatch.StrategicMergePatch(original, change.Patch, dataStruct)
+		if err != nil {
+			return nil, err
+		}
+	case PatchMerge:
+		if patched, err = jsonpatch.MergePatch(original, change.Patch); err != nil {
+			return nil, err
+		}
+	case PatchJSON:
+		decoded, err := jsonpatch.DecodePatch(change.Patch)
+		if err != nil {
+			return nil, err
+		}
+		if patched, err = decoded.Apply(original); err != nil {
+			return nil, err
+		}
+	}
+
+	result := &unstructured.Unstructured{}
+	if err := result.UnmarshalJSON(patched); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// defaultScheme returns a scheme with the Kubernetes and OpenShift APIs.
+func defaultScheme() (*runtime.Scheme, error) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		return nil, fmt.Errorf("unable to add the Kubernetes APIs to the scheme: %v", err)
+	}
+	if err := oainstall.Install(scheme); err != nil {
+		return nil, fmt.Errorf("unable to add the OpenShift APIs to the scheme: %v", err)
+	}
+	return scheme, nil
+}
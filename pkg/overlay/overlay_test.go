@@ -0,0 +1,170 @@
+package overlay
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func writeOverlay(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func gathered() []*unstructured.Unstructured {
+	storage := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "config.openshift.io/v1",
+		"kind":       "ClusterOperator",
+		"metadata":   map[string]any{"name": "storage"},
+		"status": map[string]any{"conditions": []any{
+			map[string]any{"type": "Degraded", "status": "False"},
+		}},
+	}}
+	pod := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "v1",
+		"kind":       "Pod",
+		"metadata":   map[string]any{"name": "etcd-master-0", "namespace": "openshift-etcd", "labels": map[string]any{"app": "etcd"}},
+		"spec": map[string]any{"containers": []any{
+			map[string]any{"name": "etcd", "image": "etcd:1"},
+			map[string]any{"name": "metrics", "image": "metrics:1"},
+		}},
+	}}
+	return []*unstructured.Unstructured{storage, pod}
+}
+
+func TestApply(t *testing.T) {
+	dir := writeOverlay(t, map[string]string{
+		"01-patches.yaml": `
+apiVersion: must-hydrate.openshift.io/v1alpha1
+kind: Patch
+target:
+  kind: ClusterOperator.config.openshift.io
+  name: storage
+type: json
+patch:
+- op: replace
+  path: /status/conditions/0/status
+  value: "True"
+---
+apiVersion: must-hydrate.openshift.io/v1alpha1
+kind: Patch
+target:
+  kind: Pod
+  namespace: openshift-etcd
+  name: etcd-master-0
+patch:
+  spec:
+    containers:
+    - name: etcd
+      image: etcd:2
+`,
+		"02-objects.yaml": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: added
+  namespace: default
+`,
+	})
+
+	overlay, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(overlay.Files) != 2 || len(overlay.Changes) != 3 {
+		t.Fatalf("expected 3 changes from 2 files, got %d from %d", len(overlay.Changes), len(overlay.Files))
+	}
+
+	objects := gathered()
+	result, err := overlay.Apply(objects)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 3 {
+		t.Fatalf("expected 3 objects, got %d", len(result))
+	}
+
+	conditions, _, _ := unstructured.NestedSlice(result[0].Object, "status", "conditions")
+	if status := conditions[0].(map[string]any)["status"]; status != "True" {
+		t.Errorf("expected the storage operator to be degraded, got %v", status)
+	}
+	containers, _, _ := unstructured.NestedSlice(result[1].Object, "spec", "containers")
+	if len(containers) != 2 || containers[0].(map[string]any)["image"] != "etcd:2" || containers[1].(map[string]any)["image"] != "metrics:1" {
+		t.Errorf("expected the strategic merge patch to update the etcd container only, got %v", containers)
+	}
+	if result[2].GetName() != "added" {
+		t.Errorf("expected the config map to be added, got %s", result[2].GetName())
+	}
+
+	conditions, _, _ = unstructured.NestedSlice(objects[0].Object, "status", "conditions")
+	if status := conditions[0].(map[string]any)["status"]; status != "False" {
+		t.Error("expected the gathered objects to be unchanged")
+	}
+}
+
+func TestApplyUnmatched(t *testing.T) {
+	dir := writeOverlay(t, map[string]string{
+		"changes.yaml": `
+apiVersion: must-hydrate.openshift.io/v1alpha1
+kind: Delete
+target:
+  kind: Pod
+  namespace: openshift-etcd
+  name: etcd-master-0
+---
+apiVersion: must-hydrate.openshift.io/v1alpha1
+kind: Patch
+target:
+  kind: Pod
+  name: etcd-master-0
+type: merge
+patch:
+  metadata:
+    labels:
+      app: deleted
+---
+apiVersion: must-hydrate.openshift.io/v1alpha1
+kind: Delete
+target:
+  kind: Node
+  name: master-0
+`,
+	})
+
+	overlay, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = overlay.Apply(gathered())
+	if err == nil {
+		t.Fatal("expected an error for the changes which match no object")
+	}
+	for _, expected := range []string{"no object matches the patch of Pod/etcd-master-0", "no object matches the deletion of Node/master-0"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected %q in %v", expected, err)
+		}
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	for name, content := range map[string]string{
+		"unknown kind": "apiVersion: must-hydrate.openshift.io/v1alpha1\nkind: Replace\ntarget: {kind: Pod, name: a}\n",
+		"no target":    "apiVersion: must-hydrate.openshift.io/v1alpha1\nkind: Delete\n",
+		"no patch":     "apiVersion: must-hydrate.openshift.io/v1alpha1\nkind: Patch\ntarget: {kind: Pod, name: a}\n",
+		"patch type":   "apiVersion: must-hydrate.openshift.io/v1alpha1\nkind: Patch\ntarget: {kind: Pod, name: a}\ntype: apply\npatch: {}\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Load(writeOverlay(t, map[string]string{"overlay.yaml": content})); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
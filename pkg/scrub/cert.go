@@ -0,0 +1,158 @@
+package scrub
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/netip"
+	"regexp"
+	"strings"
+)
+
+// pemPattern finds PEM blocks. Base64 contains no -, so the body ends at the first END line.
+var pemPattern = regexp.MustCompile(`-----BEGIN ([A-Z0-9 ]+)-----[^-]*-----END [A-Z0-9 ]+-----`)
+
+// scrubPEM replaces the PEM blocks of the text and scrubs the text between them with scrubOther.
+// Certificates are replaced by certificates whose subject, issuer and names are scrubbed.
+// Signatures can not be preserved, so certificates are self-signed by a key generated for the
+// Scrubber and no longer chain to their issuers. Private keys and certificate requests are
+// redacted.
+func (s *Scrubber) scrubPEM(text string, scrubOther func(string) string) string {
+	matches := pemPattern.FindAllStringSubmatchIndex(text, -1)
+	if len(matches) == 0 {
+		return scrubOther(text)
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, match := range matches {
+		b.WriteString(scrubOther(text[last:match[0]]))
+		block, blockType := text[match[0]:match[1]], text[match[2]:match[3]]
+		b.WriteString(s.scrubBlock(block, blockType))
+		last = match[1]
+	}
+	b.WriteString(scrubOther(text[last:]))
+	return b.String()
+}
+
+// scrubBlock returns the replacement of a PEM block.
+func (s *Scrubber) scrubBlock(block string, blockType string) string {
+	switch {
+	case blockType == "CERTIFICATE":
+		if replaced, ok := s.certs[block]; ok {
+			return replaced
+		}
+		replaced, err := s.scrubCertificate(block)
+		if err != nil {
+			replaced = redacted(blockType)
+		}
+		s.certs[block] = replaced
+		return replaced
+	case strings.Contains(blockType, "PRIVATE KEY"), strings.Contains(blockType, "CERTIFICATE REQUEST"):
+		return redacted(blockType)
+	default:
+		return block
+	}
+}
+
+func redacted(blockType string) string {
+	return fmt.Sprintf("-----BEGIN %s-----\nREDACTED\n-----END %s-----", blockType, blockType)
+}
+
+// scrubCertificate returns a certificate with the validity and usage of the certificate in the
+// PEM block, and its subject, issuer and names scrubbed.
+func (s *Scrubber) scrubCertificate(block string) (string, error) {
+	decoded, _ := pem.Decode([]byte(block))
+	if decoded == nil {
+		return "", fmt.Errorf("invalid PEM block")
+	}
+	cert, err := x509.ParseCertificate(decoded.Bytes)
+	if err != nil {
+		return "", err
+	}
+
+	if s.signingKey == nil {
+		if s.signingKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+			return "", err
+		}
+	}
+
+	serial, _ := hex.DecodeString(s.hashFull(CategorySubjects, cert.SerialNumber.String())[:32])
+	template := &x509.Certificate{
+		SerialNumber:          new(big.Int).SetBytes(serial),
+		Subject:               s.scrubName(cert.Subject),
+		NotBefore:             cert.NotBefore,
+		NotAfter:              cert.NotAfter,
+		KeyUsage:              cert.KeyUsage,
+		ExtKeyUsage:           cert.ExtKeyUsage,
+		BasicConstraintsValid: cert.BasicConstraintsValid,
+		IsCA:                  cert.IsCA,
+		MaxPathLen:            cert.MaxPathLen,
+		MaxPathLenZero:        cert.MaxPathLenZero,
+	}
+	for _, name := range cert.DNSNames {
+		template.DNSNames = append(template.DNSNames, s.scrubText(name))
+	}
+	for _, email := range cert.EmailAddresses {
+		template.EmailAddresses = append(template.EmailAddresses, s.scrubText(email))
+	}
+	for _, ip := range cert.IPAddresses {
+		if addr, ok := netip.AddrFromSlice(ip); ok {
+			template.IPAddresses = append(template.IPAddresses, net.IP(s.mapIP(addr.Unmap()).AsSlice()))
+		}
+	}
+	issuer := &x509.Certificate{Subject: s.scrubName(cert.Issuer)}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, &s.signingKey.PublicKey, s.signingKey)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})), "\n"), nil
+}
+
+// scrubName returns the name with its common name, organizations, organizational units,
+// localities and provinces replaced. Values naming Kubernetes identities, such as
+// system:node:<name>, keep their prefix.
+func (s *Scrubber) scrubName(name pkix.Name) pkix.Name {
+	scrubbed := pkix.Name{
+		Country:    name.Country,
+		CommonName: s.subject(name.CommonName),
+	}
+	for _, values := range []struct {
+		from []string
+		to   *[]string
+	}{
+		{name.Organization, &scrubbed.Organization},
+		{name.OrganizationalUnit, &scrubbed.OrganizationalUnit},
+		{name.Locality, &scrubbed.Locality},
+		{name.Province, &scrubbed.Province},
+	} {
+		for _, value := range values.from {
+			*values.to = append(*values.to, s.subject(value))
+		}
+	}
+	return scrubbed
+}
+
+// subject returns the pseudonym of a value of a certificate subject.
+func (s *Scrubber) subject(value string) string {
+	if len(value) == 0 {
+		return value
+	}
+	if strings.HasPrefix(value, "system:") {
+		return s.scrubText(value)
+	}
+	if scrubbed := s.scrubText(value); scrubbed != value {
+		return scrubbed
+	}
+	pseudonym := "subject-" + s.hash(CategorySubjects, value)
+	s.record(CategorySubjects, value, pseudonym)
+	return pseudonym
+}
@@ -0,0 +1,121 @@
+package scrub
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"net/netip"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	ipv4Pattern = regexp.MustCompile(`\d{1,3}(?:\.\d{1,3}){3}(?:/\d{1,2})?`)
+	ipv6Pattern = regexp.MustCompile(`(?i)[0-9a-f]{0,4}(?::[0-9a-f]{0,4}){2,7}(?:/\d{1,3})?`)
+)
+
+// keepIP returns true for the addresses which identify nothing about a cluster, such as
+// loopback and link-local addresses, which are not replaced.
+func keepIP(addr netip.Addr) bool {
+	return addr.IsLoopback() || addr.IsUnspecified() || addr.IsLinkLocalUnicast() || addr.IsMulticast() ||
+		addr == netip.AddrFrom4([4]byte{255, 255, 255, 255})
+}
+
+// mapIP returns the pseudonym of an address. The mapping is prefix preserving: two addresses
+// which share their first n bits are mapped to addresses which share their first n bits, so
+// addresses stay within the pseudonym of their subnets.
+func (s *Scrubber) mapIP(addr netip.Addr) netip.Addr {
+	if keepIP(addr) {
+		return addr
+	}
+	if mapped, ok := s.ips[addr]; ok {
+		return mapped
+	}
+
+	original := addr.AsSlice()
+	bits := len(original) * 8
+	mapped := make([]byte, len(original))
+	prefix := make([]byte, len(original))
+	for i := 0; i < bits; i++ {
+		// each bit is flipped by a function of the bits which precede it
+		mac := hmac.New(sha256.New, s.key)
+		mac.Write([]byte{byte(len(original)), byte(i)})
+		mac.Write(prefix)
+		flip := mac.Sum(nil)[0] & 1
+
+		bit := original[i/8] >> (7 - i%8) & 1
+		mapped[i/8] |= (bit ^ flip) << (7 - i%8)
+		prefix[i/8] |= bit << (7 - i%8)
+	}
+
+	result, _ := netip.AddrFromSlice(mapped)
+	if addr.Is4In6() {
+		result = netip.AddrFrom16(result.As16())
+	}
+	s.ips[addr] = result
+	s.record(CategoryIPs, addr.String(), result.String())
+	return result
+}
+
+// scrubIPs replaces the IPv4 and IPv6 addresses and CIDRs in the text with their pseudonyms.
+// The network address of a CIDR is mapped and then masked, so it remains a valid CIDR which
+// contains the pseudonyms of the addresses of the original.
+func (s *Scrubber) scrubIPs(text string) string {
+	for _, pattern := range []struct {
+		pattern *regexp.Regexp
+		bounded func(string, int, int) bool
+	}{{ipv4Pattern, ipv4Bounded}, {ipv6Pattern, ipv6Bounded}} {
+		text = replaceBounded(text, pattern.pattern, pattern.bounded, func(match string) (string, bool) {
+			address, prefixLength, hasPrefix := strings.Cut(match, "/")
+			addr, err := netip.ParseAddr(address)
+			if err != nil || addr.Zone() != "" {
+				return "", false
+			}
+			mapped := s.mapIP(addr)
+			if !hasPrefix {
+				return mapped.String(), true
+			}
+			bits, err := strconv.Atoi(prefixLength)
+			if err != nil || bits > addr.BitLen() {
+				return "", false
+			}
+			if keepIP(addr) {
+				return match, true
+			}
+			prefix, err := mapped.Prefix(bits)
+			if err != nil {
+				return "", false
+			}
+			return prefix.String(), true
+		})
+	}
+	return text
+}
+
+// ipv4Bounded returns true if the address at text[start:end] is not part of a longer token,
+// so that versions such as 1.2.3.4.5 are not mistaken for addresses. An address may be
+// followed by a port, or end a sentence.
+func ipv4Bounded(text string, start, end int) bool {
+	if start > 0 {
+		if c := text[start-1]; isAlphanumeric(c) || c == '.' {
+			return false
+		}
+	}
+	return end == len(text) || !isAlphanumeric(text[end]) && !(text[end] == '.' && end+1 < len(text) && isAlphanumeric(text[end+1]))
+}
+
+// ipv6Bounded returns true if the address at text[start:end] is not part of a longer token, so
+// that words such as std::string are not mistaken for addresses.
+func ipv6Bounded(text string, start, end int) bool {
+	if start > 0 {
+		if c := text[start-1]; isAlphanumeric(c) || c == ':' || c == '.' {
+			return false
+		}
+	}
+	if end < len(text) {
+		if c := text[end]; isAlphanumeric(c) || c == ':' || c == '.' {
+			return false
+		}
+	}
+	return true
+}
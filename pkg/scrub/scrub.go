@@ -0,0 +1,638 @@
+// Package scrub consistently replaces the identifying values of a must-gather, such as
+// hostnames, IP addresses, domains and usernames, with stable pseudonyms so that it can be
+// shared. Pseudonyms are derived from a key, so the same value is given the same pseudonym
+// in every object, log and file path, and in every must-gather scrubbed with the same key.
+package scrub
+
+import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Category is a kind of identifying value.
+type Category string
+
+const (
+	CategoryClusterIDs Category = "clusterIDs"
+	// CategoryInfrastructureNames are the infrastructure names, which prefix the names of the
+	// cluster's cloud resources.
+	CategoryInfrastructureNames Category = "infrastructureNames"
+	CategoryDomains             Category = "domains"
+	CategoryHosts               Category = "hosts"
+	// CategoryVSphere are the names of vCenters, datacenters, clusters, datastores, networks,
+	// folders and resource pools.
+	CategoryVSphere  Category = "vsphere"
+	CategoryUsers    Category = "users"
+	CategorySubjects Category = "certificateSubjects"
+	CategoryIPs      Category = "ips"
+)
+
+// KeySize is the size in bytes of a generated key.
+const KeySize = 32
+
+// publicDomains are the domains of infrastructure providers and of Kubernetes itself, which
+// are kept along with their subdomains.
+var publicDomains = []string{
+	"cluster.local",
+	"internal",
+	"local",
+	"localhost",
+	"svc",
+	"amazonaws.com",
+	"azure.com",
+	"windows.net",
+	"googleapis.com",
+	"k8s.io",
+	"kubernetes.io",
+	"openshift.io",
+	"openshift.com",
+	"redhat.com",
+	"redhat.io",
+	"quay.io",
+}
+
+// vSphereBuiltinNames are the folders vSphere creates in every datacenter and the root resource
+// pool of every cluster, which appear in inventory paths and are kept.
+var vSphereBuiltinNames = map[string]bool{"host": true, "vm": true, "datastore": true, "network": true, "Resources": true}
+
+// layoutNames are the directories and files of the must-gather layout, which inventory names
+// must not replace.
+var layoutNames = []string{
+	"cluster-scoped-resources", "namespaces", "core", "pods", "logs", "current.log", "previous.log",
+	"host_service_logs", "masters", "workers", "nodes", "static-pods", "etcd_info", "network_logs",
+	"monitoring", "audit_logs", "event-filter.html", "timestamp",
+}
+
+// Mapping records the pseudonym of every value which was replaced. It identifies the gathered
+// cluster and must not be shared with the scrubbed must-gather.
+type Mapping struct {
+	// Key is the hex encoded key the pseudonyms were derived from.
+	Key    string                         `json:"key"`
+	Values map[Category]map[string]string `json:"values"`
+}
+
+// Scrubber replaces identifying values with pseudonyms. Values are discovered from the objects
+// of a must-gather with Discover, and are then replaced in any text with String or Value.
+type Scrubber struct {
+	key     []byte
+	mapping Mapping
+
+	// strict values, such as usernames, are only replaced when they are not part of a longer
+	// name. Loose values, such as hostnames, may be joined to other names by . and -
+	strict map[string]string
+	loose  map[string]string
+
+	strictPattern *regexp.Regexp
+	loosePattern  *regexp.Regexp
+
+	// vSphere inventory names are often common words, such as a folder named openshift, so they
+	// are only replaced as whole inventory paths, or where a value or quoted string is the name
+	inventoryPaths       map[string]string
+	inventoryNames       map[string]string
+	inventoryPathPattern *regexp.Regexp
+	inventoryNamePattern *regexp.Regexp
+	// reserved are the namespaces and API group labels of the must-gather and the names of its
+	// layout, which are never replaced as inventory names
+	reserved map[string]bool
+
+	ips        map[netip.Addr]netip.Addr
+	certs      map[string]string
+	signingKey *ecdsa.PrivateKey
+}
+
+// New returns a Scrubber which derives pseudonyms from the key. A random key is generated if
+// the key is empty.
+func New(key []byte) (*Scrubber, error) {
+	if len(key) == 0 {
+		key = make([]byte, KeySize)
+		if _, err := rand.Read(key); err != nil {
+			return nil, fmt.Errorf("unable to generate a key: %v", err)
+		}
+	}
+	return &Scrubber{
+		key: key,
+		mapping: Mapping{
+			Key:    hex.EncodeToString(key),
+			Values: map[Category]map[string]string{},
+		},
+		strict:         map[string]string{},
+		loose:          map[string]string{},
+		inventoryPaths: map[string]string{},
+		inventoryNames: map[string]string{},
+		reserved:       map[string]bool{},
+		ips:            map[netip.Addr]netip.Addr{},
+		certs:          map[string]string{},
+	}, nil
+}
+
+// Mapping returns the values replaced so far and their pseudonyms.
+func (s *Scrubber) Mapping() Mapping {
+	return s.mapping
+}
+
+// Discover collects the identifying values of the objects, such as the cluster ID, the base
+// domain, node hostnames, vSphere inventory and usernames. It must be called before values are
+// replaced.
+func (s *Scrubber) Discover(objects []*unstructured.Unstructured) {
+	s.reserve(objects)
+	for _, obj := range objects {
+		gvk := obj.GroupVersionKind()
+		switch {
+		case gvk.Group == "config.openshift.io" && gvk.Kind == "ClusterVersion":
+			clusterID, _, _ := unstructured.NestedString(obj.Object, "spec", "clusterID")
+			s.addValue(CategoryClusterIDs, clusterID, false)
+		case gvk.Group == "config.openshift.io" && gvk.Kind == "Infrastructure":
+			s.discoverInfrastructure(obj)
+		case gvk.Group == "config.openshift.io" && gvk.Kind == "DNS":
+			baseDomain, _, _ := unstructured.NestedString(obj.Object, "spec", "baseDomain")
+			s.addDomain(baseDomain)
+		case gvk.Group == "" && gvk.Kind == "Node":
+			s.addHostname(obj.GetName())
+			addresses, _, _ := unstructured.NestedSlice(obj.Object, "status", "addresses")
+			for _, address := range addresses {
+				address, _ := address.(map[string]any)
+				switch address["type"] {
+				case "Hostname", "InternalDNS", "ExternalDNS":
+					value, _ := address["address"].(string)
+					s.addHostname(value)
+				}
+			}
+		case gvk.Group == "route.openshift.io" && gvk.Kind == "Route":
+			host, _, _ := unstructured.NestedString(obj.Object, "spec", "host")
+			s.addDomainOf(host)
+		case gvk.Group == "user.openshift.io" && gvk.Kind == "User":
+			s.addUser(obj.GetName())
+		case gvk.Group == "user.openshift.io" && gvk.Kind == "Identity":
+			providerUserName, _, _ := unstructured.NestedString(obj.Object, "providerUserName")
+			s.addUser(providerUserName)
+			userName, _, _ := unstructured.NestedString(obj.Object, "user", "name")
+			s.addUser(userName)
+		case gvk.Group == "user.openshift.io" && gvk.Kind == "Group":
+			users, _, _ := unstructured.NestedStringSlice(obj.Object, "users")
+			for _, user := range users {
+				s.addUser(user)
+			}
+		case gvk.Group == "rbac.authorization.k8s.io" && (gvk.Kind == "RoleBinding" || gvk.Kind == "ClusterRoleBinding"):
+			subjects, _, _ := unstructured.NestedSlice(obj.Object, "subjects")
+			for _, subject := range subjects {
+				subject, _ := subject.(map[string]any)
+				if subject["kind"] == "User" {
+					name, _ := subject["name"].(string)
+					s.addUser(name)
+				}
+			}
+		}
+	}
+	s.compile()
+}
+
+// reserve records the namespaces and API group labels of the objects, along with the names of the
+// must-gather layout, so that an inventory name such as openshift does not replace them.
+func (s *Scrubber) reserve(objects []*unstructured.Unstructured) {
+	for _, name := range layoutNames {
+		s.reserved[name] = true
+	}
+	for _, obj := range objects {
+		s.reserved[obj.GetNamespace()] = true
+		if obj.GroupVersionKind().GroupKind() == (schema.GroupKind{Kind: "Namespace"}) {
+			s.reserved[obj.GetName()] = true
+		}
+		for _, label := range strings.Split(obj.GroupVersionKind().Group, ".") {
+			s.reserved[label] = true
+		}
+	}
+}
+
+// discoverInfrastructure collects the infrastructure name, the API server hostnames and the
+// vSphere inventory of the Infrastructure object.
+func (s *Scrubber) discoverInfrastructure(obj *unstructured.Unstructured) {
+	infrastructureName, _, _ := unstructured.NestedString(obj.Object, "status", "infrastructureName")
+	s.addValue(CategoryInfrastructureNames, infrastructureName, false)
+
+	for _, field := range []string{"apiServerURL", "apiServerInternalURI"} {
+		value, _, _ := unstructured.NestedString(obj.Object, "status", field)
+		if parsed, err := url.Parse(value); err == nil {
+			s.addDomainOf(parsed.Hostname())
+		}
+	}
+
+	vcenters, _, _ := unstructured.NestedSlice(obj.Object, "spec", "platformSpec", "vsphere", "vcenters")
+	for _, vcenter := range vcenters {
+		vcenter, _ := vcenter.(map[string]any)
+		server, _ := vcenter["server"].(string)
+		s.addVCenter(server)
+		datacenters, _ := vcenter["datacenters"].([]any)
+		for _, datacenter := range datacenters {
+			name, _ := datacenter.(string)
+			s.addInventoryPath(name)
+		}
+	}
+
+	failureDomains, _, _ := unstructured.NestedSlice(obj.Object, "spec", "platformSpec", "vsphere", "failureDomains")
+	for _, failureDomain := range failureDomains {
+		failureDomain, _ := failureDomain.(map[string]any)
+		server, _ := failureDomain["server"].(string)
+		s.addVCenter(server)
+		topology, _ := failureDomain["topology"].(map[string]any)
+		for _, field := range []string{"datacenter", "computeCluster", "datastore", "folder", "resourcePool", "template"} {
+			path, _ := topology[field].(string)
+			s.addInventoryPath(path)
+		}
+		networks, _ := topology["networks"].([]any)
+		for _, network := range networks {
+			name, _ := network.(string)
+			s.addInventoryPath(name)
+		}
+	}
+}
+
+// addVCenter adds the hostname of a vCenter server, whose pseudonym keeps the pseudonym of its
+// domain.
+func (s *Scrubber) addVCenter(server string) {
+	server = strings.TrimSuffix(strings.ToLower(server), ".")
+	if _, err := netip.ParseAddr(server); err == nil || len(server) == 0 {
+		return
+	}
+	if _, ok := s.loose[server]; ok {
+		return
+	}
+	_, domain, _ := strings.Cut(server, ".")
+	s.addDomain(domain)
+
+	pseudonym := "vcenter-" + s.hash(CategoryVSphere, server)
+	if domainPseudonym, ok := s.loose[domain]; ok {
+		pseudonym += "." + domainPseudonym
+	} else if len(domain) > 0 {
+		pseudonym += "." + domain
+	}
+	s.loose[server] = pseudonym
+	s.record(CategoryVSphere, server, pseudonym)
+}
+
+// addInventoryPath adds a vSphere inventory path, such as /dc/host/cluster, and each of its
+// parents. The datacenter, and a name given without a path, such as a network, are also added
+// as names.
+func (s *Scrubber) addInventoryPath(path string) {
+	path = strings.TrimSuffix(path, "/")
+	if !strings.HasPrefix(path, "/") {
+		s.addInventoryName(path)
+		return
+	}
+
+	segments := strings.Split(path, "/")[1:]
+	s.addInventoryName(segments[0])
+	for i := range segments {
+		parent := "/" + strings.Join(segments[:i+1], "/")
+		if _, ok := s.inventoryPaths[parent]; ok {
+			continue
+		}
+		var pseudonyms []string
+		for _, segment := range segments[:i+1] {
+			pseudonyms = append(pseudonyms, s.inventoryPseudonym(segment))
+		}
+		pseudonym := "/" + strings.Join(pseudonyms, "/")
+		s.inventoryPaths[parent] = pseudonym
+		s.record(CategoryVSphere, parent, pseudonym)
+	}
+}
+
+// addInventoryName adds the name of a vSphere object. Built-in names are kept.
+func (s *Scrubber) addInventoryName(name string) {
+	if len(name) < 2 || vSphereBuiltinNames[name] {
+		return
+	}
+	if _, ok := s.inventoryNames[name]; ok {
+		return
+	}
+	pseudonym := s.inventoryPseudonym(name)
+	s.inventoryNames[name] = pseudonym
+	s.record(CategoryVSphere, name, pseudonym)
+}
+
+// inventoryPseudonym returns the pseudonym of a segment of an inventory path, keeping built-in names.
+func (s *Scrubber) inventoryPseudonym(segment string) string {
+	if vSphereBuiltinNames[segment] || len(segment) == 0 {
+		return segment
+	}
+	return "vsphere-" + s.hash(CategoryVSphere, segment)
+}
+
+// addHostname adds the first label of a hostname as a host and the remainder as a domain. IP
+// addresses are left to be mapped wherever they appear.
+func (s *Scrubber) addHostname(hostname string) {
+	hostname = strings.TrimSuffix(strings.ToLower(hostname), ".")
+	if _, err := netip.ParseAddr(hostname); err == nil || hostname == "localhost" {
+		return
+	}
+	host, domain, _ := strings.Cut(hostname, ".")
+	s.addValue(CategoryHosts, host, false)
+	s.addDomain(domain)
+}
+
+// addDomainOf adds the domain of a hostname whose first label, such as api or console, is not
+// identifying.
+func (s *Scrubber) addDomainOf(hostname string) {
+	if _, err := netip.ParseAddr(hostname); err == nil {
+		return
+	}
+	_, domain, _ := strings.Cut(hostname, ".")
+	s.addDomain(domain)
+}
+
+// addDomain adds a domain and its parent domains, other than public suffixes such as com. The
+// pseudonym of a domain ends with the pseudonym of its parent, so subdomains remain subdomains.
+func (s *Scrubber) addDomain(domain string) {
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+	labels := strings.Split(domain, ".")
+	if len(labels) < 2 || isPublicDomain(domain) {
+		return
+	}
+	for i := len(labels) - 2; i >= 0; i-- {
+		suffix := strings.Join(labels[i:], ".")
+		if isPublicDomain(suffix) {
+			continue
+		}
+		if _, ok := s.loose[suffix]; ok {
+			continue
+		}
+		var pseudonym string
+		if i == len(labels)-2 {
+			pseudonym = fmt.Sprintf("domain-%s.example", s.hash(CategoryDomains, suffix))
+		} else {
+			parent := strings.Join(labels[i+1:], ".")
+			parentPseudonym, ok := s.loose[parent]
+			if !ok {
+				parentPseudonym = parent
+			}
+			pseudonym = fmt.Sprintf("name-%s.%s", s.hash(CategoryDomains, labels[i]), parentPseudonym)
+		}
+		s.loose[suffix] = pseudonym
+		s.record(CategoryDomains, suffix, pseudonym)
+	}
+}
+
+// addUser adds a username. System users, such as system:admin, and kube:admin are kept.
+func (s *Scrubber) addUser(user string) {
+	if strings.HasPrefix(user, "system:") || user == "kube:admin" {
+		return
+	}
+	s.addValue(CategoryUsers, user, true)
+}
+
+// addValue adds a value of the category.
+func (s *Scrubber) addValue(category Category, value string, strict bool) {
+	if len(value) < 2 {
+		return
+	}
+	key := strings.ToLower(value)
+	values := s.loose
+	if strict {
+		key = value
+		values = s.strict
+	}
+	if _, ok := values[key]; ok {
+		return
+	}
+
+	var pseudonym string
+	hash := s.hash(category, key)
+	switch category {
+	case CategoryClusterIDs:
+		full := s.hashFull(category, key)
+		pseudonym = fmt.Sprintf("%s-%s-%s-%s-%s", full[0:8], full[8:12], full[12:16], full[16:20], full[20:32])
+	case CategoryInfrastructureNames:
+		pseudonym = "cluster-" + hash[:5]
+	case CategoryHosts:
+		pseudonym = "host-" + hash
+	case CategoryUsers:
+		pseudonym = "user-" + hash
+	default:
+		pseudonym = "value-" + hash
+	}
+	values[key] = pseudonym
+	s.record(category, value, pseudonym)
+}
+
+// record adds a value and its pseudonym to the mapping.
+func (s *Scrubber) record(category Category, value string, pseudonym string) {
+	values, ok := s.mapping.Values[category]
+	if !ok {
+		values = map[string]string{}
+		s.mapping.Values[category] = values
+	}
+	values[value] = pseudonym
+}
+
+// hash returns a short pseudonym of the value.
+func (s *Scrubber) hash(category Category, value string) string {
+	return s.hashFull(category, value)[:8]
+}
+
+func (s *Scrubber) hashFull(category Category, value string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(category))
+	mac.Write([]byte{0})
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// compile builds the patterns which find the discovered values. Longer values are preferred
+// so that a domain is replaced before any of its parents.
+func (s *Scrubber) compile() {
+	s.strictPattern = compileValues(s.strict, false)
+	s.loosePattern = compileValues(s.loose, true)
+
+	// names, and paths of a datacenter alone, which collide with the must-gather are kept
+	for name := range s.inventoryNames {
+		if s.reserved[name] {
+			delete(s.inventoryNames, name)
+			delete(s.inventoryPaths, "/"+name)
+			delete(s.mapping.Values[CategoryVSphere], name)
+			delete(s.mapping.Values[CategoryVSphere], "/"+name)
+		}
+	}
+	s.inventoryPathPattern = compileValues(s.inventoryPaths, false)
+	s.inventoryNamePattern = compileValues(s.inventoryNames, false)
+}
+
+func compileValues(values map[string]string, caseInsensitive bool) *regexp.Regexp {
+	if len(values) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if len(keys[i]) != len(keys[j]) {
+			return len(keys[i]) > len(keys[j])
+		}
+		return keys[i] < keys[j]
+	})
+	for i, key := range keys {
+		keys[i] = regexp.QuoteMeta(key)
+	}
+	pattern := strings.Join(keys, "|")
+	if caseInsensitive {
+		pattern = "(?i)" + pattern
+	}
+	return regexp.MustCompile(pattern)
+}
+
+// String returns the text with the discovered values, IP addresses and certificates replaced.
+func (s *Scrubber) String(text string) string {
+	return s.scrubPEM(text, s.scrubText)
+}
+
+// scrubText replaces the discovered values and IP addresses of text which holds no certificates.
+func (s *Scrubber) scrubText(text string) string {
+	if pseudonym, ok := s.inventoryNames[text]; ok {
+		return pseudonym
+	}
+	if s.inventoryPathPattern != nil {
+		text = replaceBounded(text, s.inventoryPathPattern, pathBounded, func(match string) (string, bool) {
+			pseudonym, ok := s.inventoryPaths[match]
+			return pseudonym, ok
+		})
+	}
+	if s.inventoryNamePattern != nil {
+		text = replaceBounded(text, s.inventoryNamePattern, quotedBounded, func(match string) (string, bool) {
+			pseudonym, ok := s.inventoryNames[match]
+			return pseudonym, ok
+		})
+	}
+	if s.strictPattern != nil {
+		text = replaceBounded(text, s.strictPattern, strictBounded, func(match string) (string, bool) {
+			pseudonym, ok := s.strict[match]
+			return pseudonym, ok
+		})
+	}
+	if s.loosePattern != nil {
+		text = replaceBounded(text, s.loosePattern, looseBounded, func(match string) (string, bool) {
+			pseudonym, ok := s.loose[strings.ToLower(match)]
+			return pseudonym, ok
+		})
+	}
+	return s.scrubIPs(text)
+}
+
+// Value returns a copy of a decoded JSON or YAML value with every string scrubbed. Map keys are
+// kept.
+func (s *Scrubber) Value(value any) any {
+	switch v := value.(type) {
+	case string:
+		return s.String(v)
+	case []any:
+		result := make([]any, len(v))
+		for i, item := range v {
+			result[i] = s.Value(item)
+		}
+		return result
+	case map[string]any:
+		result := make(map[string]any, len(v))
+		for key, item := range v {
+			result[key] = s.Value(item)
+		}
+		return result
+	default:
+		return value
+	}
+}
+
+// replaceBounded replaces the matches of the pattern which are bounded, as decided by bounded,
+// with the result of replace. Matches which are not bounded, or which replace declines, are
+// kept and searching resumes at the next character.
+func replaceBounded(text string, pattern *regexp.Regexp, bounded func(text string, start, end int) bool, replace func(match string) (string, bool)) string {
+	var b strings.Builder
+	last := 0
+	for offset := 0; offset < len(text); {
+		loc := pattern.FindStringIndex(text[offset:])
+		if loc == nil {
+			break
+		}
+		start, end := offset+loc[0], offset+loc[1]
+		if end == start {
+			offset = start + 1
+			continue
+		}
+		if bounded(text, start, end) {
+			if replacement, ok := replace(text[start:end]); ok {
+				b.WriteString(text[last:start])
+				b.WriteString(replacement)
+				last = end
+				offset = end
+				continue
+			}
+		}
+		offset = start + 1
+	}
+	if last == 0 {
+		return text
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// looseBounded returns true if the value at text[start:end] is not part of a longer word. Values
+// may be joined to other names by punctuation such as . and -.
+func looseBounded(text string, start, end int) bool {
+	return (start == 0 || !isAlphanumeric(text[start-1])) && (end == len(text) || !isAlphanumeric(text[end]))
+}
+
+// strictBounded returns true if the value at text[start:end] is not part of a longer name, so
+// that a user named admin does not change the cluster-admin role.
+func strictBounded(text string, start, end int) bool {
+	isNameChar := func(c byte) bool {
+		return isAlphanumeric(c) || c == '-' || c == '_' || c == '.' || c == '@'
+	}
+	return (start == 0 || !isNameChar(text[start-1])) && (end == len(text) || !isNameChar(text[end]))
+}
+
+// pathBounded returns true if the inventory path at text[start:end] is neither part of a longer
+// name nor of a relative path, such as namespaces/openshift. It may be followed by a child.
+func pathBounded(text string, start, end int) bool {
+	isNameChar := func(c byte) bool {
+		return isAlphanumeric(c) || c == '-' || c == '_' || c == '.'
+	}
+	return (start == 0 || !isNameChar(text[start-1])) && (end == len(text) || !isNameChar(text[end]))
+}
+
+// quotedBounded returns true if the value at text[start:end] is quoted on its own, such as the
+// "dc1" of datacenters = "dc1".
+func quotedBounded(text string, start, end int) bool {
+	if start == 0 || end == len(text) {
+		return false
+	}
+	quote := text[start-1]
+	return (quote == '"' || quote == '\'') && text[end] == quote
+}
+
+func isAlphanumeric(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// isPublicDomain returns true if the domain is, or is a subdomain of, a public domain, or is a
+// top level domain.
+func isPublicDomain(domain string) bool {
+	if !strings.Contains(domain, ".") {
+		return true
+	}
+	for _, public := range publicDomains {
+		if domain == public || strings.HasSuffix(domain, "."+public) {
+			return true
+		}
+	}
+	return false
+}
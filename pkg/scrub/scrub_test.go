@@ -0,0 +1,315 @@
+package scrub
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func newTestScrubber(t *testing.T) *Scrubber {
+	s, err := New([]byte("test-key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	objects := []*unstructured.Unstructured{
+		{Object: map[string]any{
+			"apiVersion": "config.openshift.io/v1",
+			"kind":       "ClusterVersion",
+			"metadata":   map[string]any{"name": "version"},
+			"spec":       map[string]any{"clusterID": "6a2b3c4d-1111-2222-3333-444455556666"},
+		}},
+		{Object: map[string]any{
+			"apiVersion": "config.openshift.io/v1",
+			"kind":       "Infrastructure",
+			"metadata":   map[string]any{"name": "cluster"},
+			"spec": map[string]any{"platformSpec": map[string]any{"vsphere": map[string]any{
+				"vcenters": []any{map[string]any{"server": "vcenter.corp.example.org", "datacenters": []any{"dc-east"}}},
+			}}},
+			"status": map[string]any{
+				"infrastructureName": "acme-x7k2p",
+				"apiServerURL":       "https://api.acme.corp.example.org:6443",
+			},
+		}},
+		{Object: map[string]any{
+			"apiVersion": "v1",
+			"kind":       "Node",
+			"metadata":   map[string]any{"name": "worker-0.corp.example.org"},
+		}},
+		{Object: map[string]any{
+			"apiVersion": "user.openshift.io/v1",
+			"kind":       "User",
+			"metadata":   map[string]any{"name": "admin"},
+		}},
+	}
+	s.Discover(objects)
+	return s
+}
+
+func TestMapIPPreservesPrefixes(t *testing.T) {
+	s := newTestScrubber(t)
+	a := s.mapIP(netip.MustParseAddr("10.0.1.5"))
+	b := s.mapIP(netip.MustParseAddr("10.0.1.200"))
+	c := s.mapIP(netip.MustParseAddr("10.0.2.5"))
+
+	if a == netip.MustParseAddr("10.0.1.5") {
+		t.Error("expected the address to be replaced")
+	}
+	prefix24, _ := a.Prefix(24)
+	if !prefix24.Contains(b) {
+		t.Errorf("expected %s and %s to share a /24", a, b)
+	}
+	prefix22, _ := a.Prefix(22)
+	if !prefix22.Contains(c) || prefix24.Contains(c) {
+		t.Errorf("expected %s and %s to share a /22 but not a /24", a, c)
+	}
+	if s.mapIP(netip.MustParseAddr("10.0.1.5")) != a {
+		t.Error("expected the mapping to be stable")
+	}
+	if loopback := netip.MustParseAddr("127.0.0.1"); s.mapIP(loopback) != loopback {
+		t.Error("expected loopback addresses to be kept")
+	}
+}
+
+func TestString(t *testing.T) {
+	s := newTestScrubber(t)
+	cidr := s.String("10.0.0.0/16")
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil || prefix.Masked() != prefix {
+		t.Fatalf("expected a valid CIDR, got %q. %v", cidr, err)
+	}
+	if member := s.mapIP(netip.MustParseAddr("10.0.3.4")); !prefix.Contains(member) {
+		t.Errorf("expected %s to contain %s", prefix, member)
+	}
+
+	text := "node worker-0.corp.example.org at 10.0.3.4:10250 joined acme-x7k2p-worker-0 for admin, a cluster-admin, on version 4.18.1.2.3 using std::string."
+	scrubbed := s.String(text)
+	for _, leaked := range []string{"worker-0", "corp", "10.0.3.4", "acme", ", admin"} {
+		if strings.Contains(scrubbed, leaked) {
+			t.Errorf("expected %q to be scrubbed from %q", leaked, scrubbed)
+		}
+	}
+	for _, kept := range []string{"cluster-admin", "4.18.1.2.3", "std::string", ":10250"} {
+		if !strings.Contains(scrubbed, kept) {
+			t.Errorf("expected %q to be kept in %q", kept, scrubbed)
+		}
+	}
+
+	apiHost := s.String("api.acme.corp.example.org")
+	vcenter := s.String("vcenter.corp.example.org")
+	domain := s.String("corp.example.org")
+	if !strings.HasPrefix(apiHost, "api.") || !strings.HasSuffix(apiHost, "."+domain) || !strings.HasSuffix(vcenter, domain) {
+		t.Errorf("expected subdomains to remain subdomains, got %s, %s and %s", apiHost, vcenter, domain)
+	}
+
+	mapping := s.Mapping()
+	if mapping.Values[CategoryClusterIDs]["6a2b3c4d-1111-2222-3333-444455556666"] == "" || mapping.Values[CategoryUsers]["admin"] == "" {
+		t.Errorf("expected the cluster ID and username to be in the mapping, got %v", mapping.Values)
+	}
+}
+
+func TestCertificate(t *testing.T) {
+	s := newTestScrubber(t)
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "Acme Corp Root", Organization: []string{"Acme"}},
+		DNSNames:     []string{"api.acme.corp.example.org"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := "ca.crt: |\n" + string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})) + "from 10.0.0.1"
+
+	scrubbed := s.String(text)
+	block, rest := pem.Decode([]byte(strings.TrimPrefix(scrubbed, "ca.crt: |\n")))
+	if block == nil {
+		t.Fatalf("expected a certificate in %q", scrubbed)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(cert.Subject.String(), "Acme") || strings.Contains(cert.DNSNames[0], "corp") {
+		t.Errorf("expected the subject and names to be scrubbed, got %s and %v", cert.Subject, cert.DNSNames)
+	}
+	if !cert.NotAfter.Equal(template.NotAfter.Truncate(time.Second)) {
+		t.Errorf("expected the validity to be kept, got %s", cert.NotAfter)
+	}
+	if strings.Contains(string(rest), "10.0.0.1") {
+		t.Errorf("expected the text after the certificate to be scrubbed, got %q", rest)
+	}
+	if s.String(text) != scrubbed {
+		t.Error("expected a certificate to be replaced by the same certificate every time")
+	}
+}
+
+func TestWriteTree(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"cluster-scoped-resources/core/nodes/worker-0.corp.example.org.yaml":      "apiVersion: v1\nkind: Node\nmetadata:\n  name: worker-0.corp.example.org\nstatus:\n  addresses:\n  - type: InternalIP\n    address: 10.0.3.4\n",
+		"namespaces/openshift-etcd/pods/etcd-worker-0/etcd/etcd/logs/current.log": "2024-01-01T12:30:45.000Z dial 10.0.3.4:2379 on worker-0.corp.example.org\n",
+		"binary.bin": "\x00\x01\x02",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s, err := New([]byte("test-key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DiscoverTree(root); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.WriteTree(root, filepath.Join(root, "scrubbed")); err == nil {
+		t.Error("expected an error writing within the must-gather")
+	}
+
+	dir := filepath.Join(t.TempDir(), "scrubbed")
+	report, err := s.WriteTree(root, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Files != 2 || len(report.Skipped) != 1 || report.Skipped[0] != "binary.bin" {
+		t.Errorf("unexpected report %+v", report)
+	}
+
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		for _, leaked := range []string{"worker-0", "corp", "10.0.3.4"} {
+			if strings.Contains(path, leaked) || strings.Contains(string(data), leaked) {
+				t.Errorf("expected %q to be scrubbed from %s:\n%s", leaked, path, data)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWriteObjectsMultiDocument(t *testing.T) {
+	s := newTestScrubber(t)
+	input := `apiVersion: v1
+kind: Node
+metadata:
+  name: worker-0.corp.example.org
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: sizes
+data:
+  host: worker-0.corp.example.org
+spec:
+  limit: 9007199254740993
+`
+	var out strings.Builder
+	if err := s.writeObjects(strings.NewReader(input), &out, false); err != nil {
+		t.Fatal(err)
+	}
+
+	documents := strings.Split(out.String(), "---\n")
+	if len(documents) != 2 {
+		t.Fatalf("expected both documents to be written, got:\n%s", out.String())
+	}
+	if !strings.Contains(documents[0], "kind: Node") || !strings.Contains(documents[1], "kind: ConfigMap") {
+		t.Errorf("expected the documents in order, got:\n%s", out.String())
+	}
+	if strings.Contains(out.String(), "worker-0") {
+		t.Errorf("expected every document to be scrubbed, got:\n%s", out.String())
+	}
+	if !strings.Contains(documents[1], "limit: 9007199254740993") {
+		t.Errorf("expected integers to keep their precision, got:\n%s", documents[1])
+	}
+}
+
+func TestInventoryDefaultTopology(t *testing.T) {
+	s, err := New([]byte("test-key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Discover([]*unstructured.Unstructured{
+		{Object: map[string]any{
+			"apiVersion": "config.openshift.io/v1",
+			"kind":       "Infrastructure",
+			"metadata":   map[string]any{"name": "cluster"},
+			"spec": map[string]any{"platformSpec": map[string]any{"vsphere": map[string]any{
+				"vcenters": []any{map[string]any{"server": "vcenter.corp.example.org", "datacenters": []any{"DC1"}}},
+				"failureDomains": []any{map[string]any{
+					"server": "vcenter.corp.example.org",
+					"topology": map[string]any{
+						"datacenter":     "DC1",
+						"computeCluster": "/DC1/host/Cluster1",
+						"datastore":      "/DC1/datastore/datastore1",
+						"folder":         "/DC1/vm/openshift",
+						"resourcePool":   "/DC1/host/Cluster1/Resources",
+						"networks":       []any{"VM Network"},
+					},
+				}},
+			}}},
+		}},
+		{Object: map[string]any{
+			"apiVersion": "v1",
+			"kind":       "Pod",
+			"metadata":   map[string]any{"name": "etcd-master-0", "namespace": "openshift-etcd"},
+		}},
+	})
+
+	for _, kept := range []string{
+		"cluster-scoped-resources/config.openshift.io/infrastructures.yaml",
+		"namespaces/openshift-etcd/pods/etcd-master-0/etcd-master-0.yaml",
+		"namespace: openshift-etcd",
+		"Resources",
+		"host",
+	} {
+		if scrubbed := s.String(kept); scrubbed != kept {
+			t.Errorf("expected %q to be kept, got %q", kept, scrubbed)
+		}
+	}
+
+	folder := s.String("/DC1/vm/openshift")
+	if strings.Contains(folder, "DC1") || strings.Contains(folder, "openshift") || !strings.Contains(folder, "/vm/") {
+		t.Errorf("expected the folder to be scrubbed keeping built-in folders, got %q", folder)
+	}
+	pool := s.String("resource pool /DC1/host/Cluster1/Resources not found")
+	if strings.Contains(pool, "DC1") || strings.Contains(pool, "Cluster1") || !strings.HasSuffix(pool, "/Resources not found") {
+		t.Errorf("expected the resource pool to be scrubbed keeping Resources, got %q", pool)
+	}
+	if vm := s.String("/DC1/vm/openshift/acme-master-0"); !strings.HasPrefix(vm, folder+"/") {
+		t.Errorf("expected children of an inventory path to keep its pseudonym, got %q", vm)
+	}
+	if s.String("DC1") == "DC1" || s.String("VM Network") == "VM Network" {
+		t.Error("expected values which are inventory names to be scrubbed")
+	}
+	if config := s.String(`datacenters = "DC1"`); strings.Contains(config, "DC1") {
+		t.Errorf("expected quoted inventory names to be scrubbed, got %q", config)
+	}
+}
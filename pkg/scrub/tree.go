@@ -0,0 +1,272 @@
+package scrub
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	k8syaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+)
+
+// Report summarises a scrubbed must-gather.
+type Report struct {
+	// Files is the number of files written.
+	Files int
+	// Skipped are the files which were not written because they could not be scrubbed, such as
+	// binary files and symbolic links, relative to the must-gather.
+	Skipped []string
+}
+
+// DiscoverTree collects the identifying values of the objects of every YAML and JSON file in the
+// must-gather at root, including kinds which are not hydrated such as Users and Routes.
+func (s *Scrubber) DiscoverTree(root string) error {
+	var objects []*unstructured.Unstructured
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() || !isObjectFile(path) {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		decoder := k8syaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), 4096)
+		for {
+			obj := &unstructured.Unstructured{}
+			if err := decoder.Decode(&obj.Object); err != nil {
+				// files which are not objects hold nothing to discover
+				return nil
+			}
+			if !obj.IsList() {
+				objects = append(objects, obj)
+				continue
+			}
+			items, _, _ := unstructured.NestedSlice(obj.Object, "items")
+			for _, item := range items {
+				if item, ok := item.(map[string]any); ok {
+					objects = append(objects, &unstructured.Unstructured{Object: item})
+				}
+			}
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("unable to discover the values of %s: %v", root, err)
+	}
+	s.Discover(objects)
+	return nil
+}
+
+// WriteTree writes a scrubbed copy of the must-gather at root to dir, in the same layout. File
+// paths are scrubbed, objects are decoded and their values scrubbed, and logs and other text
+// files, including gzipped ones, are scrubbed line by line. The must-gather is not modified.
+func (s *Scrubber) WriteTree(root string, dir string) (*Report, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	if dir, err = filepath.Abs(dir); err != nil {
+		return nil, err
+	}
+	if dir == root || strings.HasPrefix(dir, root+string(filepath.Separator)) {
+		return nil, fmt.Errorf("%s must not be within the must-gather %s", dir, root)
+	}
+
+	report := &Report{}
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dir, s.scrubText(relPath))
+
+		switch {
+		case info.IsDir():
+			return os.MkdirAll(target, 0755)
+		case !info.Mode().IsRegular():
+			report.Skipped = append(report.Skipped, relPath)
+			return nil
+		}
+
+		written, err := s.writeFile(path, target)
+		if err != nil {
+			return fmt.Errorf("unable to scrub %s: %v", relPath, err)
+		}
+		if !written {
+			report.Skipped = append(report.Skipped, relPath)
+			return nil
+		}
+		report.Files++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// writeFile writes the scrubbed file to target. It returns false if the file could not be
+// scrubbed, such as a binary file, and was not written.
+func (s *Scrubber) writeFile(path string, target string) (bool, error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer in.Close()
+
+	var reader io.Reader = in
+	gzipped := strings.HasSuffix(path, ".gz")
+	if gzipped {
+		gz, err := gzip.NewReader(in)
+		if err != nil {
+			return false, nil
+		}
+		defer gz.Close()
+		reader = gz
+	}
+
+	buffered := bufio.NewReaderSize(reader, 64*1024)
+	head, _ := buffered.Peek(8000)
+	if bytes.IndexByte(head, 0) >= 0 || !utf8.Valid(trimPartialRune(head)) {
+		return false, nil
+	}
+
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return false, err
+	}
+	var writer io.Writer = out
+	var gzWriter *gzip.Writer
+	if gzipped {
+		gzWriter = gzip.NewWriter(out)
+		writer = gzWriter
+	}
+
+	name := strings.TrimSuffix(path, ".gz")
+	if isObjectFile(name) {
+		err = s.writeObjects(buffered, writer, strings.HasSuffix(name, ".json"))
+	} else {
+		err = s.writeLines(buffered, writer)
+	}
+	if gzWriter != nil {
+		err = errors.Join(err, gzWriter.Close())
+	}
+	return true, errors.Join(err, out.Close())
+}
+
+// writeObjects scrubs the values of each YAML or JSON document of a file. YAML documents are
+// written separated by ---. Files which can not be decoded are scrubbed as text.
+func (s *Scrubber) writeObjects(r io.Reader, w io.Writer, asJSON bool) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	documents, err := decodeDocuments(data)
+	if err != nil || len(documents) == 0 {
+		_, err := io.WriteString(w, s.String(string(data)))
+		return err
+	}
+
+	for i, document := range documents {
+		var scrubbed []byte
+		if asJSON {
+			scrubbed, err = json.MarshalIndent(s.Value(document), "", "  ")
+			scrubbed = append(scrubbed, '\n')
+		} else {
+			scrubbed, err = yaml.Marshal(s.Value(document))
+			if i > 0 {
+				scrubbed = append([]byte("---\n"), scrubbed...)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(scrubbed); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeDocuments decodes every non-empty YAML or JSON document of a file. Numbers are decoded as
+// json.Number so that integers are written back without losing precision.
+func decodeDocuments(data []byte) ([]any, error) {
+	var documents []any
+	decoder := k8syaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), 4096)
+	for {
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); errors.Is(err, io.EOF) {
+			return documents, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		numbers := json.NewDecoder(bytes.NewReader(raw))
+		numbers.UseNumber()
+		var document any
+		if err := numbers.Decode(&document); err != nil {
+			return nil, err
+		}
+		if document != nil {
+			documents = append(documents, document)
+		}
+	}
+}
+
+// writeLines scrubs text line by line. Lines are gathered until the end of a PEM block so that
+// certificates are replaced whole.
+func (s *Scrubber) writeLines(r *bufio.Reader, w io.Writer) error {
+	var pending strings.Builder
+	inBlock := false
+	for {
+		line, err := r.ReadString('\n')
+		pending.WriteString(line)
+		if strings.Contains(line, "-----BEGIN ") && !strings.Contains(line, "-----END ") {
+			inBlock = true
+		} else if strings.Contains(line, "-----END ") {
+			inBlock = false
+		}
+
+		if !inBlock || err != nil {
+			if _, writeErr := io.WriteString(w, s.String(pending.String())); writeErr != nil {
+				return writeErr
+			}
+			pending.Reset()
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func isObjectFile(path string) bool {
+	return strings.HasSuffix(path, ".yaml") || strings.HasSuffix(path, ".yml") || strings.HasSuffix(path, ".json")
+}
+
+// trimPartialRune drops a rune cut off at the end of a peeked buffer.
+func trimPartialRune(data []byte) []byte {
+	for i := 0; i < utf8.UTFMax && len(data) > 0; i++ {
+		if utf8.Valid(data) {
+			return data
+		}
+		data = data[:len(data)-1]
+	}
+	return data
+}
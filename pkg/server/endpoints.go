@@ -0,0 +1,282 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	currentConfigAnnotation = "machineconfiguration.openshift.io/currentConfig"
+	kubeletConfigPath       = "/etc/kubernetes/kubelet.conf"
+)
+
+var (
+	machineConfigResource = schema.GroupVersionResource{
+		Group:    "machineconfiguration.openshift.io",
+		Version:  "v1",
+		Resource: "machineconfigs",
+	}
+	machineConfigPoolResource = schema.GroupVersionResource{
+		Group:    "machineconfiguration.openshift.io",
+		Version:  "v1",
+		Resource: "machineconfigpools",
+	}
+	kubeletConfigResource = schema.GroupVersionResource{
+		Group:    "machineconfiguration.openshift.io",
+		Version:  "v1",
+		Resource: "kubeletconfigs",
+	}
+)
+
+// nodeNameFromContext returns the name of the node a request was routed to, if any.
+func nodeNameFromContext(ctx context.Context) string {
+	nodeName, _ := ctx.Value(nodeNameKey{}).(string)
+	return nodeName
+}
+
+// requestNode returns the hydrated node a request was routed to. An error is written to the
+// response if the node can not be determined.
+func (l *KubeletInterfaceServer) requestNode(writer http.ResponseWriter, req *http.Request) (*corev1.Node, bool) {
+	nodeName := nodeNameFromContext(req.Context())
+	if len(nodeName) == 0 {
+		http.Error(writer, "the node is unknown. make the request through the node proxy of the API server", http.StatusNotFound)
+		return nil, false
+	}
+
+	node, err := l.Hydrator.ClientSet().CoreV1().Nodes().Get(req.Context(), nodeName, metav1.GetOptions{})
+	if err != nil {
+		http.Error(writer, fmt.Sprintf("unable to get node %s. %v", nodeName, err), http.StatusInternalServerError)
+		return nil, false
+	}
+	return node, true
+}
+
+func writeJSON(writer http.ResponseWriter, obj any) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(writer).Encode(obj)
+}
+
+func (l *KubeletInterfaceServer) handleHealthz(writer http.ResponseWriter, req *http.Request) {
+	writer.Header().Set("Content-Type", "text/plain")
+	writer.WriteHeader(http.StatusOK)
+	_, _ = io.WriteString(writer, "ok")
+}
+
+// handlePods returns the hydrated pods bound to the node.
+func (l *KubeletInterfaceServer) handlePods(writer http.ResponseWriter, req *http.Request) {
+	node, ok := l.requestNode(writer, req)
+	if !ok {
+		return
+	}
+
+	pods, err := l.Hydrator.ClientSet().CoreV1().Pods("").List(req.Context(), metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", node.Name).String(),
+	})
+	if err != nil {
+		http.Error(writer, fmt.Sprintf("unable to list pods for node %s. %v", node.Name, err), http.StatusInternalServerError)
+		return
+	}
+	pods.APIVersion = "v1"
+	pods.Kind = "PodList"
+	pods.ResourceVersion = ""
+
+	writeJSON(writer, pods)
+}
+
+// handleSpec returns the cAdvisor machine info of the node, derived from the node status.
+func (l *KubeletInterfaceServer) handleSpec(writer http.ResponseWriter, req *http.Request) {
+	node, ok := l.requestNode(writer, req)
+	if !ok {
+		return
+	}
+
+	capacity := node.Status.Capacity
+	writeJSON(writer, map[string]any{
+		"timestamp":         time.Now().UTC().Format(time.RFC3339Nano),
+		"num_cores":         capacity.Cpu().Value(),
+		"memory_capacity":   capacity.Memory().Value(),
+		"machine_id":        node.Status.NodeInfo.MachineID,
+		"system_uuid":       node.Status.NodeInfo.SystemUUID,
+		"boot_id":           node.Status.NodeInfo.BootID,
+		"kernel_version":    node.Status.NodeInfo.KernelVersion,
+		"os_image":          node.Status.NodeInfo.OSImage,
+		"container_os":      node.Status.NodeInfo.OperatingSystem,
+		"architecture":      node.Status.NodeInfo.Architecture,
+		"instance_id":       node.Spec.ProviderID,
+		"container_runtime": node.Status.NodeInfo.ContainerRuntimeVersion,
+	})
+}
+
+// handleConfigz returns the kubelet configuration of the node. The configuration is read from the
+// rendered MachineConfig of the node, falling back to the KubeletConfigs which target the pools
+// of the node.
+func (l *KubeletInterfaceServer) handleConfigz(writer http.ResponseWriter, req *http.Request) {
+	node, ok := l.requestNode(writer, req)
+	if !ok {
+		return
+	}
+
+	kubeletConfig, err := l.renderedKubeletConfig(req.Context(), node)
+	if err != nil {
+		kubeletConfig, err = l.kubeletConfigFromCRs(req.Context(), node)
+	}
+	if err != nil {
+		http.Error(writer, fmt.Sprintf("unable to determine the kubelet configuration of node %s. %v", node.Name, err), http.StatusNotFound)
+		return
+	}
+
+	writeJSON(writer, map[string]any{
+		"kubeletconfig": kubeletConfig,
+	})
+}
+
+// renderedKubeletConfig returns the kubelet configuration file of the rendered MachineConfig of the node.
+func (l *KubeletInterfaceServer) renderedKubeletConfig(ctx context.Context, node *corev1.Node) (map[string]any, error) {
+	renderedConfig, exists := node.Annotations[currentConfigAnnotation]
+	if !exists {
+		return nil, fmt.Errorf("node does not have the %s annotation", currentConfigAnnotation)
+	}
+
+	machineConfig, err := l.Hydrator.DynamicClient().Resource(machineConfigResource).Get(ctx, renderedConfig, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get machine config %s. %v", renderedConfig, err)
+	}
+
+	files, _, _ := unstructured.NestedSlice(machineConfig.Object, "spec", "config", "storage", "files")
+	for _, f := range files {
+		file, ok := f.(map[string]any)
+		if !ok || file["path"] != kubeletConfigPath {
+			continue
+		}
+
+		source, _, _ := unstructured.NestedString(file, "contents", "source")
+		compression, _, _ := unstructured.NestedString(file, "contents", "compression")
+		data, err := decodeDataURL(source, compression)
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode %s from machine config %s. %v", kubeletConfigPath, renderedConfig, err)
+		}
+
+		var kubeletConfig map[string]any
+		if err := yaml.Unmarshal(data, &kubeletConfig); err != nil {
+			return nil, fmt.Errorf("unable to parse %s from machine config %s. %v", kubeletConfigPath, renderedConfig, err)
+		}
+		return kubeletConfig, nil
+	}
+
+	return nil, fmt.Errorf("machine config %s does not contain %s", renderedConfig, kubeletConfigPath)
+}
+
+// kubeletConfigFromCRs merges, in name order, the kubelet configuration of the KubeletConfigs which
+// select a MachineConfigPool containing the node.
+func (l *KubeletInterfaceServer) kubeletConfigFromCRs(ctx context.Context, node *corev1.Node) (map[string]any, error) {
+	pools, err := l.Hydrator.DynamicClient().Resource(machineConfigPoolResource).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list machine config pools. %v", err)
+	}
+
+	var nodePools []unstructured.Unstructured
+	for _, pool := range pools.Items {
+		if selectorMatches(pool.Object, labels.Set(node.Labels), "spec", "nodeSelector") {
+			nodePools = append(nodePools, pool)
+		}
+	}
+
+	kubeletConfigs, err := l.Hydrator.DynamicClient().Resource(kubeletConfigResource).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list kubelet configs. %v", err)
+	}
+	sort.Slice(kubeletConfigs.Items, func(i, j int) bool {
+		return kubeletConfigs.Items[i].GetName() < kubeletConfigs.Items[j].GetName()
+	})
+
+	var merged map[string]any
+	for _, kubeletConfig := range kubeletConfigs.Items {
+		for _, pool := range nodePools {
+			if !selectorMatches(kubeletConfig.Object, labels.Set(pool.GetLabels()), "spec", "machineConfigPoolSelector") {
+				continue
+			}
+			config, _, _ := unstructured.NestedMap(kubeletConfig.Object, "spec", "kubeletConfig")
+			if merged == nil {
+				merged = map[string]any{}
+			}
+			for k, v := range config {
+				merged[k] = v
+			}
+			break
+		}
+	}
+
+	if merged == nil {
+		return nil, fmt.Errorf("no kubelet config targets the pools of node %s", node.Name)
+	}
+	return merged, nil
+}
+
+// selectorMatches returns true if the label selector at the given fields of obj matches the labels.
+func selectorMatches(obj map[string]any, set labels.Set, fields ...string) bool {
+	rawSelector, found, _ := unstructured.NestedMap(obj, fields...)
+	if !found {
+		return false
+	}
+
+	labelSelector := &metav1.LabelSelector{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(rawSelector, labelSelector); err != nil {
+		return false
+	}
+	selector, err := metav1.LabelSelectorAsSelector(labelSelector)
+	if err != nil {
+		return false
+	}
+	return selector.Matches(set)
+}
+
+// decodeDataURL returns the data of an Ignition file source.
+func decodeDataURL(source string, compression string) ([]byte, error) {
+	header, encoded, found := strings.Cut(strings.TrimPrefix(source, "data:"), ",")
+	if !found || !strings.HasPrefix(source, "data:") {
+		return nil, fmt.Errorf("unsupported file source")
+	}
+
+	var data []byte
+	var err error
+	if strings.HasSuffix(header, ";base64") {
+		data, err = base64.StdEncoding.DecodeString(encoded)
+	} else {
+		var unescaped string
+		unescaped, err = url.PathUnescape(encoded)
+		data = []byte(unescaped)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if compression == "gzip" {
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		return io.ReadAll(reader)
+	}
+	return data, nil
+}
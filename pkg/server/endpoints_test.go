@@ -0,0 +1,60 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+func TestDecodeDataURL(t *testing.T) {
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	_, _ = writer.Write([]byte("kind: KubeletConfiguration"))
+	_ = writer.Close()
+
+	tests := []struct {
+		source      string
+		compression string
+	}{
+		{source: "data:,kind%3A%20KubeletConfiguration"},
+		{source: "data:text/plain;charset=utf-8;base64," + base64.StdEncoding.EncodeToString([]byte("kind: KubeletConfiguration"))},
+		{source: "data:;base64," + base64.StdEncoding.EncodeToString(compressed.Bytes()), compression: "gzip"},
+	}
+
+	for _, test := range tests {
+		data, err := decodeDataURL(test.source, test.compression)
+		if err != nil {
+			t.Errorf("unable to decode %s. %v", test.source, err)
+			continue
+		}
+		if string(data) != "kind: KubeletConfiguration" {
+			t.Errorf("unexpected data %q decoded from %s", data, test.source)
+		}
+	}
+
+	if _, err := decodeDataURL("https://example.com/kubelet.conf", ""); err == nil {
+		t.Error("expected an error for a source which is not a data URL")
+	}
+}
+
+func TestSelectorMatches(t *testing.T) {
+	pool := map[string]any{
+		"spec": map[string]any{
+			"nodeSelector": map[string]any{
+				"matchLabels": map[string]any{
+					"node-role.kubernetes.io/worker": "",
+				},
+			},
+		},
+	}
+
+	if !selectorMatches(pool, labels.Set{"node-role.kubernetes.io/worker": ""}, "spec", "nodeSelector") {
+		t.Error("expected the worker selector to match a worker node")
+	}
+	if selectorMatches(pool, labels.Set{"node-role.kubernetes.io/master": ""}, "spec", "nodeSelector") {
+		t.Error("expected the worker selector not to match a master node")
+	}
+}
@@ -1,25 +1,66 @@
 package server
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"os"
 	"path"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/openshift-splat-team/must-hydrate/pkg/controller"
 	"github.com/openshift-splat-team/must-hydrate/pkg/controller/util"
+	"github.com/openshift-splat-team/must-hydrate/pkg/logs"
 )
 
+type nodeNameKey struct{}
+
 type KubeletInterfaceServer struct {
-	RootPath    string
+	// StateDir is the directory the serving certificates are written to. A temporary directory,
+	// removed on Shutdown, is used if unset.
+	StateDir string
+	// Address is the address the kubelet stand-in listens on for requests made directly, rather
+	// than through the API server. It is bound by Initialize. Defaults to 127.0.0.1:10250, as the
+	// stand-in serves the must-gather without authentication.
+	Address     string
 	Hydrator    *controller.HydratorReconciler
 	certManager *util.CertificateSigner
+
+	// FollowSpeed is the multiplier applied to the original pace of a log when it is replayed
+	// for a follow request. Defaults to 1.
+	FollowSpeed float64
+
+	kubeletListener net.Listener
+	proxyListener   net.Listener
+	nodeListener    *connListener
+	kubeletServer   *http.Server
+	proxyServer     *http.Server
+	errs            chan error
+	cancel          context.CancelFunc
+	shutdown        sync.Once
+	tempStateDir    bool
 }
 
+// Initialize generates the serving certificates and binds the listeners of the kubelet stand-in
+// and the kubelet proxy, so that an address which is in use is reported before anything is served.
 func (l *KubeletInterfaceServer) Initialize() error {
+	if len(l.StateDir) == 0 {
+		stateDir, err := os.MkdirTemp("", "must-hydrate-kubelet-")
+		if err != nil {
+			return fmt.Errorf("unable to create state directory. %v", err)
+		}
+		l.StateDir = stateDir
+		l.tempStateDir = true
+	}
+
 	l.certManager = &util.CertificateSigner{
-		RootPath: l.RootPath,
+		RootPath: l.StateDir,
 	}
 
 	if err := l.certManager.Initialize(); err != nil {
@@ -29,9 +70,34 @@ func (l *KubeletInterfaceServer) Initialize() error {
 	if err := l.certManager.GenerateCertificate(); err != nil {
 		return fmt.Errorf("unable to generate the certificate. %v", err)
 	}
+
+	address := l.Address
+	if len(address) == 0 {
+		address = "127.0.0.1:10250"
+	}
+	kubeletListener, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("unable to listen on %s. %v", address, err)
+	}
+
+	proxyListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		_ = kubeletListener.Close()
+		return fmt.Errorf("unable to listen for kubelet proxy connections. %v", err)
+	}
+	l.kubeletListener = kubeletListener
+	l.proxyListener = proxyListener
+	l.nodeListener = newConnListener(proxyListener.Addr())
+
 	return nil
 }
 
+// ProxyURL returns the URL of the HTTP CONNECT proxy which the API server uses to reach
+// the kubelet stand-in.
+func (l *KubeletInterfaceServer) ProxyURL() string {
+	return fmt.Sprintf("http://%s", l.proxyListener.Addr().String())
+}
+
 func (l *KubeletInterfaceServer) handle(writer http.ResponseWriter, req *http.Request) {
 	logPath, err := l.Hydrator.GetLogPathFromUrl(req.URL)
 	if err != nil {
@@ -46,6 +112,11 @@ func (l *KubeletInterfaceServer) handle(writer http.ResponseWriter, req *http.Re
 	}
 	defer file.Close()
 
+	if req.URL.Query().Get("follow") == "true" {
+		l.follow(writer, req, file)
+		return
+	}
+
 	writer.Header().Set("Content-Type", "text/plain")
 	writer.Header().Set("Content-Disposition", "attachment; filename=example.txt")
 	writer.WriteHeader(http.StatusOK)
@@ -57,12 +128,198 @@ func (l *KubeletInterfaceServer) handle(writer http.ResponseWriter, req *http.Re
 
 }
 
-func (l *KubeletInterfaceServer) Serve() {
-	go func() {
-		http.HandleFunc("/containerLogs/", l.handle)
-		err := http.ListenAndServeTLS(":10250", path.Join(l.RootPath, "cert.pem"), path.Join(l.RootPath, "key.pem"), nil)
-		if err != nil {
-			panic(err)
+// follow replays a log paced by the timestamps of its lines and then holds the connection open,
+// as a kubelet does for a container which is still running, until the client disconnects.
+func (l *KubeletInterfaceServer) follow(writer http.ResponseWriter, req *http.Request, file io.Reader) {
+	speed := l.FollowSpeed
+	if speed <= 0 {
+		speed = 1
+	}
+
+	responseController := http.NewResponseController(writer)
+	writer.Header().Set("Content-Type", "text/plain")
+	writer.WriteHeader(http.StatusOK)
+
+	err := logs.Replay(req.Context(), file, writer, responseController.Flush, speed)
+	if err != nil {
+		return
+	}
+	<-req.Context().Done()
+}
+
+// handleSearch searches the container logs of the must-gather and returns the matches as JSON.
+func (l *KubeletInterfaceServer) handleSearch(writer http.ResponseWriter, req *http.Request) {
+	values := req.URL.Query()
+	query := logs.Query{
+		Pattern:   values.Get("q"),
+		Namespace: values.Get("namespace"),
+		Pod:       values.Get("pod"),
+		Container: values.Get("container"),
+	}
+	if len(query.Pattern) == 0 {
+		http.Error(writer, "a search pattern must be provided with the q parameter", http.StatusBadRequest)
+		return
+	}
+	for param, target := range map[string]*int{"offset": &query.Offset, "limit": &query.Limit} {
+		if value := values.Get(param); len(value) > 0 {
+			parsed, err := strconv.Atoi(value)
+			if err != nil {
+				http.Error(writer, fmt.Sprintf("invalid %s. %v", param, err), http.StatusBadRequest)
+				return
+			}
+			*target = parsed
+		}
+	}
+
+	result, err := l.Hydrator.LogIndex().Search(req.Context(), query)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(writer).Encode(result)
+}
+
+// handleConnect accepts HTTP CONNECT requests from the API server. The target address is
+// resolved to a node and the tunneled connection is handed to the kubelet server for that node.
+func (l *KubeletInterfaceServer) handleConnect(writer http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodConnect {
+		http.Error(writer, "only CONNECT is supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	nodeName, err := l.Hydrator.GetNodeNameFromAddress(req.Host)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	hijacker, ok := writer.(http.Hijacker)
+	if !ok {
+		http.Error(writer, "connection can not be hijacked", http.StatusInternalServerError)
+		return
+	}
+
+	conn, bufrw, err := hijacker.Hijack()
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n")); err != nil {
+		conn.Close()
+		return
+	}
+
+	l.nodeListener.push(&nodeConn{
+		Conn:     conn,
+		reader:   bufrw.Reader,
+		nodeName: nodeName,
+	})
+}
+
+// Serve starts serving the kubelet stand-in and the kubelet proxy on the listeners bound by
+// Initialize. Requests are canceled, and the servers shut down, when ctx is done. The returned
+// channel receives the error of a server which stops unexpectedly, after which the others are
+// shut down too.
+func (l *KubeletInterfaceServer) Serve(ctx context.Context) <-chan error {
+	ctx, l.cancel = context.WithCancel(ctx)
+	l.errs = make(chan error, 3)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/containerLogs/", l.handle)
+	mux.HandleFunc("/search", l.handleSearch)
+	mux.HandleFunc("/healthz", l.handleHealthz)
+	mux.HandleFunc("/pods", l.handlePods)
+	mux.HandleFunc("/spec", l.handleSpec)
+	mux.HandleFunc("/configz", l.handleConfigz)
+	mux.HandleFunc("/status", l.handleStatus)
+
+	l.kubeletServer = &http.Server{
+		Handler: mux,
+		BaseContext: func(net.Listener) context.Context {
+			return ctx
+		},
+		ConnContext: func(ctx context.Context, conn net.Conn) context.Context {
+			if tlsConn, ok := conn.(interface{ NetConn() net.Conn }); ok {
+				conn = tlsConn.NetConn()
+			}
+			if nc, ok := conn.(*nodeConn); ok {
+				return context.WithValue(ctx, nodeNameKey{}, nc.nodeName)
+			}
+			return ctx
+		},
+	}
+	l.proxyServer = &http.Server{
+		Handler: http.HandlerFunc(l.handleConnect),
+		BaseContext: func(net.Listener) context.Context {
+			return ctx
+		},
+	}
+	certFile := path.Join(l.StateDir, "cert.pem")
+	keyFile := path.Join(l.StateDir, "key.pem")
+
+	serve := func(name string, run func() error) {
+		if err := run(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			l.errs <- fmt.Errorf("unable to serve the %s. %v", name, err)
+			l.cancel()
 		}
+	}
+	go serve("kubelet stand-in", func() error { return l.kubeletServer.ServeTLS(l.kubeletListener, certFile, keyFile) })
+	go serve("kubelet stand-in for the API server", func() error { return l.kubeletServer.ServeTLS(l.nodeListener, certFile, keyFile) })
+	go serve("kubelet proxy", func() error { return l.proxyServer.Serve(l.proxyListener) })
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = l.Shutdown(shutdownCtx)
 	}()
+
+	return l.errs
+}
+
+// Shutdown stops accepting kubelet connections, cancels in-flight requests, such as logs being
+// followed, and removes the generated certificates. It is safe to call Shutdown more than once.
+func (l *KubeletInterfaceServer) Shutdown(ctx context.Context) error {
+	var errs []error
+
+	l.shutdown.Do(func() {
+		if l.cancel != nil {
+			l.cancel()
+		}
+
+		for _, server := range []*http.Server{l.proxyServer, l.kubeletServer} {
+			if server == nil {
+				continue
+			}
+			if err := server.Shutdown(ctx); err != nil {
+				_ = server.Close()
+			}
+		}
+		for _, listener := range []net.Listener{l.kubeletListener, l.proxyListener} {
+			if listener != nil {
+				_ = listener.Close()
+			}
+		}
+		if l.nodeListener != nil {
+			_ = l.nodeListener.Close()
+		}
+
+		if l.tempStateDir {
+			if err := os.RemoveAll(l.StateDir); err != nil {
+				errs = append(errs, fmt.Errorf("unable to remove %s. %v", l.StateDir, err))
+			}
+			return
+		}
+		for _, name := range []string{"ca.pem", "cert.pem", "key.pem"} {
+			if err := os.Remove(path.Join(l.StateDir, name)); err != nil && !os.IsNotExist(err) {
+				errs = append(errs, fmt.Errorf("unable to remove %s. %v", name, err))
+			}
+		}
+	})
+
+	return errors.Join(errs...)
 }
@@ -1,6 +1,9 @@
 package server
 
 import (
+	"context"
+	"net"
+	"strings"
 	"testing"
 	"time"
 
@@ -23,10 +26,31 @@ func TestHttpServer(t *testing.T) {
 	}
 
 	k := KubeletInterfaceServer{
-		RootPath: "/tmp/pem",
+		StateDir: "/tmp/pem",
 	}
 	k.Initialize()
-	k.Serve()
+	k.Serve(context.TODO())
 
 	time.Sleep(20 * time.Second)
 }
+
+func TestInitializeAddressInUse(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	k := KubeletInterfaceServer{
+		Address: listener.Addr().String(),
+	}
+	defer k.Shutdown(context.TODO())
+
+	err = k.Initialize()
+	if err == nil || !strings.Contains(err.Error(), listener.Addr().String()) {
+		t.Fatalf("expected the address in use to be reported, got %v", err)
+	}
+	if k.proxyListener != nil {
+		t.Error("expected no listeners to be left bound")
+	}
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"bufio"
+	"net"
+	"sync"
+)
+
+// nodeConn is a connection tunneled through the kubelet proxy on behalf of a node.
+type nodeConn struct {
+	net.Conn
+
+	reader   *bufio.Reader
+	nodeName string
+}
+
+// Read drains anything buffered while handling the CONNECT request before reading from
+// the underlying connection.
+func (c *nodeConn) Read(b []byte) (int, error) {
+	if c.reader != nil && c.reader.Buffered() > 0 {
+		return c.reader.Read(b)
+	}
+	return c.Conn.Read(b)
+}
+
+// connListener is a net.Listener which accepts connections handed to it by the kubelet proxy.
+type connListener struct {
+	addr   net.Addr
+	conns  chan net.Conn
+	closed chan struct{}
+	once   sync.Once
+}
+
+func newConnListener(addr net.Addr) *connListener {
+	return &connListener{
+		addr:   addr,
+		conns:  make(chan net.Conn),
+		closed: make(chan struct{}),
+	}
+}
+
+func (c *connListener) push(conn net.Conn) {
+	select {
+	case c.conns <- conn:
+	case <-c.closed:
+		conn.Close()
+	}
+}
+
+func (c *connListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-c.conns:
+		return conn, nil
+	case <-c.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (c *connListener) Close() error {
+	c.once.Do(func() {
+		close(c.closed)
+	})
+	return nil
+}
+
+func (c *connListener) Addr() net.Addr {
+	return c.addr
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/openshift-splat-team/must-hydrate/pkg/controller"
+)
+
+// handleStatus returns the hydration progress of the must-gather as JSON.
+func (l *KubeletInterfaceServer) handleStatus(writer http.ResponseWriter, req *http.Request) {
+	writeJSON(writer, l.Hydrator.Status())
+}
+
+// FetchStatus queries the kubelet stand-in of a running must-hydrate for its hydration progress.
+//
+// Parameters:
+// - ctx: The context of the request.
+// - address: The host and port the kubelet stand-in listens on.
+// - caFile: The CA which signed the certificate of the kubelet stand-in.
+//
+// Returns:
+// - *controller.HydrationStatus: The hydration progress.
+// - error: An error if the status could not be retrieved.
+func FetchStatus(ctx context.Context, address string, caFile string) (*controller.HydrationStatus, error) {
+	caPem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read CA certificate. %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPem) {
+		return nil, fmt.Errorf("no certificates found in %s", caFile)
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				RootCAs: pool,
+			},
+		},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("https://%s/status", address), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query status. %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d querying status", resp.StatusCode)
+	}
+
+	status := &controller.HydrationStatus{}
+	if err := json.NewDecoder(resp.Body).Decode(status); err != nil {
+		return nil, fmt.Errorf("unable to decode status. %v", err)
+	}
+	return status, nil
+}
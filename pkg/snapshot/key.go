@@ -0,0 +1,48 @@
+package snapshot
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+)
+
+// formatVersion is mixed in to every key. It changes whenever the way a must-gather is
+// hydrated changes, so that snapshots hydrated by an older release are not restored.
+const formatVersion = "1"
+
+// KeyBuilder computes the content hash which identifies a must-gather. Files must be added in
+// a stable order, such as the lexical order of filepath.Walk.
+type KeyBuilder struct {
+	hash hash.Hash
+}
+
+// NewKeyBuilder returns a KeyBuilder with no files added.
+func NewKeyBuilder() *KeyBuilder {
+	k := &KeyBuilder{
+		hash: sha256.New(),
+	}
+	k.write([]byte(formatVersion))
+	return k
+}
+
+// Add adds a file, by its path relative to the must-gather and its contents, to the key.
+func (k *KeyBuilder) Add(relPath string, data []byte) {
+	k.write([]byte(relPath))
+	k.write(data)
+}
+
+// Key returns the key of the files added so far.
+func (k *KeyBuilder) Key() string {
+	return hex.EncodeToString(k.hash.Sum(nil))[:32]
+}
+
+// write adds a length prefixed value so that the boundaries between values are unambiguous.
+func (k *KeyBuilder) write(value []byte) {
+	var length [8]byte
+	n := uint64(len(value))
+	for i := range length {
+		length[i] = byte(n >> (8 * i))
+	}
+	k.hash.Write(length[:])
+	k.hash.Write(value)
+}
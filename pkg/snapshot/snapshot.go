@@ -0,0 +1,318 @@
+package snapshot
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	// metadataFile describes a snapshot. A snapshot directory without it is incomplete.
+	metadataFile = "snapshot.json"
+	// etcdDir holds the etcd data directory of a snapshot.
+	etcdDir = "etcd"
+	// assemblyTimeout is how long a snapshot may take to save. Prune leaves the directories of
+	// snapshots being assembled alone until then, as they may belong to a running Save.
+	assemblyTimeout = time.Hour
+)
+
+// Info describes a saved snapshot.
+type Info struct {
+	// Key is the content hash of the must-gather the snapshot was hydrated from.
+	Key string `json:"key"`
+	// RootPath is the must-gather the snapshot was hydrated from.
+	RootPath string `json:"rootPath"`
+	// ClusterName is the name of the gathered cluster.
+	ClusterName string `json:"clusterName"`
+	// Resources is the number of resources hydrated.
+	Resources int `json:"resources"`
+	// Created is when the snapshot was saved.
+	Created time.Time `json:"created"`
+	// LastUsed is when the snapshot was last restored.
+	LastUsed *time.Time `json:"lastUsed,omitempty"`
+	// Size is the size of the snapshot on disk in bytes.
+	Size int64 `json:"size"`
+}
+
+// Store saves and restores the etcd data directories of hydrated must-gathers.
+type Store struct {
+	// Dir is the directory snapshots are kept in.
+	Dir string
+}
+
+// DefaultDir returns $XDG_CACHE_HOME/must-hydrate/snapshots, or the platform equivalent.
+func DefaultDir() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("unable to find the user cache directory. %v", err)
+	}
+	return filepath.Join(cacheDir, "must-hydrate", "snapshots"), nil
+}
+
+// Get returns the snapshot with the given key. false is returned if there is no such snapshot.
+func (s *Store) Get(key string) (*Info, bool, error) {
+	if err := validateKey(key); err != nil {
+		return nil, false, err
+	}
+	info, err := s.readInfo(key)
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return info, true, nil
+}
+
+// Save copies an etcd data directory, which must not be in use, in to the store. An existing
+// snapshot with the same key is replaced.
+func (s *Store) Save(info Info, dataDir string) error {
+	if err := validateKey(info.Key); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.Dir, 0700); err != nil {
+		return fmt.Errorf("unable to create snapshot directory. %v", err)
+	}
+
+	// snapshots are assembled beside the store and renamed in to place so that a partially
+	// written snapshot is never restored
+	tmpDir, err := os.MkdirTemp(s.Dir, "."+info.Key+"-")
+	if err != nil {
+		return fmt.Errorf("unable to create snapshot directory. %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	if err := copyDir(dataDir, filepath.Join(tmpDir, etcdDir)); err != nil {
+		return fmt.Errorf("unable to copy etcd data directory. %v", err)
+	}
+
+	info.Created = time.Now()
+	info.LastUsed = nil
+	if err := writeInfo(tmpDir, &info); err != nil {
+		return err
+	}
+
+	if err := s.Remove(info.Key); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpDir, s.path(info.Key)); err != nil {
+		return fmt.Errorf("unable to save snapshot %s. %v", info.Key, err)
+	}
+	return nil
+}
+
+// Restore copies the etcd data directory of a snapshot to dataDir, leaving the snapshot
+// untouched by the control plane which runs on the copy.
+func (s *Store) Restore(key string, dataDir string) (*Info, error) {
+	if err := validateKey(key); err != nil {
+		return nil, err
+	}
+	info, err := s.readInfo(key)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read snapshot %s. %v", key, err)
+	}
+
+	if err := copyDir(filepath.Join(s.path(key), etcdDir), dataDir); err != nil {
+		return nil, fmt.Errorf("unable to restore snapshot %s. %v", key, err)
+	}
+
+	now := time.Now()
+	info.LastUsed = &now
+	if err := writeInfo(s.path(key), info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// List returns the snapshots in the store, most recently used first.
+func (s *Store) List() ([]Info, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read snapshot directory. %v", err)
+	}
+
+	var snapshots []Info
+	for _, entry := range entries {
+		if !entry.IsDir() || entry.Name()[0] == '.' {
+			continue
+		}
+		info, err := s.readInfo(entry.Name())
+		if err != nil {
+			// incomplete snapshots are removed by Prune
+			continue
+		}
+		snapshots = append(snapshots, *info)
+	}
+
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		return snapshots[i].lastActivity().After(snapshots[j].lastActivity())
+	})
+	return snapshots, nil
+}
+
+// Remove deletes a snapshot. Removing a snapshot which does not exist is not an error.
+func (s *Store) Remove(key string) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(s.path(key)); err != nil {
+		return fmt.Errorf("unable to remove snapshot %s. %v", key, err)
+	}
+	return nil
+}
+
+// Prune deletes snapshots which have not been used since before the cutoff, along with any
+// incomplete snapshots, and returns the keys of the snapshots deleted. Snapshots which are still
+// being saved are left alone.
+func (s *Store) Prune(cutoff time.Time) ([]string, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read snapshot directory. %v", err)
+	}
+
+	var pruned []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		key := entry.Name()
+		if key[0] == '.' {
+			if stat, err := entry.Info(); err != nil || time.Since(stat.ModTime()) < assemblyTimeout {
+				continue
+			}
+		}
+		var info *Info
+		readErr := validateKey(key)
+		if readErr == nil {
+			info, readErr = s.readInfo(key)
+		}
+		if readErr == nil && !info.lastActivity().Before(cutoff) {
+			continue
+		}
+		if err := os.RemoveAll(s.path(key)); err != nil {
+			return pruned, fmt.Errorf("unable to remove snapshot %s. %v", key, err)
+		}
+		if readErr == nil {
+			pruned = append(pruned, key)
+		}
+	}
+	return pruned, nil
+}
+
+// validateKey returns an error unless key is a hex digest, such as one returned by
+// KeyBuilder.Key, so that it can not name a path outside the store.
+func validateKey(key string) error {
+	if len(key) == 0 {
+		return errors.New("a snapshot key is required")
+	}
+	if _, err := hex.DecodeString(key); err != nil {
+		return fmt.Errorf("invalid snapshot key %q", key)
+	}
+	return nil
+}
+
+func (s *Store) path(key string) string {
+	return filepath.Join(s.Dir, key)
+}
+
+func (s *Store) readInfo(key string) (*Info, error) {
+	data, err := os.ReadFile(filepath.Join(s.path(key), metadataFile))
+	if err != nil {
+		return nil, err
+	}
+	info := &Info{}
+	if err := json.Unmarshal(data, info); err != nil {
+		return nil, fmt.Errorf("unable to parse snapshot %s. %v", key, err)
+	}
+	info.Size, _ = dirSize(s.path(key))
+	return info, nil
+}
+
+func writeInfo(dir string, info *Info) error {
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to marshal snapshot metadata. %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, metadataFile), data, 0600); err != nil {
+		return fmt.Errorf("unable to write snapshot metadata. %v", err)
+	}
+	return nil
+}
+
+func (i Info) lastActivity() time.Time {
+	if i.LastUsed != nil {
+		return *i.LastUsed
+	}
+	return i.Created
+}
+
+// copyDir copies the regular files and directories under src to dst.
+func copyDir(src string, dst string) error {
+	return filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		if d.IsDir() {
+			return os.MkdirAll(target, 0700)
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		return copyFile(p, target)
+	})
+}
+
+func copyFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
@@ -0,0 +1,147 @@
+package snapshot
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSaveRestore(t *testing.T) {
+	dataDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dataDir, "member", "snap"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dataDir, "member", "snap", "db"), []byte("etcd"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	store := &Store{Dir: t.TempDir()}
+	if err := store.Save(Info{Key: "0abc", ClusterName: "test"}, dataDir); err != nil {
+		t.Fatal(err)
+	}
+
+	info, exists, err := store.Get("0abc")
+	if err != nil || !exists {
+		t.Fatalf("expected snapshot abc to exist. %v", err)
+	}
+	if info.ClusterName != "test" || info.Size != int64(len("etcd"))+sizeOf(t, filepath.Join(store.Dir, "0abc", metadataFile)) {
+		t.Errorf("unexpected snapshot info %+v", info)
+	}
+
+	restoreDir := filepath.Join(t.TempDir(), "etcd")
+	if _, err := store.Restore("0abc", restoreDir); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(restoreDir, "member", "snap", "db"))
+	if err != nil || string(data) != "etcd" {
+		t.Errorf("expected restored db, got %q. %v", data, err)
+	}
+
+	if _, exists, _ := store.Get("ffff"); exists {
+		t.Error("expected snapshot ffff to not exist")
+	}
+}
+
+func TestPrune(t *testing.T) {
+	dataDir := t.TempDir()
+	store := &Store{Dir: t.TempDir()}
+	for _, key := range []string{"01d0", "0e20"} {
+		if err := store.Save(Info{Key: key}, dataDir); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// an interrupted save, and one still running
+	if err := os.MkdirAll(filepath.Join(store.Dir, ".partial-123"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	interrupted := time.Now().Add(-2 * assemblyTimeout)
+	if err := os.Chtimes(filepath.Join(store.Dir, ".partial-123"), interrupted, interrupted); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(store.Dir, ".saving-456"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	info, _, _ := store.Get("01d0")
+	info.Created = time.Now().Add(-48 * time.Hour)
+	if err := writeInfo(filepath.Join(store.Dir, "01d0"), info); err != nil {
+		t.Fatal(err)
+	}
+
+	pruned, err := store.Prune(time.Now().Add(-24 * time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pruned) != 1 || pruned[0] != "01d0" {
+		t.Errorf("expected old to be pruned, got %v", pruned)
+	}
+
+	snapshots, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 1 || snapshots[0].Key != "0e20" {
+		t.Errorf("expected only new to remain, got %+v", snapshots)
+	}
+	if _, err := os.Stat(filepath.Join(store.Dir, ".partial-123")); !os.IsNotExist(err) {
+		t.Error("expected the incomplete snapshot to be removed")
+	}
+	if _, err := os.Stat(filepath.Join(store.Dir, ".saving-456")); err != nil {
+		t.Errorf("expected the snapshot being saved to be kept. %v", err)
+	}
+}
+
+func TestInvalidKey(t *testing.T) {
+	parent := t.TempDir()
+	store := &Store{Dir: filepath.Join(parent, "snapshots")}
+	if err := os.MkdirAll(filepath.Join(parent, "outside", "etcd"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"", "../outside", "..", "0abc/.."} {
+		if _, _, err := store.Get(key); err == nil {
+			t.Errorf("expected Get of %q to fail", key)
+		}
+		if err := store.Save(Info{Key: key}, t.TempDir()); err == nil {
+			t.Errorf("expected Save of %q to fail", key)
+		}
+		if _, err := store.Restore(key, t.TempDir()); err == nil {
+			t.Errorf("expected Restore of %q to fail", key)
+		}
+		if err := store.Remove(key); err == nil {
+			t.Errorf("expected Remove of %q to fail", key)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(parent, "outside")); err != nil {
+		t.Errorf("expected the directory outside the store to be kept. %v", err)
+	}
+}
+
+func TestKeyBuilder(t *testing.T) {
+	key := func(files ...string) string {
+		k := NewKeyBuilder()
+		for i := 0; i < len(files); i += 2 {
+			k.Add(files[i], []byte(files[i+1]))
+		}
+		return k.Key()
+	}
+
+	if key("a.yaml", "x") != key("a.yaml", "x") {
+		t.Error("expected the same files to have the same key")
+	}
+	if key("a.yaml", "x") == key("a.yaml", "y") {
+		t.Error("expected different contents to have different keys")
+	}
+	if key("a.yaml", "bc") == key("a.yamlb", "c") {
+		t.Error("expected moving bytes between the path and contents to change the key")
+	}
+}
+
+func sizeOf(t *testing.T, p string) int64 {
+	info, err := os.Stat(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.Size()
+}